@@ -0,0 +1,67 @@
+package uc2024
+
+import "time"
+
+// The side to move stopped moving and sending heartbeats, while the game
+// was still being played
+const TerminationAbandonment Termination = "abandonment"
+
+// abandonmentTimeout is how long the side to move may go quiet before they
+// have abandoned the game, zero when abandonment is off
+func (game *ActiveGame) abandonmentTimeout() time.Duration {
+	if game.mode == GameModeCorrespondence {
+		return config.CorrespondenceAbandonmentTimeout
+	}
+	return config.AbandonmentTimeout
+}
+
+// abandonmentRemaining is how long the side to move has left to move or
+// send a heartbeat. It is false when abandonment is off or the game isn't
+// being played, a lobby waiting for an opponent is left to the purge.
+func (game *ActiveGame) abandonmentRemaining() (time.Duration, bool) {
+	timeout := game.abandonmentTimeout()
+	if timeout <= 0 || game.gameOver || len(game.playerIps) < 2 {
+		return 0, false
+	}
+
+	// The opponent's heartbeats keep the game from being purged but say
+	// nothing about whether the side to move is still there
+	lastActive := game.turnStarted
+	if seen := game.lastHeartbeat[moveTeam(len(game.moves))]; seen.After(lastActive) {
+		lastActive = seen
+	}
+	return timeout - since(lastActive), true
+}
+
+// forfeitIfAbandoned gives the opponent the win once the side to move has
+// been quiet past the abandonment timeout. It is true when the game was
+// forfeited.
+func (game *ActiveGame) forfeitIfAbandoned() bool {
+	remaining, ok := game.abandonmentRemaining()
+	if !ok || remaining > 0 {
+		return false
+	}
+
+	game.finish(GameResult(moveTeam(len(game.moves)).opponent()), TerminationAbandonment)
+	return true
+}
+
+// abandonGames rules on every game the side to move has walked away from
+func abandonGames() {
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	for _, game := range activeGames {
+		if game.forfeitIfAbandoned() {
+			saveGame(game)
+		}
+	}
+}
+
+// abandonGamesLoop checks more often than the purge so the result lands
+// close to the timeout
+func abandonGamesLoop() {
+	for {
+		time.Sleep(5 * time.Second)
+		abandonGames()
+	}
+}
@@ -0,0 +1,57 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAbandonment(t *testing.T) {
+	const timeout = time.Minute
+
+	tests := []struct {
+		name string
+		// Heartbeats sent half way through the wait
+		heartbeats []PlayerTeam
+		// How long black stays quiet after white's move
+		wait time.Duration
+		want GameResult
+	}{
+		{"before the timeout", nil, timeout - time.Second, ""},
+		{"at the timeout", nil, timeout, GameResultWhite},
+		{"heartbeat from the side to move", []PlayerTeam{PlayerTeamBlack}, timeout + time.Second, ""},
+		{"heartbeat from the opponent", []PlayerTeam{PlayerTeamWhite}, timeout + time.Second, GameResultWhite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock()
+			r := newTestServer(t, func(cfg *Config) {
+				cfg.Clock = clock
+				cfg.AbandonmentTimeout = timeout
+			})
+			gameKey, players := startTestGame(t, r, nil)
+			playMoves(t, r, gameKey, players, "e4")
+
+			clock.advance(tt.wait / 2)
+			for _, team := range tt.heartbeats {
+				if status, body := call(t, r, http.MethodPost, "/heartbeat/"+gameKey, url.Values{"player_key": {players[team]}}); status != http.StatusOK {
+					t.Fatalf("heartbeat = %d %v", status, body)
+				}
+			}
+			clock.advance(tt.wait - tt.wait/2)
+			abandonGames()
+
+			accessLock.RLock()
+			game := activeGames[gameKey]
+			accessLock.RUnlock()
+			if game.result != tt.want {
+				t.Errorf("result = %q, want %q", game.result, tt.want)
+			}
+			if len(tt.want) > 0 && game.termination != TerminationAbandonment {
+				t.Errorf("termination = %q, want %q", game.termination, TerminationAbandonment)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package uc2024
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const adminTokenHeader = "X-Admin-Token"
+
+// adminOnly answers like an unknown route unless the configured admin token
+// is sent, so the admin routes can't be discovered
+func adminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(adminTokenHeader)
+		if len(config.AdminToken) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+			c.String(http.StatusNotFound, "404 page not found")
+			c.Abort()
+		}
+	}
+}
+
+// getAdminGame dumps everything the server holds for a game, player keys
+// included
+func getAdminGame(c *gin.Context) {
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		notFound(c, ErrGameNotFound)
+		return
+	}
+
+	var lastMoveAt *string
+	if len(game.moves) > 0 {
+		formatted := game.lastMoveTime.UTC().Format(time.RFC3339Nano)
+		lastMoveAt = &formatted
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":                gameKey,
+		"mode":               game.mode,
+		"chess_variant":      game.chessVariant,
+		"moves":              game.moves,
+		"game_over":          game.gameOver,
+		"result":             game.result,
+		"termination":        game.termination,
+		"host":               game.host,
+		"players":            game.playerIps,
+		"player_names":       game.playerNames,
+		"has_password":       game.password != nil,
+		"spectate_tokens":    len(game.spectateTokens),
+		"takebacks_used":     game.takebacks.used,
+		"takeback_requested": game.takebacks.requested,
+		"idempotency_keys":   len(game.idempotency),
+		"inactivity_warned":  game.inactivityWarned,
+		"started_at":         game.startTime.UTC().Format(time.RFC3339Nano),
+		"last_received_at":   game.lastReceivedTime.UTC().Format(time.RFC3339Nano),
+		"last_move_at":       lastMoveAt,
+		// Seconds, negative once the game is overdue for purging
+		"inactivity_expires_in": game.inactivityRemaining().Seconds(),
+		"lifetime_expires_in":   game.lifetimeRemaining().Seconds(),
+	})
+}
+
+// deleteAdminGame purges a game straight away, players are told it expired
+func deleteAdminGame(c *gin.Context) {
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		notFound(c, ErrGameNotFound)
+		return
+	}
+
+	purgeGame(&game, TerminationAdminPurge)
+	logger.Info("game purged by admin", "game_key", gameKey)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+// getAdminSummary counts the games by state and variant in one pass, for an
+// operations dashboard
+func getAdminSummary(c *gin.Context) {
+	accessLock.Lock()
+	defer accessLock.Unlock()
+
+	byState := map[string]int{
+		"waiting": 0,
+		"active":  0,
+		"over":    0,
+	}
+	byVariant := map[string]int{}
+	totalMoves := 0
+	var oldest, newest *float64
+	for _, game := range activeGames {
+		switch {
+		case game.gameOver:
+			byState["over"]++
+		case len(game.playerIps) < 2:
+			byState["waiting"]++
+		default:
+			byState["active"]++
+		}
+		byVariant[variantName(game.chessVariant)]++
+		totalMoves += len(game.moves)
+
+		age := since(game.startTime).Seconds()
+		if oldest == nil || age > *oldest {
+			oldest = &age
+		}
+		if newest == nil || age < *newest {
+			newest = &age
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"games":      len(activeGames),
+		"by_state":   byState,
+		"by_variant": byVariant,
+		// Seconds since creation, null when there are no games
+		"oldest_game_age": oldest,
+		"newest_game_age": newest,
+		"total_moves":     totalMoves,
+		"purged_games":    len(purgedGames),
+		"seeks":           len(seeks),
+	})
+}
@@ -0,0 +1,125 @@
+package uc2024
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testAdminToken = "admin-token"
+
+// adminCall sends token in the admin header, or none when it is empty. The
+// body is left raw as a rejected call isn't JSON.
+func adminCall(t *testing.T, r http.Handler, method string, path string, token string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/uc2024/admin"+path, nil)
+	if len(token) > 0 {
+		req.Header.Set(adminTokenHeader, token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code, w.Body.Bytes()
+}
+
+func TestAdminAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		sent       string
+		allowed    bool
+	}{
+		{"not configured", "", testAdminToken, false},
+		{"not configured or sent", "", "", false},
+		{"missing", testAdminToken, "", false},
+		{"wrong", testAdminToken, "admin-tokem", false},
+		{"prefix", testAdminToken, "admin", false},
+		{"right", testAdminToken, testAdminToken, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, func(cfg *Config) {
+				cfg.AdminToken = tt.configured
+			})
+			gameKey := createTestGame(t, r, "host", nil)
+
+			for _, route := range []struct{ method, path string }{
+				{http.MethodGet, "/summary"},
+				{http.MethodGet, "/game/" + gameKey},
+				{http.MethodGet, "/game/" + gameKey + "/log"},
+				{http.MethodDelete, "/game/" + gameKey},
+			} {
+				status, body := adminCall(t, r, route.method, route.path, tt.sent)
+				if tt.allowed && status != http.StatusOK {
+					t.Errorf("%s %s = %d %s, want %d", route.method, route.path, status, body, http.StatusOK)
+				}
+				// Looks like the route doesn't exist at all
+				if !tt.allowed && (status != http.StatusNotFound || string(body) != "404 page not found") {
+					t.Errorf("%s %s = %d %s, want a plain 404", route.method, route.path, status, body)
+				}
+			}
+
+			accessLock.RLock()
+			_, kept := activeGames[gameKey]
+			accessLock.RUnlock()
+			if kept == tt.allowed {
+				t.Errorf("game kept = %t after an admin delete that was allowed = %t", kept, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestAdminInspect(t *testing.T) {
+	r := newTestServer(t, func(cfg *Config) {
+		cfg.AdminToken = testAdminToken
+	})
+	gameKey, players := startTestGame(t, r, nil)
+	playMoves(t, r, gameKey, players, "e4")
+
+	status, raw := adminCall(t, r, http.MethodGet, "/game/"+gameKey, testAdminToken)
+	if status != http.StatusOK {
+		t.Fatalf("inspect = %d %s", status, raw)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body["key"] != gameKey || body["game_over"] != false || len(gameMoves(body)) != 1 {
+		t.Errorf("inspect = %v, want game %s one move in", body, gameKey)
+	}
+	// Player keys are only ever shown here
+	seats, _ := body["players"].(map[string]any)
+	for team, playerKey := range players {
+		if seats[playerKey] != string(team) {
+			t.Errorf("players = %v, want %s on %s", seats, playerKey, team)
+		}
+	}
+
+	if status, raw := adminCall(t, r, http.MethodGet, "/game/missing", testAdminToken); status != http.StatusNotFound {
+		t.Errorf("inspect missing game = %d %s, want %d", status, raw, http.StatusNotFound)
+	}
+}
+
+func TestAdminPurge(t *testing.T) {
+	r := newTestServer(t, func(cfg *Config) {
+		cfg.AdminToken = testAdminToken
+	})
+	gameKey, players := startTestGame(t, r, nil)
+	playMoves(t, r, gameKey, players, "e4")
+
+	if status, raw := adminCall(t, r, http.MethodDelete, "/game/"+gameKey, testAdminToken); status != http.StatusOK {
+		t.Fatalf("purge = %d %s", status, raw)
+	}
+
+	// Players are told the game expired, not that it never existed
+	status, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if status != http.StatusGone || body["code"] != ErrGameExpired.Code || body["termination"] != string(TerminationAdminPurge) {
+		t.Errorf("game after purge = %d %v, want %d %s by %s", status, body, http.StatusGone, ErrGameExpired.Code, TerminationAdminPurge)
+	}
+
+	if status, raw := adminCall(t, r, http.MethodDelete, "/game/"+gameKey, testAdminToken); status != http.StatusNotFound {
+		t.Errorf("second purge = %d %s, want %d", status, raw, http.StatusNotFound)
+	}
+}
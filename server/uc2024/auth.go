@@ -0,0 +1,123 @@
+package uc2024
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// With Config.JWTSecret set a player is whoever their bearer token says they
+// are. The token's subject replaces the player_key param and is who they are
+// rated as, so a player can't take over someone else's seat or rating by
+// guessing their key.
+
+const tokenSubjectKey = "token_subject"
+
+var (
+	errMalformedToken = errors.New("malformed token")
+	errTokenExpired   = errors.New("token expired")
+)
+
+// tokenClaims are the claims the server looks at, anything else in the
+// token is ignored
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt *int64 `json:"exp"`
+	NotBefore *int64 `json:"nbf"`
+}
+
+// verifyToken checks an HS256 JWT against the secret and gives its subject.
+// Tokens signed with any other algorithm, including none, are turned away.
+func verifyToken(token string, secret string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errMalformedToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil || header.Algorithm != "HS256" {
+		return "", errMalformedToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errMalformedToken
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", errMalformedToken
+	}
+
+	var claims tokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil || len(claims.Subject) == 0 {
+		return "", errMalformedToken
+	}
+	if claims.ExpiresAt != nil && !now().Before(time.Unix(*claims.ExpiresAt, 0)) {
+		return "", errTokenExpired
+	}
+	if claims.NotBefore != nil && now().Before(time.Unix(*claims.NotBefore, 0)) {
+		return "", errMalformedToken
+	}
+
+	return claims.Subject, nil
+}
+
+func decodeTokenPart(part string, into any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+// bearerToken reads the Authorization header. Browsers can't set headers on
+// WebSocket upgrades so the access_token param is taken as well.
+func bearerToken(c *gin.Context) string {
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return param(c, "access_token")
+}
+
+// playerIdentity checks the bearer token when tokens are configured. A
+// request without one carries on with no player, which is enough to
+// spectate, and checkPlayerKey turns it away from anything else.
+func playerIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(config.JWTSecret) == 0 {
+			return
+		}
+
+		token := bearerToken(c)
+		if len(token) == 0 {
+			return
+		}
+
+		subject, err := verifyToken(token, config.JWTSecret)
+		switch {
+		case errors.Is(err, errTokenExpired):
+			unauthorized(c, ErrTokenExpired)
+			c.Abort()
+		case err != nil:
+			unauthorized(c, ErrInvalidToken)
+			c.Abort()
+		default:
+			c.Set(tokenSubjectKey, subject)
+		}
+	}
+}
+
+// tokenSubject is the verified subject of the request's token, empty when
+// there isn't one
+func tokenSubject(c *gin.Context) string {
+	return c.GetString(tokenSubjectKey)
+}
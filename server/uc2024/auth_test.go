@@ -0,0 +1,103 @@
+package uc2024
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = strings.Repeat("s", 32)
+
+// signToken makes an HS256 token for the subject expiring at expires
+func signToken(t *testing.T, secret string, subject string, expires time.Time) string {
+	t.Helper()
+	encode := func(value any) string {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	unsigned := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(map[string]any{"sub": subject, "exp": expires.Unix()})
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// callWithToken sends the request with token as its bearer token, or none
+// when token is empty
+func callWithToken(t *testing.T, r http.Handler, method string, path string, token string, params url.Values) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/uc2024"+path+"?"+params.Encode(), nil)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return send(t, r, req)
+}
+
+func TestMoveWithToken(t *testing.T) {
+	r := newTestServer(t, func(cfg *Config) {
+		cfg.JWTSecret = testSecret
+	})
+	later := time.Now().Add(time.Hour)
+	tokens := map[string]string{
+		"alice": signToken(t, testSecret, "alice", later),
+		"bob":   signToken(t, testSecret, "bob", later),
+	}
+
+	status, body := callWithToken(t, r, http.MethodPost, "/create", tokens["alice"], url.Values{"chess_variant": {"Standard"}})
+	if status != http.StatusOK {
+		t.Fatalf("create: %d %v", status, body)
+	}
+	gameKey := body["game_key"].(string)
+	status, body = callWithToken(t, r, http.MethodPost, "/join/"+gameKey, tokens["bob"], nil)
+	if status != http.StatusOK {
+		t.Fatalf("join: %d %v", status, body)
+	}
+	white, black := "alice", "bob"
+	if body["team"] == string(PlayerTeamWhite) {
+		white, black = "bob", "alice"
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		params     url.Values
+		wantStatus int
+		wantCode   string
+	}{
+		{"missing token", "", nil, http.StatusForbidden, ErrNotSeated.Code},
+		{"another player's key without a token", "", url.Values{"player_key": {white}}, http.StatusForbidden, ErrNotSeated.Code},
+		{"expired token", signToken(t, testSecret, white, time.Now().Add(-time.Minute)), nil, http.StatusUnauthorized, ErrTokenExpired.Code},
+		{"token signed with another secret", signToken(t, strings.Repeat("x", 32), white, later), nil, http.StatusUnauthorized, ErrInvalidToken.Code},
+		{"valid token of a player who isn't seated", signToken(t, testSecret, "mallory", later), nil, http.StatusForbidden, ErrNotSeated.Code},
+		{"valid token off turn", tokens[black], nil, http.StatusForbidden, ErrNotYourTurn.Code},
+		{"valid token on turn", tokens[white], nil, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := url.Values{"move": {"e4"}}
+			for name, values := range tt.params {
+				params[name] = values
+			}
+			status, body := callWithToken(t, r, http.MethodPost, "/move/"+gameKey, tt.token, params)
+			if status != tt.wantStatus || (len(tt.wantCode) > 0 && body["code"] != tt.wantCode) {
+				t.Errorf("move = %d %v, want %d %s", status, body, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+
+	_, body = call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if moves := gameMoves(body); len(moves) != 1 {
+		t.Errorf("moves = %v, want only the valid token's", moves)
+	}
+}
@@ -0,0 +1,117 @@
+package uc2024
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Parameters can be sent as a JSON object in the body instead of the query
+// string, which keeps player keys and moves out of proxy access logs. Query
+// params keep working for older clients.
+
+const requestBodyKey = "request_body"
+
+// requestBody is every parameter a JSON body may carry. Numbers and bools
+// are sent as JSON numbers and bools, supported_variants is the only list.
+// Fields are pointers so a parameter left out falls back to the query string.
+type requestBody struct {
+	PlayerKey         *string  `json:"player_key"`
+	PlayerName        *string  `json:"player_name"`
+	AccessToken       *string  `json:"access_token"`
+	ChessVariant      *string  `json:"chess_variant"`
+	SupportedVariants []string `json:"supported_variants"`
+	Password          *string  `json:"password"`
+	Mode              *string  `json:"mode"`
+	ClockMode         *string  `json:"clock_mode"`
+	MoveTimeLimit     *int     `json:"move_time_limit"`
+	ClockIncrement    *int     `json:"clock_increment"`
+	AllowTakebacks    *bool    `json:"allow_takebacks"`
+	MaxTakebacks      *int     `json:"max_takebacks"`
+	TimeControl       *string  `json:"time_control"`
+	PGN               *string  `json:"pgn"`
+	Move              *string  `json:"move"`
+	From              *string  `json:"from"`
+	IdempotencyKey    *string  `json:"idempotency_key"`
+	SpectateToken     *string  `json:"spectate_token"`
+}
+
+// params are the single valued parameters that were sent, in their query
+// string form
+func (body requestBody) params() map[string]string {
+	params := map[string]string{}
+	value := reflect.ValueOf(body)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Kind() != reflect.Pointer || field.IsNil() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+		params[name] = fmt.Sprint(field.Elem().Interface())
+	}
+	return params
+}
+
+// boundBody is what bodyParams leaves for param and paramList to read
+type boundBody struct {
+	params map[string]string
+	lists  map[string][]string
+}
+
+// bodyParams binds a JSON body when one is sent so param can read from it
+func bodyParams() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.ContentType() != binding.MIMEJSON || c.Request.ContentLength == 0 {
+			return
+		}
+
+		var body requestBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			badRequest(c, ErrInvalidBody)
+			c.Abort()
+			return
+		}
+
+		bound := boundBody{
+			params: body.params(),
+			lists:  map[string][]string{},
+		}
+		if body.SupportedVariants != nil {
+			bound.lists["supported_variants"] = body.SupportedVariants
+		}
+		c.Set(requestBodyKey, bound)
+	}
+}
+
+// getParam reads a parameter from the JSON body, falling back to the query
+// string
+func getParam(c *gin.Context, name string) (string, bool) {
+	if body, ok := c.Get(requestBodyKey); ok {
+		if value, ok := body.(boundBody).params[name]; ok {
+			return value, true
+		}
+	}
+
+	return c.GetQuery(name)
+}
+
+func param(c *gin.Context, name string) string {
+	value, _ := getParam(c, name)
+	return value
+}
+
+// paramList reads a list from the JSON body, falling back to the query
+// string where it is given by repeating the parameter
+func paramList(c *gin.Context, name string) []string {
+	if body, ok := c.Get(requestBodyKey); ok {
+		if values, ok := body.(boundBody).lists[name]; ok {
+			return values
+		}
+	}
+
+	return c.QueryArray(name)
+}
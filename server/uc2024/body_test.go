@@ -0,0 +1,90 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// callJSON sends body as a JSON request body along with any query params
+func callJSON(t *testing.T, r http.Handler, method string, path string, query url.Values, body string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/uc2024"+path+"?"+query.Encode(), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return send(t, r, req)
+}
+
+func TestBodyParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		query      url.Values
+		wantStatus int
+		wantCode   string
+		// Seconds the created game gives each move
+		wantMoveTimeLimit float64
+	}{
+		{"body", `{"player_key": "host", "chess_variant": "Standard", "move_time_limit": 30, "allow_takebacks": false}`, nil, http.StatusOK, "", 30},
+		{"query", "", url.Values{"player_key": {"host"}, "chess_variant": {"Standard"}, "move_time_limit": {"30"}}, http.StatusOK, "", 30},
+		{"body and query", `{"chess_variant": "Standard"}`, url.Values{"player_key": {"host"}, "move_time_limit": {"30"}}, http.StatusOK, "", 30},
+		{"body wins over query", `{"chess_variant": "Standard", "move_time_limit": 30}`, url.Values{"player_key": {"host"}, "move_time_limit": {"60"}}, http.StatusOK, "", 30},
+		{"malformed JSON", `{"player_key": "host",`, nil, http.StatusBadRequest, ErrInvalidBody.Code, 0},
+		{"not an object", `["host"]`, nil, http.StatusBadRequest, ErrInvalidBody.Code, 0},
+		{"number as a string", `{"player_key": "host", "chess_variant": "Standard", "move_time_limit": "30"}`, nil, http.StatusBadRequest, ErrInvalidBody.Code, 0},
+		{"nested object", `{"player_key": {"id": "host"}, "chess_variant": "Standard"}`, nil, http.StatusBadRequest, ErrInvalidBody.Code, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+			status, body := callJSON(t, r, http.MethodPost, "/create", tt.query, tt.body)
+			if status != tt.wantStatus || (len(tt.wantCode) > 0 && body["code"] != tt.wantCode) {
+				t.Fatalf("create = %d %v, want %d %s", status, body, tt.wantStatus, tt.wantCode)
+			}
+			if status != http.StatusOK {
+				return
+			}
+
+			_, game := call(t, r, http.MethodGet, "/game/"+body["game_key"].(string), url.Values{"player_key": {"host"}})
+			if game["move_time_limit"] != tt.wantMoveTimeLimit {
+				t.Errorf("move_time_limit = %v, want %v", game["move_time_limit"], tt.wantMoveTimeLimit)
+			}
+		})
+	}
+}
+
+func TestSupportedVariantsParam(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		query     url.Values
+		supported bool
+	}{
+		{"left out", "", nil, true},
+		{"body list", `{"supported_variants": ["Standard", "Horde"]}`, nil, true},
+		{"body list without the variant", `{"supported_variants": ["Standard"]}`, nil, false},
+		{"body comma separated", `{"supported_variants": ["Standard,Horde"]}`, nil, true},
+		{"repeated query", "", url.Values{"supported_variants": {"Standard", "Horde"}}, true},
+		{"comma separated query", "", url.Values{"supported_variants": {"Standard,Horde"}}, true},
+		{"query without the variant", "", url.Values{"supported_variants": {"Standard"}}, false},
+		{"body wins over query", `{"supported_variants": ["Horde"]}`, url.Values{"supported_variants": {"Standard"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+			gameKey := createTestGame(t, r, "host", url.Values{"chess_variant": {"Horde"}})
+
+			query := url.Values{"player_key": {"guest"}}
+			for name, values := range tt.query {
+				query[name] = values
+			}
+			status, body := callJSON(t, r, http.MethodPost, "/join/"+gameKey, query, tt.body)
+			if supported := status == http.StatusOK; supported != tt.supported {
+				t.Errorf("join = %d %v, want supported %t", status, body, tt.supported)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package uc2024
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var chess960Seed = regexp.MustCompile(`^Chess960\((\d+)\)$`)
+
+// chess960Variant is standard chess from the client's shuffle of the back
+// rank, reproduced from the seed. pgn only knows how to castle from the
+// standard squares, which is fine since the client only lets the standard
+// layout castle.
+type chess960Variant struct {
+	standardVariant
+}
+
+// InitialFEN is the shuffled layout, empty without a seed since the layout
+// can't be known
+func (v chess960Variant) InitialFEN(chessVariant string) string {
+	return v.StartingFEN(chessVariant)
+}
+
+// StartingFEN shuffles the back rank the way the client does, empty when
+// the variant has no seed the client would accept
+func (chess960Variant) StartingFEN(chessVariant string) string {
+	seed, ok := variantSeed(chessVariant)
+	if !ok {
+		return ""
+	}
+
+	backRank := chess960BackRank(seed)
+	// The client's board only keeps castling rights when they are the
+	// standard ones
+	castling := "-"
+	if backRank[0] == 'r' && backRank[4] == 'k' && backRank[7] == 'r' {
+		castling = "KQkq"
+	}
+
+	return backRank + "/pppppppp/8/8/8/8/PPPPPPPP/" + strings.ToUpper(backRank) + " w " + castling + " - 0 1"
+}
+
+// variantSeed reads the seed from variants like Chess960(1234), false when
+// there isn't one the client would accept
+func variantSeed(chessVariant string) (uint32, bool) {
+	match := chess960Seed.FindStringSubmatch(chessVariant)
+	if match == nil {
+		return 0, false
+	}
+	seed, err := strconv.ParseUint(match[1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(seed), true
+}
+
+// seedVariant picks the seed for a Chess960 game sent without one, so every
+// game has a layout that can be recreated and shared. It comes from the
+// server's random source, a fixed Config.Random gives the same seeds every
+// run.
+func seedVariant(chessVariant string) string {
+	if chessVariant != "Chess960" && chessVariant != "Chess960()" {
+		return chessVariant
+	}
+	return fmt.Sprintf("Chess960(%d)", randomIntn(math.MaxInt32))
+}
+
+// chess960BackRank repeats the client's shuffle of the back rank until the
+// bishops are on opposite colours and the king is between the rooks. The
+// client seeds rand 0.8's StdRng, ChaCha12, with the seed's big endian bytes
+// followed by zeros.
+func chess960BackRank(seed uint32) string {
+	var key [32]byte
+	binary.BigEndian.PutUint32(key[:4], seed)
+	rng := newChaCha12(key)
+
+	backRank := []byte("rnbqkbnr")
+	for {
+		// rand 0.8's SliceRandom::shuffle
+		for i := len(backRank) - 1; i > 0; i-- {
+			j := rng.index(uint32(i + 1))
+			backRank[i], backRank[j] = backRank[j], backRank[i]
+		}
+		if validChess960(backRank) {
+			return string(backRank)
+		}
+	}
+}
+
+func validChess960(backRank []byte) bool {
+	lightBishop, darkBishop := false, false
+	rooks, kingBetween := 0, false
+	for i, piece := range backRank {
+		switch piece {
+		case 'b':
+			if i%2 == 0 {
+				darkBishop = true
+			} else {
+				lightBishop = true
+			}
+		case 'k':
+			kingBetween = rooks == 1
+		case 'r':
+			rooks++
+		}
+	}
+	return lightBishop && darkBishop && kingBetween && rooks == 2
+}
+
+// chaCha12 gives the same stream of words as rand_chacha's ChaCha12Rng with
+// a zero stream
+type chaCha12 struct {
+	state  [16]uint32
+	buffer [16]uint32
+	used   int
+	// 6 for ChaCha12, tests use 10 to check the core against the published
+	// ChaCha20 vectors
+	doubleRounds int
+}
+
+func newChaCha12(key [32]byte) *chaCha12 {
+	rng := &chaCha12{used: 16, doubleRounds: 6}
+	rng.state[0], rng.state[1], rng.state[2], rng.state[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		rng.state[4+i] = binary.LittleEndian.Uint32(key[i*4:])
+	}
+	return rng
+}
+
+func quarterRound(x *[16]uint32, a, b, c, d int) {
+	x[a] += x[b]
+	x[d] = bits.RotateLeft32(x[d]^x[a], 16)
+	x[c] += x[d]
+	x[b] = bits.RotateLeft32(x[b]^x[c], 12)
+	x[a] += x[b]
+	x[d] = bits.RotateLeft32(x[d]^x[a], 8)
+	x[c] += x[d]
+	x[b] = bits.RotateLeft32(x[b]^x[c], 7)
+}
+
+func (rng *chaCha12) nextUint32() uint32 {
+	if rng.used == 16 {
+		x := rng.state
+		for round := 0; round < rng.doubleRounds; round++ {
+			quarterRound(&x, 0, 4, 8, 12)
+			quarterRound(&x, 1, 5, 9, 13)
+			quarterRound(&x, 2, 6, 10, 14)
+			quarterRound(&x, 3, 7, 11, 15)
+			quarterRound(&x, 0, 5, 10, 15)
+			quarterRound(&x, 1, 6, 11, 12)
+			quarterRound(&x, 2, 7, 8, 13)
+			quarterRound(&x, 3, 4, 9, 14)
+		}
+		for i := range x {
+			rng.buffer[i] = x[i] + rng.state[i]
+		}
+		// 64 bit block counter
+		rng.state[12]++
+		if rng.state[12] == 0 {
+			rng.state[13]++
+		}
+		rng.used = 0
+	}
+
+	word := rng.buffer[rng.used]
+	rng.used++
+	return word
+}
+
+// index is rand 0.8's gen_range(0..bound) for u32, a widening multiply
+// that rejects the biased low words
+func (rng *chaCha12) index(bound uint32) int {
+	zone := (bound << bits.LeadingZeros32(bound)) - 1
+	for {
+		hi, lo := bits.Mul32(rng.nextUint32(), bound)
+		if lo <= zone {
+			return int(hi)
+		}
+	}
+}
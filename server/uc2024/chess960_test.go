@@ -0,0 +1,141 @@
+package uc2024
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// The client's src/uchess.rs pins the same layouts in
+// chess960_layouts_match_the_server, so a change to either shuffle fails
+// on both sides
+func TestChess960StartingFEN(t *testing.T) {
+	tests := []struct {
+		chessVariant string
+		want         string
+	}{
+		{"Chess960(0)", "nrnbkrbq/pppppppp/8/8/8/8/PPPPPPPP/NRNBKRBQ w - - 0 1"},
+		{"Chess960(1)", "rbkqrnbn/pppppppp/8/8/8/8/PPPPPPPP/RBKQRNBN w - - 0 1"},
+		{"Chess960(2)", "rnnbkrbq/pppppppp/8/8/8/8/PPPPPPPP/RNNBKRBQ w - - 0 1"},
+		{"Chess960(42)", "rkrbbnnq/pppppppp/8/8/8/8/PPPPPPPP/RKRBBNNQ w - - 0 1"},
+		{"Chess960(518)", "qrnnbbkr/pppppppp/8/8/8/8/PPPPPPPP/QRNNBBKR w - - 0 1"},
+		{"Chess960(4294967295)", "rnbbqkrn/pppppppp/8/8/8/8/PPPPPPPP/RNBBQKRN w - - 0 1"},
+		// Past uint32, the client won't parse it
+		{"Chess960(4294967296)", ""},
+		{"Chess960", ""},
+	}
+
+	for _, tt := range tests {
+		if got := variantRules(tt.chessVariant).StartingFEN(tt.chessVariant); got != tt.want {
+			t.Errorf("StartingFEN(%s) = %q, want %q", tt.chessVariant, got, tt.want)
+		}
+		if got := variantRules(tt.chessVariant).InitialFEN(tt.chessVariant); got != tt.want {
+			t.Errorf("InitialFEN(%s) = %q, want %q", tt.chessVariant, got, tt.want)
+		}
+	}
+}
+
+func TestChess960BackRanksAreValid(t *testing.T) {
+	for seed := uint32(0); seed < 2000; seed++ {
+		backRank := chess960BackRank(seed)
+		if !validChess960([]byte(backRank)) {
+			t.Fatalf("seed %d gave %s", seed, backRank)
+		}
+
+		counts := map[rune]int{}
+		for _, piece := range backRank {
+			counts[piece]++
+		}
+		if counts['r'] != 2 || counts['n'] != 2 || counts['b'] != 2 || counts['q'] != 1 || counts['k'] != 1 {
+			t.Fatalf("seed %d gave %s", seed, backRank)
+		}
+	}
+}
+
+// With ten double rounds the core is ChaCha20, the first block for the zero
+// key and nonce is RFC 7539's test vector #1
+func TestChaChaCore(t *testing.T) {
+	want := []uint32{
+		0xade0b876, 0x903df1a0, 0xe56a5d40, 0x28bd8653,
+		0xb819d2bd, 0x1aed8da0, 0xccef36a8, 0xc70d778b,
+		0x7c5941da, 0x8d485751, 0x3fe02477, 0x374ad8b8,
+		0xf4b8436a, 0x1ca11815, 0x69b687c3, 0x8665eeb2,
+	}
+
+	rng := newChaCha12([32]byte{})
+	rng.doubleRounds = 10
+	for i, word := range want {
+		if got := rng.nextUint32(); got != word {
+			t.Fatalf("word %d = %#08x, want %#08x", i, got, word)
+		}
+	}
+}
+
+func TestChaChaIndexIsInRange(t *testing.T) {
+	rng := newChaCha12([32]byte{1})
+	for _, bound := range []uint32{1, 2, 3, 7, 8, 1 << 31, 1<<32 - 1} {
+		for i := 0; i < 100; i++ {
+			if got := rng.index(bound); got < 0 || uint32(got) >= bound {
+				t.Fatalf("index(%d) = %d", bound, got)
+			}
+		}
+	}
+}
+
+func TestChess960SeedRange(t *testing.T) {
+	tests := []struct {
+		chessVariant string
+		valid        bool
+	}{
+		{"Chess960(0)", true},
+		{"Chess960(4294967295)", true},
+		{"Chess960(4294967296)", false},
+		{"Chess960(9999999999)", false},
+		{"Chess960", true},
+		{"Chess960()", true},
+	}
+
+	r := newTestServer(t, nil)
+	for _, tt := range tests {
+		status, body := call(t, r, http.MethodPost, "/create", url.Values{"player_key": {"host"}, "chess_variant": {tt.chessVariant}})
+		if tt.valid && status != http.StatusOK {
+			t.Errorf("create %s = %d %v, want it created", tt.chessVariant, status, body)
+		}
+		if !tt.valid && (status != http.StatusBadRequest || body["code"] != ErrInvalidVariant.Code) {
+			t.Errorf("create %s = %d %v, want %d %s", tt.chessVariant, status, body, http.StatusBadRequest, ErrInvalidVariant.Code)
+		}
+	}
+}
+
+// A game sent without a seed takes one from Config.Random, and its layout
+// only depends on that seed
+func TestChess960SeedFromRandom(t *testing.T) {
+	const source = 7
+	want := rand.New(rand.NewSource(source)).Intn(math.MaxInt32)
+
+	var fens []any
+	for run := 0; run < 2; run++ {
+		r := newTestServer(t, func(cfg *Config) {
+			cfg.Random = rand.NewSource(source)
+		})
+		status, body := call(t, r, http.MethodPost, "/create", url.Values{"player_key": {"host"}, "chess_variant": {"Chess960"}})
+		if status != http.StatusOK {
+			t.Fatalf("create: %d %v", status, body)
+		}
+
+		if body["seed"] != float64(want) {
+			t.Errorf("seed = %v, want %d", body["seed"], want)
+		}
+		fen := variantRules("Chess960").StartingFEN(body["chess_variant"].(string))
+		if body["initial_fen"] != fen || len(fen) == 0 {
+			t.Errorf("initial_fen = %v for %v", body["initial_fen"], body["chess_variant"])
+		}
+		fens = append(fens, body["initial_fen"])
+	}
+
+	if fens[0] != fens[1] {
+		t.Errorf("the same seed gave %v and %v", fens[0], fens[1])
+	}
+}
@@ -0,0 +1,46 @@
+package uc2024
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Clock is where the server reads the time from, so purges and timeouts can
+// be driven by a clock that is moved forward by hand
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+var clock Clock = realClock{}
+
+// random picks game keys and teams. rand.Rand isn't safe for concurrent use
+// so it has its own lock.
+var randomLock *sync.Mutex = &sync.Mutex{}
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+func now() time.Time {
+	return clock.Now()
+}
+
+func since(t time.Time) time.Duration {
+	return now().Sub(t)
+}
+
+func randomIntn(n int) int {
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	return random.Intn(n)
+}
+
+func seedRandom(source rand.Source) {
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	random = rand.New(source)
+}
@@ -1,15 +1,83 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/sardap/ultimate-chess-2024/server/uc2024"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Set at build time with
+// -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse HEAD)"
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
 func main() {
+	config := uc2024.DefaultConfig()
+	config.Version = version
+	config.Commit = commit
+	// Read from the environment so the token doesn't show up in ps
+	config.AdminToken = os.Getenv("UC2024_ADMIN_TOKEN")
+	config.JWTSecret = os.Getenv("UC2024_JWT_SECRET")
+	flag.IntVar(&config.MaxMoves, "max-moves", config.MaxMoves, "moves after which a game is drawn by length")
+	flag.DurationVar(&config.InactivityTimeout, "inactivity-timeout", config.InactivityTimeout, "purge games after this long without a move or heartbeat")
+	flag.DurationVar(&config.PreGameInactivityTimeout, "pre-game-inactivity-timeout", config.PreGameInactivityTimeout, "purge games still waiting for an opponent after this long without a heartbeat")
+	flag.DurationVar(&config.InactivityWarning, "inactivity-warning", config.InactivityWarning, "warn the side to move this long before an idle game is purged, 0 disables")
+	flag.DurationVar(&config.AbandonmentTimeout, "abandonment-timeout", config.AbandonmentTimeout, "the side to move loses a started game after this long without a move or heartbeat, 0 disables")
+	flag.DurationVar(&config.MaxGameDuration, "max-game-duration", config.MaxGameDuration, "purge games this long after creation")
+	flag.IntVar(&config.MaxSpectatorsPerGame, "max-spectators", config.MaxSpectatorsPerGame, "spectators per game, players can always connect, 0 disables")
+	flag.IntVar(&config.MaxGamesPerIP, "max-games-per-ip", config.MaxGamesPerIP, "unfinished games players from one IP can be in, 0 disables")
+	flag.IntVar(&config.FailedLookupThreshold, "failed-lookup-threshold", config.FailedLookupThreshold, "failed game lookups per IP before backing off, 0 disables")
+	flag.StringVar(&config.StorageFile, "storage", config.StorageFile, "file to persist ratings in, empty keeps them in memory")
+	flag.Float64Var(&config.KFactor, "k-factor", config.KFactor, "Elo K-factor for established players")
+	flag.StringVar(&config.GameKeyAlphabet, "game-key-alphabet", config.GameKeyAlphabet, "characters game keys are made of")
+	flag.IntVar(&config.GameKeyLength, "game-key-length", config.GameKeyLength, "length of game keys")
+	flag.Parse()
+
+	log.Printf("game keyspace is %.3g keys", config.GameKeyspace())
+
 	r := gin.Default()
 
-	uc2024.AddChessServerGroup(r)
+	if err := uc2024.AddChessServerGroup(r, config); err != nil {
+		log.Fatalf("setting up chess server: %v", err)
+	}
+
+	srv := &http.Server{
+		Addr:    ":8543",
+		Handler: r,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("serving: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("shutting down")
+
+	// Let in flight requests finish before the games are written out
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutting down server: %v", err)
+	}
 
-	r.Run(":8543") // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
+	if err := uc2024.Flush(); err != nil {
+		log.Printf("flushing games: %v", err)
+	}
 }
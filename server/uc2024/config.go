@@ -0,0 +1,184 @@
+package uc2024
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Config holds the tunable limits of the chess server.
+type Config struct {
+	// Build info reported by the version endpoint
+	Version string
+	Commit  string
+	// Characters and length of generated game keys. The default alphabet
+	// leaves out characters that are easy to misread, giving 26^6 or about
+	// 3.1e8 keys. With 100 live games a guess hits one in roughly 3 million
+	// tries, add characters to the length for public servers. Keyspaces
+	// under minGameKeyspace are rejected.
+	GameKeyAlphabet string
+	GameKeyLength   int
+	// Longest move string accepted. The move grammar allows at most 9
+	// characters (Nb1d2xc3+, the game client can repeat disambiguation), the
+	// default keeps the 20 moves were always capped at so older clients
+	// padding or annotating moves get the invalid move error they did
+	// before. Variants with longer notation can be given their own limit by
+	// name.
+	MaxMoveLength        int
+	VariantMaxMoveLength map[string]int
+	// Number of moves after which a game is drawn by length
+	MaxMoves int
+	// Games are purged after this long without a move or heartbeat, and
+	// sooner while still waiting for an opponent so abandoned lobbies clear
+	InactivityTimeout        time.Duration
+	PreGameInactivityTimeout time.Duration
+	// How long before an idle game is purged the side to move is warned,
+	// zero disables the warning
+	InactivityWarning time.Duration
+	// A started game whose side to move neither moves nor sends a heartbeat
+	// for this long is lost by them on abandonment, well before it would be
+	// purged without a result. Zero disables it.
+	AbandonmentTimeout time.Duration
+	// Games are purged this long after creation regardless of activity
+	MaxGameDuration time.Duration
+	// The same limits for correspondence games, where a move a day is normal
+	CorrespondenceInactivityTimeout  time.Duration
+	CorrespondenceMaxGameDuration    time.Duration
+	CorrespondenceAbandonmentTimeout time.Duration
+	// Purged game keys are remembered for this long, up to MaxPurgedGames,
+	// so lookups can say the game expired. Zero MaxPurgedGames disables it.
+	PurgedGameMemory time.Duration
+	MaxPurgedGames   int
+	// How often the public games list is rebuilt
+	GamesListRefresh time.Duration
+	// Entries kept in each game's admin log, zero disables the log
+	GameLogSize int
+	// Recent idempotency keys remembered per game for retried moves
+	IdempotencyKeys int
+	// Takebacks each side gets unless the host picks otherwise
+	MaxTakebacks int
+	// WebSocket subscribers per game that aren't seated in it, the players
+	// can always connect. Zero disables the cap.
+	MaxSpectatorsPerGame int
+	// Seeks waiting longer than this without a match expire
+	SeekTimeout time.Duration
+	// JSON file ratings are kept in, empty keeps them in memory only
+	StorageFile string
+	// Elo K-factor, players with fewer than ProvisionalGames rated games
+	// use ProvisionalKFactor so they settle quickly
+	KFactor            float64
+	ProvisionalKFactor float64
+	ProvisionalGames   int
+	// Misses per IP before game lookups are blocked, zero disables blocking
+	FailedLookupThreshold int
+	// Misses older than this are forgotten
+	FailedLookupWindow time.Duration
+	// First block duration, doubled for every further miss
+	FailedLookupBackoff    time.Duration
+	FailedLookupMaxBackoff time.Duration
+	// Unfinished games players from one IP can be seated in, so a single
+	// client can't take every game slot. Zero disables the cap.
+	MaxGamesPerIP int
+	// Sent in the X-Admin-Token header to use the admin routes, which look
+	// like they don't exist without it. Empty disables them.
+	AdminToken string
+	// HS256 secret player tokens are signed with. When set players are
+	// identified by their bearer token's subject instead of player_key, and
+	// rated under it. Empty keeps the free-form player keys.
+	JWTSecret string
+	// Time and randomness used by the server, the real clock and a time
+	// seeded source when nil. Tests can set these to fast-forward purges and
+	// get the same game keys and teams every run.
+	Clock  Clock
+	Random rand.Source
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Version:                          "dev",
+		Commit:                           "unknown",
+		GameKeyAlphabet:                  "abcdefghjkmnrstuvwxyz34678",
+		GameKeyLength:                    6,
+		MaxMoveLength:                    20,
+		VariantMaxMoveLength:             map[string]int{},
+		MaxMoves:                         500,
+		InactivityTimeout:                10 * time.Minute,
+		PreGameInactivityTimeout:         3 * time.Minute,
+		InactivityWarning:                1 * time.Minute,
+		AbandonmentTimeout:               5 * time.Minute,
+		MaxGameDuration:                  1 * time.Hour,
+		CorrespondenceInactivityTimeout:  3 * 24 * time.Hour,
+		CorrespondenceMaxGameDuration:    60 * 24 * time.Hour,
+		CorrespondenceAbandonmentTimeout: 2 * 24 * time.Hour,
+		PurgedGameMemory:                 1 * time.Hour,
+		MaxPurgedGames:                   1000,
+		GamesListRefresh:                 5 * time.Second,
+		GameLogSize:                      200,
+		IdempotencyKeys:                  32,
+		MaxTakebacks:                     3,
+		MaxSpectatorsPerGame:             200,
+		SeekTimeout:                      2 * time.Minute,
+		KFactor:                          20,
+		ProvisionalKFactor:               40,
+		ProvisionalGames:                 10,
+		FailedLookupThreshold:            5,
+		FailedLookupWindow:               10 * time.Minute,
+		FailedLookupBackoff:              5 * time.Second,
+		FailedLookupMaxBackoff:           5 * time.Minute,
+		MaxGamesPerIP:                    20,
+	}
+}
+
+// maxMoveLength is the move length limit for the variant
+func (cfg Config) maxMoveLength(chessVariant string) int {
+	if length, ok := cfg.VariantMaxMoveLength[variantName(chessVariant)]; ok {
+		return length
+	}
+	return cfg.MaxMoveLength
+}
+
+// GameKeyspace is how many distinct game keys the configured alphabet and
+// length can produce
+func (cfg Config) GameKeyspace() float64 {
+	return math.Pow(float64(len([]rune(cfg.GameKeyAlphabet))), float64(cfg.GameKeyLength))
+}
+
+// minGameKeyspace keeps a guess hitting one of 100 live games, or a new key
+// colliding with one, below 1 in 10,000
+const minGameKeyspace = 1e6
+
+func (cfg Config) Validate() error {
+	var errs []error
+	if len([]rune(cfg.GameKeyAlphabet)) < 2 {
+		errs = append(errs, errors.New("game key alphabet needs at least 2 characters"))
+	}
+	if cfg.GameKeyLength <= 0 {
+		errs = append(errs, errors.New("game key length must be positive"))
+	} else if len([]rune(cfg.GameKeyAlphabet)) >= 2 && cfg.GameKeyspace() < minGameKeyspace {
+		errs = append(errs, fmt.Errorf("game key alphabet and length give %.0f keys, at least %.0f are needed", cfg.GameKeyspace(), float64(minGameKeyspace)))
+	}
+	if cfg.MaxSpectatorsPerGame < 0 {
+		errs = append(errs, errors.New("max spectators per game must not be negative"))
+	}
+	if cfg.MaxGamesPerIP < 0 {
+		errs = append(errs, errors.New("max games per IP must not be negative"))
+	}
+	// HS256 keys shorter than the hash are easy to brute force
+	if len(cfg.JWTSecret) > 0 && len(cfg.JWTSecret) < 32 {
+		errs = append(errs, errors.New("JWT secret must be at least 32 bytes"))
+	}
+	// Past the inactivity timeout the game would be purged before anyone
+	// was ruled to have abandoned it
+	if cfg.AbandonmentTimeout < 0 || cfg.AbandonmentTimeout >= cfg.InactivityTimeout {
+		errs = append(errs, errors.New("abandonment timeout must be shorter than the inactivity timeout"))
+	}
+	if cfg.CorrespondenceAbandonmentTimeout < 0 || cfg.CorrespondenceAbandonmentTimeout >= cfg.CorrespondenceInactivityTimeout {
+		errs = append(errs, errors.New("correspondence abandonment timeout must be shorter than the correspondence inactivity timeout"))
+	}
+	if cfg.GamesListRefresh <= 0 {
+		errs = append(errs, errors.New("games list refresh must be positive"))
+	}
+	return errors.Join(errs...)
+}
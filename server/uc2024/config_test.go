@@ -0,0 +1,64 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateGameKeyspace(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		length   int
+		wantErr  bool
+	}{
+		{"default", "abcdefghjkmnrstuvwxyz34678", 6, false},
+		{"exactly the minimum", "0123456789", 6, false},
+		{"one key short of the minimum", "0123456789", 5, true},
+		{"short default keys", "abcdefghjkmnrstuvwxyz34678", 4, true},
+		{"single character alphabet", "a", 30, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.GameKeyAlphabet = tt.alphabet
+			cfg.GameKeyLength = tt.length
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxMoveLengthBoundary(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  map[string]int
+		move    string
+		tooLong bool
+	}{
+		{"default limit", nil, strings.Repeat("x", 20), false},
+		{"one over the default", nil, strings.Repeat("x", 21), true},
+		{"variant limit", map[string]int{"Standard": 2}, "e4", false},
+		{"one over the variant limit", map[string]int{"Standard": 2}, "e4+", true},
+		{"other variant's limit", map[string]int{"Horde": 2}, "e4+", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, func(cfg *Config) {
+				cfg.VariantMaxMoveLength = tt.limits
+			})
+			gameKey, players := startTestGame(t, r, nil)
+
+			status, body := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {players[PlayerTeamWhite]}, "move": {tt.move}})
+			tooLong := status == http.StatusForbidden && body["code"] == ErrMoveTooLong.Code
+			if tooLong != tt.tooLong {
+				t.Errorf("move %q = %d %v, want too long %t", tt.move, status, body, tt.tooLong)
+			}
+		})
+	}
+}
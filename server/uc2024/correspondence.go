@@ -0,0 +1,259 @@
+package uc2024
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GameMode picks how long a game may sit idle and how long it may last
+// before it's purged
+type GameMode string
+
+const (
+	GameModeRealtime GameMode = "realtime"
+	// Moves can be days apart, these games are also kept in storage so a
+	// restart doesn't lose them
+	GameModeCorrespondence GameMode = "correspondence"
+)
+
+// gameMode reads the optional mode, realtime when left out
+func gameMode(c *gin.Context) (GameMode, bool) {
+	switch mode := GameMode(param(c, "mode")); mode {
+	case "":
+		return GameModeRealtime, true
+	case GameModeRealtime, GameModeCorrespondence:
+		return mode, true
+	}
+	return "", false
+}
+
+// timeouts gives how long the game may go without activity and how long it
+// may last in total
+func (game *ActiveGame) timeouts() (time.Duration, time.Duration) {
+	if game.mode == GameModeCorrespondence {
+		return config.CorrespondenceInactivityTimeout, config.CorrespondenceMaxGameDuration
+	}
+
+	inactivity := config.InactivityTimeout
+	if len(game.playerIps) < 2 {
+		inactivity = config.PreGameInactivityTimeout
+	}
+	return inactivity, config.MaxGameDuration
+}
+
+// StoredGame is what is kept of a correspondence game between restarts, and
+// of a realtime game over a graceful restart
+type StoredGame struct {
+	Key string `json:"key"`
+	// Missing from games stored before realtime games were, which were all
+	// correspondence games
+	Mode              GameMode                 `json:"mode,omitempty"`
+	Moves             []string                 `json:"moves"`
+	GameOver          bool                     `json:"game_over"`
+	Result            GameResult               `json:"result,omitempty"`
+	Termination       Termination              `json:"termination,omitempty"`
+	StartTime         time.Time                `json:"start_time"`
+	LastReceivedTime  time.Time                `json:"last_received_time"`
+	LastMoveTime      time.Time                `json:"last_move_time"`
+	MoveTimes         []time.Time              `json:"move_times,omitempty"`
+	ReadyTime         time.Time                `json:"ready_time"`
+	ClockMode         ClockMode                `json:"clock_mode,omitempty"`
+	MoveTimeLimit     time.Duration            `json:"move_time_limit,omitempty"`
+	TurnStarted       time.Time                `json:"turn_started"`
+	Players           map[string]PlayerTeam    `json:"players"`
+	Host              string                   `json:"host"`
+	ChessVariant      string                   `json:"chess_variant"`
+	SpectateTokens    []string                 `json:"spectate_tokens,omitempty"`
+	PasswordSalt      []byte                   `json:"password_salt,omitempty"`
+	PasswordHash      []byte                   `json:"password_hash,omitempty"`
+	Takebacks         TakebackPolicy           `json:"takebacks"`
+	TakebacksUsed     map[PlayerTeam]int       `json:"takebacks_used"`
+	TakebackRequested PlayerTeam               `json:"takeback_requested,omitempty"`
+	PlayerNames       map[PlayerTeam]string    `json:"player_names"`
+	Premoves          map[PlayerTeam]string    `json:"premoves,omitempty"`
+	FinalMove         *FinalMove               `json:"final_move,omitempty"`
+	LastHeartbeat     map[PlayerTeam]time.Time `json:"last_heartbeat,omitempty"`
+	Log               []GameLogEntry           `json:"log,omitempty"`
+}
+
+// stored copies the game so storage never sees it change after the fact
+func (game *ActiveGame) stored() StoredGame {
+	stored := StoredGame{
+		Key:               game.key,
+		Mode:              game.mode,
+		Moves:             slices.Clone(game.moves),
+		GameOver:          game.gameOver,
+		Result:            game.result,
+		Termination:       game.termination,
+		StartTime:         game.startTime,
+		LastReceivedTime:  game.lastReceivedTime,
+		LastMoveTime:      game.lastMoveTime,
+		MoveTimes:         slices.Clone(game.moveTimes),
+		ReadyTime:         game.readyTime,
+		ClockMode:         game.clockMode,
+		MoveTimeLimit:     game.moveTimeLimit,
+		TurnStarted:       game.turnStarted,
+		Players:           maps.Clone(game.playerIps),
+		Host:              game.host,
+		ChessVariant:      game.chessVariant,
+		Takebacks:         game.takebacks.policy,
+		TakebacksUsed:     maps.Clone(game.takebacks.used),
+		TakebackRequested: game.takebacks.requested,
+		PlayerNames:       maps.Clone(game.playerNames),
+		Premoves:          maps.Clone(game.premoves),
+		FinalMove:         game.finalMove,
+		LastHeartbeat:     maps.Clone(game.lastHeartbeat),
+		Log:               slices.Clone(game.log),
+	}
+	for token := range game.spectateTokens {
+		stored.SpectateTokens = append(stored.SpectateTokens, token)
+	}
+	if game.password != nil {
+		stored.PasswordSalt = game.password.salt
+		stored.PasswordHash = game.password.hash
+	}
+
+	return stored
+}
+
+func restoreGame(stored StoredGame) ActiveGame {
+	game := ActiveGame{
+		key:              stored.Key,
+		mode:             stored.Mode,
+		moves:            stored.Moves,
+		gameOver:         stored.GameOver,
+		result:           stored.Result,
+		termination:      stored.Termination,
+		startTime:        stored.StartTime,
+		lastReceivedTime: stored.LastReceivedTime,
+		lastMoveTime:     stored.LastMoveTime,
+		moveTimes:        stored.MoveTimes,
+		readyTime:        stored.ReadyTime,
+		clockMode:        stored.ClockMode,
+		moveTimeLimit:    stored.MoveTimeLimit,
+		turnStarted:      stored.TurnStarted,
+		playerIps:        stored.Players,
+		host:             stored.Host,
+		chessVariant:     stored.ChessVariant,
+		playerAddrs:      map[string]string{},
+		spectateTokens:   map[string]bool{},
+		takebacks: takebackState{
+			policy:    stored.Takebacks,
+			used:      stored.TakebacksUsed,
+			requested: stored.TakebackRequested,
+		},
+		playerNames:   stored.PlayerNames,
+		premoves:      stored.Premoves,
+		finalMove:     stored.FinalMove,
+		lastHeartbeat: stored.LastHeartbeat,
+		log:           stored.Log,
+	}
+	for _, token := range stored.SpectateTokens {
+		game.spectateTokens[token] = true
+	}
+	if len(stored.PasswordHash) > 0 {
+		game.password = &gamePassword{
+			salt: stored.PasswordSalt,
+			hash: stored.PasswordHash,
+		}
+	}
+
+	// Anything an older or hand edited file left out
+	if game.moves == nil {
+		game.moves = []string{}
+	}
+	if game.playerIps == nil {
+		game.playerIps = map[string]PlayerTeam{}
+	}
+	if game.takebacks.used == nil {
+		game.takebacks.used = map[PlayerTeam]int{}
+	}
+	if game.playerNames == nil {
+		game.playerNames = map[PlayerTeam]string{}
+	}
+	if game.premoves == nil {
+		game.premoves = map[PlayerTeam]string{}
+	}
+	if game.lastHeartbeat == nil {
+		game.lastHeartbeat = map[PlayerTeam]time.Time{}
+	}
+	if len(game.clockMode) == 0 {
+		game.clockMode = ClockModeNone
+	}
+	if len(game.mode) == 0 {
+		game.mode = GameModeCorrespondence
+	}
+
+	return game
+}
+
+// saveGame stores the game in activeGames, and in storage for correspondence
+// games. Must be called with accessLock held.
+func saveGame(game ActiveGame) {
+	activeGames[game.key] = game
+	if game.mode != GameModeCorrespondence {
+		return
+	}
+
+	if err := storage.SaveGame(game.stored()); err != nil {
+		logger.Error("saving game", "game_key", game.key, "error", err)
+	}
+}
+
+// removeGame must be called with accessLock held
+func removeGame(game *ActiveGame) {
+	delete(activeGames, game.key)
+	if game.mode != GameModeCorrespondence {
+		return
+	}
+
+	if err := storage.DeleteGame(game.key); err != nil {
+		logger.Error("deleting game", "game_key", game.key, "error", err)
+	}
+}
+
+// Flush writes every game, log included, to storage. Realtime games are only
+// stored here, so they survive a graceful restart but not a crash. Call it on
+// shutdown once no more requests are being served.
+func Flush() error {
+	accessLock.Lock()
+	defer accessLock.Unlock()
+
+	var errs []error
+	for _, game := range activeGames {
+		if err := storage.SaveGame(game.stored()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// restoreGames loads the games kept in storage. Realtime games flushed on
+// shutdown are taken back out, storage doesn't follow them once they're
+// running again and would restore them as they were at this restart.
+func restoreGames() error {
+	games, err := storage.LoadGames()
+	if err != nil {
+		return err
+	}
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	for _, stored := range games {
+		game := restoreGame(stored)
+		activeGames[stored.Key] = game
+		if game.mode == GameModeCorrespondence {
+			continue
+		}
+		if err := storage.DeleteGame(game.key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// logTypes gives the type of each entry in a game's log, under the lock
+func logTypes(gameKey string) ([]GameLogType, bool) {
+	accessLock.RLock()
+	defer accessLock.RUnlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		return nil, false
+	}
+
+	var types []GameLogType
+	for _, entry := range game.log {
+		types = append(types, entry.Type)
+	}
+	return types, true
+}
+
+// Realtime games are only written to storage on shutdown, and come back from
+// it once
+func TestFlushKeepsEveryGameLog(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "storage.json")
+	useStorage := func(cfg *Config) {
+		cfg.StorageFile = storageFile
+	}
+
+	r := newTestServer(t, useStorage)
+	realtime, players := startTestGame(t, r, nil)
+	playMoves(t, r, realtime, players, "e4", "e5")
+	correspondence, players := startTestGame(t, r, url.Values{"mode": {string(GameModeCorrespondence)}})
+	playMoves(t, r, correspondence, players, "d4")
+
+	want := map[string][]GameLogType{}
+	for _, gameKey := range []string{realtime, correspondence} {
+		want[gameKey], _ = logTypes(gameKey)
+		if len(want[gameKey]) == 0 {
+			t.Fatalf("%s has nothing in its log", gameKey)
+		}
+	}
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	newTestServer(t, useStorage)
+	for gameKey, wantTypes := range want {
+		types, ok := logTypes(gameKey)
+		if !ok {
+			t.Fatalf("%s wasn't restored", gameKey)
+		}
+		if !reflect.DeepEqual(types, wantTypes) {
+			t.Errorf("%s log = %v, want %v", gameKey, types, wantTypes)
+		}
+	}
+	accessLock.RLock()
+	mode := activeGames[realtime].mode
+	accessLock.RUnlock()
+	if mode != GameModeRealtime {
+		t.Errorf("realtime game restored as %s", mode)
+	}
+
+	// Restarting again without a flush only has the correspondence game
+	newTestServer(t, useStorage)
+	if _, ok := logTypes(realtime); ok {
+		t.Error("realtime game restored twice from one flush")
+	}
+	if _, ok := logTypes(correspondence); !ok {
+		t.Error("correspondence game lost")
+	}
+}
+
+func TestCorrespondenceRoundTrip(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "storage.json")
+	clock := newTestClock()
+	useStorage := func(cfg *Config) {
+		cfg.StorageFile = storageFile
+		cfg.Clock = clock
+	}
+
+	r := newTestServer(t, useStorage)
+	gameKey := createTestGame(t, r, "host", url.Values{
+		"mode":          {string(GameModeCorrespondence)},
+		"password":      {"secret"},
+		"player_name":   {"Hosty"},
+		"max_takebacks": {"2"},
+	})
+	status, body := call(t, r, http.MethodPost, "/join/"+gameKey, url.Values{"player_key": {"guest"}, "password": {"secret"}, "player_name": {"Guesty"}})
+	if status != http.StatusOK {
+		t.Fatalf("join: %d %v", status, body)
+	}
+	guestTeam := PlayerTeam(body["team"].(string))
+	players := map[PlayerTeam]string{guestTeam: "guest", guestTeam.opponent(): "host"}
+
+	if status, body := call(t, r, http.MethodPost, "/spectate-link/"+gameKey, url.Values{"player_key": {"host"}}); status != http.StatusOK {
+		t.Fatalf("spectate link: %d %v", status, body)
+	}
+	clock.advance(time.Hour)
+	playMoves(t, r, gameKey, players, "e4", "e5")
+	clock.advance(time.Hour)
+	playMoves(t, r, gameKey, players, "Nf3")
+	if status, body := call(t, r, http.MethodPost, "/takeback/"+gameKey, url.Values{"player_key": {players[PlayerTeamWhite]}}); status != http.StatusOK {
+		t.Fatalf("takeback request: %d %v", status, body)
+	}
+	if status, body := call(t, r, http.MethodPost, "/premove/"+gameKey, url.Values{"player_key": {players[PlayerTeamWhite]}, "move": {"Bc4"}}); status != http.StatusOK {
+		t.Fatalf("premove: %d %v", status, body)
+	}
+
+	accessLock.RLock()
+	played := activeGames[gameKey]
+	accessLock.RUnlock()
+	want := played.stored()
+
+	// Restarting without a flush, correspondence games are saved as they go
+	newTestServer(t, useStorage)
+	accessLock.RLock()
+	game, ok := activeGames[gameKey]
+	accessLock.RUnlock()
+	if !ok {
+		t.Fatal("correspondence game wasn't restored")
+	}
+	if got := game.stored(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored game = %+v\nwant %+v", got, want)
+	}
+
+	// And it plays on from where it was
+	playMoves(t, r, gameKey, players, "Nc6")
+	_, body = call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if got, wantMoves := gameMoves(body), []any{"e4", "e5", "Nf3", "Nc6", "Bc4"}; !reflect.DeepEqual(got, wantMoves) {
+		t.Errorf("moves after restore = %v, want %v", got, wantMoves)
+	}
+}
@@ -0,0 +1,229 @@
+package uc2024
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+// Drops are written as the piece letter, an @ and the square, such as N@f3.
+// A pawn may leave out its letter, @e4 is the same as P@e4.
+var dropGrammar = regexp.MustCompile(`^[PNBRQ]@[a-h][1-8][+#]?$`)
+
+// Pocket counts the captured pieces a side holds, keyed by upper case
+// letter
+type Pocket map[string]int
+
+// dropVariant is a variant where captured pieces can be dropped back onto
+// the board
+type dropVariant interface {
+	Variant
+	// Pockets replays the moves to find what each side holds, nil when the
+	// moves can't be followed
+	Pockets(chessVariant string, moves []string) map[PlayerTeam]Pocket
+}
+
+// normalizeDrop fixes the casing of a drop. It is false when the move isn't
+// a drop or the variant doesn't allow them.
+func normalizeDrop(chessVariant string, move string) (string, bool) {
+	if _, ok := variantRules(chessVariant).(dropVariant); !ok {
+		return "", false
+	}
+
+	piece, square, ok := strings.Cut(move, "@")
+	if !ok {
+		return "", false
+	}
+	if len(piece) == 0 {
+		piece = "P"
+	}
+
+	drop := strings.ToUpper(piece) + "@" + strings.ToLower(square)
+	if !dropGrammar.MatchString(drop) {
+		return "", false
+	}
+	return drop, true
+}
+
+// parseDrop splits a normalized drop into its piece letter and square
+func parseDrop(move string) (string, pgn.Position, bool) {
+	if !dropGrammar.MatchString(move) {
+		return "", pgn.NoPosition, false
+	}
+	square, err := pgn.ParsePosition(move[2:4])
+	if err != nil {
+		return "", pgn.NoPosition, false
+	}
+	return move[:1], square, true
+}
+
+// dropPiece is the board piece for a pocket letter, pgn uses upper case for
+// white and lower case for black
+func dropPiece(piece string, color pgn.Color) pgn.Piece {
+	if color == pgn.Black {
+		piece = strings.ToLower(piece)
+	}
+	return pgn.Piece(piece[0])
+}
+
+// checkDrop is everything about a drop but the pocket. The square has to be
+// empty, pawns can't go on the first or last rank and the drop can't leave
+// the dropper's own king in check.
+func checkDrop(board *pgn.Board, piece string, square pgn.Position, team PlayerTeam) error {
+	if board.GetPiece(square) != pgn.NoPiece {
+		return errIllegalMove
+	}
+	if rank := square.GetRank(); piece == "P" && (rank == pgn.Rank1 || rank == pgn.Rank8) {
+		return errIllegalMove
+	}
+
+	next := *board
+	next.SetPiece(square, dropPiece(piece, teamColor(team)))
+	if inCheck(&next, teamColor(team)) {
+		return errIllegalMove
+	}
+	return nil
+}
+
+// playDrop puts the piece on the board and passes the turn. pgn only passes
+// the turn for its own moves, so the board is rebuilt from its FEN with the
+// other side to move and no en passant square.
+func playDrop(board *pgn.Board, piece string, square pgn.Position, team PlayerTeam) error {
+	color := teamColor(team)
+	next := *board
+	next.SetPiece(square, dropPiece(piece, color))
+
+	fen := pgn.FENFromBoard(&next)
+	fen.ToMove = opponentColor(color)
+	fen.EnPassantVulnerable = pgn.NoPosition
+	fen.HalfmoveClock++
+	if color == pgn.Black {
+		fen.Fullmove++
+	}
+
+	rebuilt, err := pgn.NewBoardFEN(fen.String())
+	if err != nil {
+		return err
+	}
+	*board = *rebuilt
+	return nil
+}
+
+// dropMoves lists the drops color can make from the pocket
+func dropMoves(board *pgn.Board, pocket Pocket, team PlayerTeam) []string {
+	var drops []string
+	for _, piece := range []string{"P", "N", "B", "R", "Q"} {
+		if pocket[piece] <= 0 {
+			continue
+		}
+		for file := 0; file < 8; file++ {
+			for rank := 0; rank < 8; rank++ {
+				square := squareAt(file, rank)
+				if checkDrop(board, piece, square, team) == nil {
+					drops = append(drops, piece+"@"+square.String())
+				}
+			}
+		}
+	}
+	return drops
+}
+
+// crazyhouseVariant is standard chess where captured pieces change sides
+// and can be dropped instead of moving. Promoted pieces go back to being
+// pawns when they are captured.
+type crazyhouseVariant struct {
+	standardVariant
+}
+
+// LegalMoves adds the drops team's pocket allows to the standard moves
+func (v crazyhouseVariant) LegalMoves(game *ActiveGame, board *pgn.Board, team PlayerTeam) []LegalMove {
+	moves := standardMoves(game, board, team)
+	pockets := v.Pockets(game.chessVariant, game.moves)
+	for _, drop := range dropMoves(board, pockets[team], team) {
+		moves = append(moves, LegalMove{
+			SAN: drop + checkSuffix(game, board, drop, team),
+			To:  drop[2:],
+			UCI: drop,
+		})
+	}
+	return moves
+}
+
+func (v crazyhouseVariant) PlayMove(board *pgn.Board, move string, team PlayerTeam) error {
+	if piece, square, ok := parseDrop(move); ok {
+		return playDrop(board, piece, square, team)
+	}
+	return v.standardVariant.PlayMove(board, move, team)
+}
+
+// CheckTermination only looks for mate and stalemate, material that's off
+// the board can always come back so it is never insufficient. A side with a
+// drop to make isn't out of moves.
+func (v crazyhouseVariant) CheckTermination(game *ActiveGame, board *pgn.Board) (GameResult, Termination, bool) {
+	team := moveTeam(len(game.moves))
+	pockets := v.Pockets(game.chessVariant, game.moves)
+	if len(dropMoves(board, pockets[team], team)) > 0 {
+		return "", "", false
+	}
+	return noMovesOutcome(game, board, team)
+}
+
+func (v crazyhouseVariant) Pockets(chessVariant string, moves []string) map[PlayerTeam]Pocket {
+	board, err := pgn.NewBoardFEN(v.InitialFEN(chessVariant))
+	if err != nil {
+		return nil
+	}
+
+	pockets := map[PlayerTeam]Pocket{
+		PlayerTeamWhite: {},
+		PlayerTeamBlack: {},
+	}
+	// Squares holding a piece that started out as a pawn
+	promoted := map[pgn.Position]bool{}
+
+	for i, move := range moves {
+		team := moveTeam(i)
+		if piece, square, ok := parseDrop(move); ok {
+			pockets[team][piece]--
+			if pockets[team][piece] <= 0 {
+				delete(pockets[team], piece)
+			}
+			if err := playDrop(board, piece, square, team); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		parsed, err := board.MoveFromAlgebraic(move, teamColor(team))
+		if err != nil {
+			return nil
+		}
+
+		captured := board.GetPiece(parsed.To)
+		if captured == pgn.NoPiece && pieceKind(board.GetPiece(parsed.From)) == 'p' && parsed.From.GetFile() != parsed.To.GetFile() {
+			// En passant, the pawn taken isn't on the target square
+			captured = dropPiece("P", teamColor(team.opponent()))
+		}
+		if captured != pgn.NoPiece {
+			piece := strings.ToUpper(string(pieceKind(captured)))
+			if promoted[parsed.To] {
+				piece = "P"
+			}
+			pockets[team][piece]++
+		}
+
+		wasPromoted := promoted[parsed.From]
+		delete(promoted, parsed.From)
+		delete(promoted, parsed.To)
+		if wasPromoted || parsed.Promote != pgn.NoPiece {
+			promoted[parsed.To] = true
+		}
+
+		if err := board.MakeMove(parsed); err != nil {
+			return nil
+		}
+	}
+
+	return pockets
+}
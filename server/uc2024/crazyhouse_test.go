@@ -0,0 +1,98 @@
+package uc2024
+
+import (
+	"testing"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+func TestNormalizeDrop(t *testing.T) {
+	tests := []struct {
+		chessVariant string
+		move         string
+		want         string
+		ok           bool
+	}{
+		{"Crazyhouse", "P@e4", "P@e4", true},
+		{"Crazyhouse", "p@e4", "P@e4", true},
+		{"Crazyhouse", "@e4", "P@e4", true},
+		{"Crazyhouse", "n@F3", "N@f3", true},
+		{"Crazyhouse", "Q@h8+", "Q@h8+", true},
+		{"Crazyhouse", "Q@a9", "", false},
+		{"Crazyhouse", "Q@i1", "", false},
+		{"Crazyhouse", "K@e4", "", false},
+		{"Crazyhouse", "NB@e4", "", false},
+		{"Crazyhouse", "N@", "", false},
+		{"Crazyhouse", "Nf3", "", false},
+		{"Standard", "P@e4", "", false},
+		{"Horde", "P@e4", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := normalizeDrop(tt.chessVariant, tt.move)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeDrop(%s, %q) = %q, %t, want %q, %t", tt.chessVariant, tt.move, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseDrop(t *testing.T) {
+	tests := []struct {
+		move      string
+		wantPiece string
+		wantSq    string
+		ok        bool
+	}{
+		{"P@e4", "P", "e4", true},
+		{"N@f3+", "N", "f3", true},
+		// Grammar alone allows pawns on the back ranks, checkDrop refuses them
+		{"P@a1", "P", "a1", true},
+		{"p@e4", "", "", false},
+		{"K@e4", "", "", false},
+		{"@e4", "", "", false},
+	}
+
+	for _, tt := range tests {
+		piece, square, ok := parseDrop(tt.move)
+		if ok != tt.ok || piece != tt.wantPiece {
+			t.Errorf("parseDrop(%q) = %q, %v, %t, want %q, %s, %t", tt.move, piece, square, ok, tt.wantPiece, tt.wantSq, tt.ok)
+			continue
+		}
+		if ok && square.String() != tt.wantSq {
+			t.Errorf("parseDrop(%q) square = %s, want %s", tt.move, square, tt.wantSq)
+		}
+	}
+}
+
+func TestCheckDropRanks(t *testing.T) {
+	board, err := pgn.NewBoardFEN("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		move  string
+		team  PlayerTeam
+		legal bool
+	}{
+		{"P@a1", PlayerTeamWhite, false},
+		{"P@a8", PlayerTeamWhite, false},
+		{"P@h1", PlayerTeamBlack, false},
+		{"P@h8", PlayerTeamBlack, false},
+		{"P@a2", PlayerTeamWhite, true},
+		{"P@a7", PlayerTeamBlack, true},
+		{"N@a1", PlayerTeamWhite, true},
+		{"R@a8", PlayerTeamBlack, true},
+		{"Q@e1", PlayerTeamWhite, false},
+	}
+
+	for _, tt := range tests {
+		piece, square, ok := parseDrop(tt.move)
+		if !ok {
+			t.Fatalf("parseDrop(%q) failed", tt.move)
+		}
+		if err := checkDrop(board, piece, square, tt.team); (err == nil) != tt.legal {
+			t.Errorf("checkDrop(%s) for %s = %v, want legal %t", tt.move, tt.team, err, tt.legal)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package uc2024
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIError is the body of every error response. Code is stable for clients
+// to switch on, Message is kept under "error" for older clients that only
+// display it.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"error"`
+	// Set on game over errors so clients can show how the game ended
+	Result      GameResult  `json:"result,omitempty"`
+	Termination Termination `json:"termination,omitempty"`
+	// Set on invalid variant errors so clients can reconcile their list
+	SupportedVariants []string `json:"supported_variants,omitempty"`
+	// Set on import errors to point at the first move that was turned away
+	MoveNumber int    `json:"move_number,omitempty"`
+	Move       string `json:"move,omitempty"`
+}
+
+var (
+	ErrGameNotFound          = APIError{Code: "game_not_found", Message: "game not found"}
+	ErrGameFull              = APIError{Code: "game_full", Message: "game already full"}
+	ErrHostJoin              = APIError{Code: "host_join", Message: "the host can't join their own game"}
+	ErrGameNotReady          = APIError{Code: "game_not_ready", Message: "waiting for an opponent to join"}
+	ErrNoHostTeam            = APIError{Code: "no_host_team", Message: "game has no host, create a new one"}
+	ErrGameOver              = APIError{Code: "game_over", Message: "game already over"}
+	ErrGameExpired           = APIError{Code: "game_expired", Message: "game expired"}
+	ErrInvalidMove           = APIError{Code: "invalid_move", Message: "move is not valid algebraic notation"}
+	ErrInvalidMoveIndex      = APIError{Code: "invalid_move_index", Message: "move index must be a number"}
+	ErrMoveNotFound          = APIError{Code: "move_not_found", Message: "no move at that index"}
+	ErrInvalidSquare         = APIError{Code: "invalid_square", Message: "from must be a square such as e2"}
+	ErrPositionUnknown       = APIError{Code: "position_unknown", Message: "the server can't follow the position in this variant"}
+	ErrIllegalMove           = APIError{Code: "illegal_move", Message: "move is not legal in this position"}
+	ErrMoveTooLong           = APIError{Code: "move_too_long", Message: "move too long"}
+	ErrPremoveOnTurn         = APIError{Code: "premove_on_turn", Message: "it's your turn, send a move instead"}
+	ErrPlayerKeyEmpty        = APIError{Code: "player_key_empty", Message: "player key is required"}
+	ErrPlayerKeyTooLong      = APIError{Code: "player_key_too_long", Message: "player key is too long"}
+	ErrInvalidPlayerKey      = APIError{Code: "invalid_player_key", Message: "player key has invalid characters"}
+	ErrInvalidPlayerName     = APIError{Code: "invalid_player_name", Message: "player name too long"}
+	ErrInvalidVariant        = APIError{Code: "invalid_chess_variant", Message: "invalid chess variant"}
+	ErrTooManyGames          = APIError{Code: "too_many_games", Message: "too many active games"}
+	ErrTooManyGamesForIP     = APIError{Code: "too_many_games_for_ip", Message: "too many active games from this address"}
+	ErrNoGameKey             = APIError{Code: "no_game_key", Message: "no free game key, try again"}
+	ErrUnsupportedVariant    = APIError{Code: "unsupported_chess_variant", Message: "chess variant not supported by client"}
+	ErrWrongPassword         = APIError{Code: "wrong_password", Message: "wrong or missing game password"}
+	ErrInvalidGameMode       = APIError{Code: "invalid_game_mode", Message: "mode must be realtime or correspondence"}
+	ErrInvalidMoveTimeLimit  = APIError{Code: "invalid_move_time_limit", Message: "move_time_limit must be a whole number of seconds, or clock_mode increment with a positive clock_increment instead"}
+	ErrInvalidTakebackPolicy = APIError{Code: "invalid_takeback_policy", Message: "allow_takebacks must be a bool and max_takebacks a non-negative number"}
+	ErrNoTakebacks           = APIError{Code: "no_takebacks", Message: "no takebacks left"}
+	ErrNothingToTakeBack     = APIError{Code: "nothing_to_take_back", Message: "no move to take back"}
+	ErrNoTakebackPending     = APIError{Code: "no_takeback_pending", Message: "opponent hasn't asked for a takeback"}
+	ErrNotSeated             = APIError{Code: "not_seated", Message: "player is not seated in this game"}
+	ErrNotYourTurn           = APIError{Code: "not_your_turn", Message: "it's the other side's move"}
+	ErrNotSubscriber         = APIError{Code: "not_subscriber", Message: "a seated player key or spectate token is needed"}
+	ErrNotHost               = APIError{Code: "not_host", Message: "only the host can do that"}
+	ErrSpectatorMove         = APIError{Code: "spectator_move", Message: "spectators can't make moves"}
+	ErrSeekNotFound          = APIError{Code: "seek_not_found", Message: "no active seek"}
+	ErrStorage               = APIError{Code: "storage_error", Message: "storage unavailable"}
+	ErrSpectatorLimit        = APIError{Code: "spectator_limit", Message: "spectator limit reached"}
+	ErrTooManyLookups        = APIError{Code: "too_many_lookups", Message: "too many failed lookups, try again later"}
+	ErrInvalidBody           = APIError{Code: "invalid_body", Message: "body must be a JSON object of parameters"}
+	ErrEmptyImport           = APIError{Code: "empty_import", Message: "pgn must hold at least one move"}
+	ErrImportTooLong         = APIError{Code: "import_too_long", Message: "pgn has more moves than a game may"}
+	ErrImportedGameOver      = APIError{Code: "imported_game_over", Message: "pgn moves end the game, there is nothing left to play"}
+	ErrTokenRequired         = APIError{Code: "token_required", Message: "a bearer token is required"}
+	ErrInvalidToken          = APIError{Code: "invalid_token", Message: "bearer token is malformed or not signed by this server"}
+	ErrTokenExpired          = APIError{Code: "token_expired", Message: "bearer token has expired"}
+)
+
+func gameOverError(game *ActiveGame) APIError {
+	err := ErrGameOver
+	err.Result = game.result
+	err.Termination = game.termination
+	return err
+}
+
+func invalidVariantError() APIError {
+	err := ErrInvalidVariant
+	err.SupportedVariants = SupportedVariants
+	return err
+}
+
+func respondError(c *gin.Context, status int, err APIError) {
+	c.Set(logErrorCode, err.Code)
+	c.JSON(status, err)
+}
+
+func badRequest(c *gin.Context, err APIError) {
+	respondError(c, http.StatusBadRequest, err)
+}
+
+func unauthorized(c *gin.Context, err APIError) {
+	respondError(c, http.StatusUnauthorized, err)
+}
+
+func forbidden(c *gin.Context, err APIError) {
+	respondError(c, http.StatusForbidden, err)
+}
+
+func notFound(c *gin.Context, err APIError) {
+	respondError(c, http.StatusNotFound, err)
+}
+
+func conflict(c *gin.Context, err APIError) {
+	respondError(c, http.StatusConflict, err)
+}
+
+func tooManyRequests(c *gin.Context, err APIError) {
+	respondError(c, http.StatusTooManyRequests, err)
+}
+
+func serviceUnavailable(c *gin.Context, err APIError) {
+	respondError(c, http.StatusServiceUnavailable, err)
+}
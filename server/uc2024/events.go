@@ -0,0 +1,194 @@
+package uc2024
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type EventType string
+
+const (
+	EventMove     EventType = "move"
+	EventGameOver EventType = "game_over"
+	// Sent to the side to move shortly before an idle game is purged or
+	// they lose it by abandonment, and cancelled once they move
+	EventInactivityWarning   EventType = "inactivity_warning"
+	EventInactivityCancelled EventType = "inactivity_warning_cancelled"
+	// Sent to the host when the second player sits down, Team is the
+	// joiner's
+	EventOpponentJoined EventType = "opponent_joined"
+)
+
+// Event is a frame pushed to everyone subscribed to a game
+type Event struct {
+	Type        EventType   `json:"type"`
+	GameKey     string      `json:"game_key"`
+	Move        string      `json:"move,omitempty"`
+	MoveNumber  int         `json:"move_number,omitempty"`
+	Team        PlayerTeam  `json:"team,omitempty"`
+	Result      GameResult  `json:"result,omitempty"`
+	Termination Termination `json:"termination,omitempty"`
+	FinalMove   *FinalMove  `json:"final_move,omitempty"`
+	// Seconds left before the game is purged or abandoned
+	ExpiresIn float64 `json:"expires_in,omitempty"`
+}
+
+type subscriber struct {
+	conn *websocket.Conn
+	send chan []byte
+	team PlayerTeam
+}
+
+// subscribers are keyed by game key. They have their own lock since events
+// are published while accessLock is held.
+var subscribersLock *sync.Mutex = &sync.Mutex{}
+var subscribers map[string]map[*subscriber]bool = make(map[string]map[*subscriber]bool)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// publish queues the event for every subscriber of the game. Subscribers
+// too slow to keep up are dropped rather than holding up the game.
+func publish(event Event) {
+	publishTo(event, "")
+}
+
+// publishTo only sends to the player seated as team, or everyone when team
+// is empty
+func publishTo(event Event, team PlayerTeam) {
+	frame, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("encoding event", "error", err)
+		return
+	}
+
+	subscribersLock.Lock()
+	defer subscribersLock.Unlock()
+	for sub := range subscribers[event.GameKey] {
+		if len(team) > 0 && sub.team != team {
+			continue
+		}
+
+		select {
+		case sub.send <- frame:
+		default:
+			removeSubscriber(event.GameKey, sub)
+		}
+	}
+}
+
+// spectatorCount is how many of the game's subscribers aren't seated. Must
+// be called with subscribersLock held.
+func spectatorCount(gameKey string) int {
+	count := 0
+	for sub := range subscribers[gameKey] {
+		if len(sub.team) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// removeSubscriber must be called with subscribersLock held
+func removeSubscriber(gameKey string, sub *subscriber) {
+	if _, ok := subscribers[gameKey][sub]; !ok {
+		return
+	}
+
+	delete(subscribers[gameKey], sub)
+	if len(subscribers[gameKey]) == 0 {
+		delete(subscribers, gameKey)
+	}
+	close(sub.send)
+}
+
+func (sub *subscriber) writeLoop() {
+	defer sub.conn.Close()
+	for frame := range sub.send {
+		sub.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := sub.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+			return
+		}
+	}
+	sub.conn.WriteMessage(websocket.CloseMessage, []byte{})
+}
+
+// readLoop only exists to notice the client going away
+func (sub *subscriber) readLoop(gameKey string) {
+	defer func() {
+		subscribersLock.Lock()
+		removeSubscriber(gameKey, sub)
+		subscribersLock.Unlock()
+	}()
+
+	for {
+		if _, _, err := sub.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// getSubscribe upgrades to a WebSocket that receives the game's events.
+// Either a seated player_key or a spectate_token is needed.
+func getSubscribe(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		accessLock.Unlock()
+		return
+	}
+
+	team, seated := game.playerIps[getPlayerKey(c)]
+	if !seated && !game.isSpectator(param(c, "spectate_token")) {
+		accessLock.Unlock()
+		forbidden(c, ErrNotSubscriber)
+		return
+	}
+	accessLock.Unlock()
+
+	sub := &subscriber{
+		send: make(chan []byte, 16),
+		team: team,
+	}
+
+	// The spot is taken before upgrading so spectators connecting at the
+	// same time can't overshoot the cap
+	subscribersLock.Lock()
+	if !seated && config.MaxSpectatorsPerGame > 0 && spectatorCount(gameKey) >= config.MaxSpectatorsPerGame {
+		subscribersLock.Unlock()
+		serviceUnavailable(c, ErrSpectatorLimit)
+		return
+	}
+	if subscribers[gameKey] == nil {
+		subscribers[gameKey] = map[*subscriber]bool{}
+	}
+	subscribers[gameKey][sub] = true
+	subscribersLock.Unlock()
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written the error response
+		subscribersLock.Lock()
+		removeSubscriber(gameKey, sub)
+		subscribersLock.Unlock()
+		return
+	}
+	sub.conn = conn
+
+	go sub.writeLoop()
+	sub.readLoop(gameKey)
+}
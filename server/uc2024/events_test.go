@@ -0,0 +1,119 @@
+package uc2024
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// subscribe opens a WebSocket to the game's events as playerKey
+func subscribe(t *testing.T, server *httptest.Server, gameKey string, playerKey string) *websocket.Conn {
+	t.Helper()
+	target := "ws" + strings.TrimPrefix(server.URL, "http") + "/uc2024/subscribe/" + gameKey + "?" + url.Values{"player_key": {playerKey}}.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(target, nil)
+	if err != nil {
+		t.Fatalf("subscribe as %s: %v", playerKey, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// nextEvent reads frames until one of the wanted type arrives
+func nextEvent(t *testing.T, conn *websocket.Conn, eventType EventType) Event {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var event Event
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("waiting for %s: %v", eventType, err)
+		}
+		if event.Type == eventType {
+			return event
+		}
+	}
+}
+
+func TestGameOverPushedToEverySubscriber(t *testing.T) {
+	r := newTestServer(t, nil)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	gameKey, players := startTestGame(t, r, nil)
+	conns := map[PlayerTeam]*websocket.Conn{}
+	for team, playerKey := range players {
+		conns[team] = subscribe(t, server, gameKey, playerKey)
+	}
+
+	status, body := call(t, r, http.MethodPost, "/resign/"+gameKey, url.Values{"player_key": {players[PlayerTeamWhite]}})
+	if status != http.StatusOK {
+		t.Fatalf("resign: %d %v", status, body)
+	}
+
+	for team, conn := range conns {
+		event := nextEvent(t, conn, EventGameOver)
+		if event.GameKey != gameKey || event.Result != GameResult(PlayerTeamBlack) || event.Termination != TerminationResign {
+			t.Errorf("%s got %+v, want black winning by resignation", team, event)
+		}
+	}
+}
+
+func TestOpponentJoinedPushedToHost(t *testing.T) {
+	r := newTestServer(t, nil)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	gameKey := createTestGame(t, r, "host", nil)
+	conn := subscribe(t, server, gameKey, "host")
+
+	status, body := call(t, r, http.MethodPost, "/join/"+gameKey, url.Values{"player_key": {"guest"}})
+	if status != http.StatusOK {
+		t.Fatalf("join: %d %v", status, body)
+	}
+
+	event := nextEvent(t, conn, EventOpponentJoined)
+	if event.GameKey != gameKey || string(event.Team) != body["team"] {
+		t.Errorf("joined event = %+v, want the guest's team %v", event, body["team"])
+	}
+}
+
+func TestSpectatorCap(t *testing.T) {
+	r := newTestServer(t, func(cfg *Config) {
+		cfg.MaxSpectatorsPerGame = 1
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	gameKey, players := startTestGame(t, r, nil)
+	status, body := call(t, r, http.MethodPost, "/spectate-link/"+gameKey, url.Values{"player_key": {"host"}})
+	if status != http.StatusOK {
+		t.Fatalf("spectate link: %d %v", status, body)
+	}
+	token := body["spectate_token"].(string)
+	target := "ws" + strings.TrimPrefix(server.URL, "http") + "/uc2024/subscribe/" + gameKey + "?" + url.Values{"spectate_token": {token}}.Encode()
+
+	first, _, err := websocket.DefaultDialer.Dial(target, nil)
+	if err != nil {
+		t.Fatalf("first spectator: %v", err)
+	}
+	defer first.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(target, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("second spectator = %v %v, want %d", resp, err, http.StatusServiceUnavailable)
+	}
+	var rejected APIError
+	if err := json.NewDecoder(resp.Body).Decode(&rejected); err != nil || rejected.Code != ErrSpectatorLimit.Code {
+		t.Errorf("second spectator error = %+v %v, want %s", rejected, err, ErrSpectatorLimit.Code)
+	}
+
+	// Players don't take spectator spots
+	for _, playerKey := range players {
+		subscribe(t, server, gameKey, playerKey)
+	}
+}
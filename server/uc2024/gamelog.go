@@ -0,0 +1,72 @@
+package uc2024
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GameLogType is what happened in a game log entry
+type GameLogType string
+
+const (
+	GameLogCreated           GameLogType = "created"
+	GameLogJoined            GameLogType = "joined"
+	GameLogMove              GameLogType = "move"
+	GameLogTakebackRequested GameLogType = "takeback_requested"
+	GameLogTakebackAccepted  GameLogType = "takeback_accepted"
+	GameLogTakebackDeclined  GameLogType = "takeback_declined"
+	GameLogPremoveDiscarded  GameLogType = "premove_discarded"
+	GameLogGameOver          GameLogType = "game_over"
+	// The game was created from a PGN, MoveNumber is how many moves it
+	// started with
+	GameLogImported GameLogType = "imported"
+)
+
+// GameLogEntry is one thing the server did to a game. The log is what the
+// server actually processed, for when a player reports a move vanished.
+type GameLogEntry struct {
+	Time        time.Time   `json:"time"`
+	Type        GameLogType `json:"type"`
+	Team        PlayerTeam  `json:"team,omitempty"`
+	Move        string      `json:"move,omitempty"`
+	MoveNumber  int         `json:"move_number,omitempty"`
+	Result      GameResult  `json:"result,omitempty"`
+	Termination Termination `json:"termination,omitempty"`
+}
+
+// record appends to the game's log, dropping the oldest entries past
+// config.GameLogSize
+func (game *ActiveGame) record(entry GameLogEntry) {
+	if config.GameLogSize <= 0 {
+		return
+	}
+
+	entry.Time = now()
+	game.log = append(game.log, entry)
+	if over := len(game.log) - config.GameLogSize; over > 0 {
+		game.log = append([]GameLogEntry{}, game.log[over:]...)
+	}
+}
+
+func getAdminGameLog(c *gin.Context) {
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		notFound(c, ErrGameNotFound)
+		return
+	}
+
+	log := game.log
+	if log == nil {
+		log = []GameLogEntry{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"key": gameKey,
+		"log": log,
+	})
+}
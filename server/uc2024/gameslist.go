@@ -0,0 +1,99 @@
+package uc2024
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GameSummary is the lobby view of a game, nothing in it identifies the
+// players
+type GameSummary struct {
+	GameKey      string   `json:"game_key"`
+	ChessVariant string   `json:"chess_variant"`
+	Mode         GameMode `json:"mode"`
+	MoveCount    int      `json:"move_count"`
+	// Seconds since the game was created
+	Elapsed      float64 `json:"elapsed"`
+	Spectators   int     `json:"spectators"`
+	GameReady    bool    `json:"game_ready"`
+	GameComplete bool    `json:"game_complete"`
+}
+
+// The games list is rebuilt in the background every config.GamesListRefresh
+// so serving it never waits on accessLock
+var gamesListLock *sync.RWMutex = &sync.RWMutex{}
+var gamesList []GameSummary = []GameSummary{}
+var gamesListTaken time.Time
+
+// spectatorCounts must be called with subscribersLock held
+func spectatorCounts() map[string]int {
+	counts := map[string]int{}
+	for gameKey := range subscribers {
+		counts[gameKey] = spectatorCount(gameKey)
+	}
+	return counts
+}
+
+// refreshGamesList lists every game without a password, newest first
+func refreshGamesList() {
+	subscribersLock.Lock()
+	spectators := spectatorCounts()
+	subscribersLock.Unlock()
+
+	accessLock.Lock()
+	taken := now()
+	games := make([]GameSummary, 0, len(activeGames))
+	for key, game := range activeGames {
+		if game.password != nil {
+			continue
+		}
+
+		games = append(games, GameSummary{
+			GameKey:      key,
+			ChessVariant: game.chessVariant,
+			Mode:         game.mode,
+			MoveCount:    len(game.moves),
+			Elapsed:      taken.Sub(game.startTime).Seconds(),
+			Spectators:   spectators[key],
+			GameReady:    len(game.playerIps) == 2,
+			GameComplete: game.gameOver,
+		})
+	}
+	accessLock.Unlock()
+
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].Elapsed < games[j].Elapsed
+	})
+
+	gamesListLock.Lock()
+	gamesList = games
+	gamesListTaken = taken
+	gamesListLock.Unlock()
+}
+
+func refreshGamesListLoop() {
+	for {
+		refreshGamesList()
+
+		accessLock.RLock()
+		refresh := config.GamesListRefresh
+		accessLock.RUnlock()
+		time.Sleep(refresh)
+	}
+}
+
+// getGames serves the last snapshot, as_of says how stale it is
+func getGames(c *gin.Context) {
+	gamesListLock.RLock()
+	games, taken := gamesList, gamesListTaken
+	gamesListLock.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"games": games,
+		"as_of": taken.UTC().Format(time.RFC3339),
+	})
+}
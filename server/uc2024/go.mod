@@ -2,6 +2,11 @@ module github.com/sardap/ultimate-chess-2024/server/uc2024
 
 go 1.21.1
 
+require (
+	github.com/gorilla/websocket v1.5.0
+	gopkg.in/freeeve/pgn.v1 v1.0.1
+)
+
 require (
 	github.com/bytedance/sonic v1.9.1 // indirect
 	github.com/chenzhuoyu/base64x v0.0.0-20221115062448-fe3a3abad311 // indirect
@@ -0,0 +1,38 @@
+package uc2024
+
+import "github.com/gin-gonic/gin"
+
+// idempotentResponse remembers what a move request was answered with so a
+// retried request gets the same answer instead of playing the move twice
+type idempotentResponse struct {
+	key      string
+	response gin.H
+}
+
+func (game *ActiveGame) idempotentResponse(key string) (gin.H, bool) {
+	if len(key) == 0 {
+		return nil, false
+	}
+
+	for _, seen := range game.idempotency {
+		if seen.key == key {
+			return seen.response, true
+		}
+	}
+	return nil, false
+}
+
+// rememberResponse keeps only the most recent keys per game
+func (game *ActiveGame) rememberResponse(key string, response gin.H) {
+	if len(key) == 0 || config.IdempotencyKeys <= 0 {
+		return
+	}
+
+	game.idempotency = append(game.idempotency, idempotentResponse{
+		key:      key,
+		response: response,
+	})
+	if over := len(game.idempotency) - config.IdempotencyKeys; over > 0 {
+		game.idempotency = append([]idempotentResponse{}, game.idempotency[over:]...)
+	}
+}
@@ -0,0 +1,65 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRetriedMoveIsPlayedOnce(t *testing.T) {
+	type post struct {
+		team PlayerTeam
+		move string
+		key  string
+	}
+	tests := []struct {
+		name      string
+		posts     []post
+		wantMoves []any
+	}{
+		{
+			name:      "retried with the same key",
+			posts:     []post{{PlayerTeamWhite, "e4", "retry-1"}, {PlayerTeamWhite, "e4", "retry-1"}},
+			wantMoves: []any{"e4"},
+		},
+		{
+			name:      "retried after the opponent moved",
+			posts:     []post{{PlayerTeamWhite, "e4", "retry-1"}, {PlayerTeamBlack, "e5", "retry-2"}, {PlayerTeamWhite, "e4", "retry-1"}},
+			wantMoves: []any{"e4", "e5"},
+		},
+		{
+			name:      "new keys are new moves",
+			posts:     []post{{PlayerTeamWhite, "e4", "retry-1"}, {PlayerTeamBlack, "e5", "retry-2"}, {PlayerTeamWhite, "Nf3", "retry-3"}},
+			wantMoves: []any{"e4", "e5", "Nf3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+			gameKey, players := startTestGame(t, r, nil)
+
+			responses := map[string]map[string]any{}
+			for _, p := range tt.posts {
+				status, body := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{
+					"player_key":      {players[p.team]},
+					"move":            {p.move},
+					"idempotency_key": {p.key},
+				})
+				if status != http.StatusOK {
+					t.Fatalf("%s %s: %d %v", p.team, p.move, status, body)
+				}
+				if original, ok := responses[p.key]; ok && !reflect.DeepEqual(body, original) {
+					t.Errorf("retry of %s = %v, want the original %v", p.key, body, original)
+				}
+				responses[p.key] = body
+			}
+
+			_, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+			if moves := gameMoves(body); !reflect.DeepEqual(moves, tt.wantMoves) {
+				t.Errorf("moves = %v, want %v", moves, tt.wantMoves)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package uc2024
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	pgnTag       = regexp.MustCompile(`\[[^\]]*\]`)
+	pgnComment   = regexp.MustCompile(`\{[^}]*\}|;[^\n]*`)
+	pgnVariation = regexp.MustCompile(`\([^()]*\)`)
+	pgnNAG       = regexp.MustCompile(`\$\d+`)
+	pgnMoveNo    = regexp.MustCompile(`^\d+\.+`)
+)
+
+// pgnMoveTokens pulls the moves out of a PGN, or a plain list of moves
+// separated by spaces or commas. Tags, comments, variations, move numbers,
+// annotations and the result are dropped.
+func pgnMoveTokens(text string) []string {
+	text = pgnTag.ReplaceAllString(text, " ")
+	text = pgnComment.ReplaceAllString(text, " ")
+	// Variations can nest so strip them from the inside out
+	for pgnVariation.MatchString(text) {
+		text = pgnVariation.ReplaceAllString(text, " ")
+	}
+	text = pgnNAG.ReplaceAllString(text, " ")
+
+	var tokens []string
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	})
+	for _, field := range fields {
+		field = strings.TrimRight(pgnMoveNo.ReplaceAllString(field, ""), "!?")
+		switch field {
+		case "", "1-0", "0-1", "1/2-1/2", "*":
+			continue
+		}
+		tokens = append(tokens, field)
+	}
+
+	return tokens
+}
+
+// importError points an error at the move, counted from one, that the
+// import stopped on
+func importError(base APIError, index int, move string) APIError {
+	err := base
+	err.MoveNumber = index + 1
+	err.Move = move
+	return err
+}
+
+// importMoves plays a PGN's moves into a game that hasn't started, checking
+// each one the way postMove would. Nothing is published as nobody can be
+// watching a game that is still being created. A game the moves finish is
+// turned away, there would be nothing left to play.
+func (game *ActiveGame) importMoves(text string) (APIError, bool) {
+	tokens := pgnMoveTokens(text)
+	if len(tokens) == 0 {
+		return ErrEmptyImport, false
+	}
+	if len(tokens) >= config.MaxMoves {
+		return ErrImportTooLong, false
+	}
+
+	for i, token := range tokens {
+		if len(token) > config.maxMoveLength(game.chessVariant) {
+			return importError(ErrMoveTooLong, i, token), false
+		}
+
+		move, ok := normalizeMove(game, token)
+		if !ok {
+			return importError(ErrInvalidMove, i, token), false
+		}
+		if err := checkVariantMove(game, move); err != nil {
+			return importError(ErrIllegalMove, i, token), false
+		}
+
+		game.moves = append(game.moves, move)
+		game.playOnBoard(move)
+		if _, _, over := variantOutcome(game); over {
+			return importError(ErrImportedGameOver, i, token), false
+		}
+	}
+
+	game.record(GameLogEntry{
+		Type:       GameLogImported,
+		MoveNumber: len(game.moves),
+	})
+	return APIError{}, true
+}
@@ -0,0 +1,119 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// importTestGame creates a game from pgn as host and seats a guest, giving
+// the game key and the player key on each team
+func importTestGame(t *testing.T, r http.Handler, pgn string) (string, map[PlayerTeam]string) {
+	t.Helper()
+	status, body := call(t, r, http.MethodPost, "/create-from-pgn", url.Values{
+		"player_key":    {"host"},
+		"chess_variant": {"Standard"},
+		"pgn":           {pgn},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("create-from-pgn: %d %v", status, body)
+	}
+	gameKey := body["game_key"].(string)
+
+	status, body = call(t, r, http.MethodPost, "/join/"+gameKey, url.Values{"player_key": {"guest"}})
+	if status != http.StatusOK {
+		t.Fatalf("join: %d %v", status, body)
+	}
+	guestTeam := PlayerTeam(body["team"].(string))
+
+	return gameKey, map[PlayerTeam]string{
+		guestTeam:            "guest",
+		guestTeam.opponent(): "host",
+	}
+}
+
+func TestPGNMoveTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"e4 e5 Nf3", []string{"e4", "e5", "Nf3"}},
+		{"e4,e5, Nf3", []string{"e4", "e5", "Nf3"}},
+		{"1. e4 e5 2. Nf3 1-0", []string{"e4", "e5", "Nf3"}},
+		{"1.e4 1...e5", []string{"e4", "e5"}},
+		{"[Event \"x\"]\n[White \"y\"]\n\n1. e4 *", []string{"e4"}},
+		{"1. e4 {best by test} e5 ; a comment\n2. Nf3", []string{"e4", "e5", "Nf3"}},
+		{"1. e4 (1. d4 (1. c4) d5) e5", []string{"e4", "e5"}},
+		{"1. e4!? $1 e5?? 2. Nf3!", []string{"e4", "e5", "Nf3"}},
+		{"1/2-1/2", nil},
+	}
+
+	for _, tt := range tests {
+		if got := pgnMoveTokens(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pgnMoveTokens(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestImportContinuesPlay(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey, players := importTestGame(t, r, "[Event \"Study\"]\n\n1. e4 {main} e5 2. Nf3 Nc6 (2... d6) 3. Bb5 *")
+
+	_, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	want := []any{"e4", "e5", "Nf3", "Nc6", "Bb5"}
+	if got := gameMoves(body); !reflect.DeepEqual(got, want) {
+		t.Fatalf("imported moves = %v, want %v", got, want)
+	}
+
+	// Five moves in, so black is on move
+	status, body := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {players[PlayerTeamWhite]}, "move": {"Ba4"}})
+	if status != http.StatusForbidden || body["code"] != ErrNotYourTurn.Code {
+		t.Errorf("white move after import = %d %v, want %d %s", status, body, http.StatusForbidden, ErrNotYourTurn.Code)
+	}
+
+	playMoves(t, r, gameKey, players, "a6", "Ba4")
+	_, body = call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if got := gameMoves(body); len(got) != 7 {
+		t.Errorf("moves after continuing = %v, want 7", got)
+	}
+}
+
+func TestImportRejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		pgn        string
+		code       string
+		moveNumber float64
+		move       string
+	}{
+		{"empty", "", ErrEmptyImport.Code, 0, ""},
+		{"only a result", "[Event \"x\"] *", ErrEmptyImport.Code, 0, ""},
+		{"not a move", "1. e4 e5 2. zz9", ErrInvalidMove.Code, 3, "zz9"},
+		{"illegal", "1. e4 e5 2. e4", ErrIllegalMove.Code, 3, "e4"},
+		{"wrong side", "1. e4 Nf3", ErrIllegalMove.Code, 2, "Nf3"},
+		{"already over", "1. f3 e5 2. g4 Qh4#", ErrImportedGameOver.Code, 4, "Qh4#"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+			status, body := call(t, r, http.MethodPost, "/create-from-pgn", url.Values{
+				"player_key":    {"host"},
+				"chess_variant": {"Standard"},
+				"pgn":           {tt.pgn},
+			})
+			if status != http.StatusBadRequest || body["code"] != tt.code {
+				t.Fatalf("create-from-pgn = %d %v, want %d %s", status, body, http.StatusBadRequest, tt.code)
+			}
+			moveNumber, _ := body["move_number"].(float64)
+			move, _ := body["move"].(string)
+			if moveNumber != tt.moveNumber || move != tt.move {
+				t.Errorf("error at move %v %q, want %v %q", moveNumber, move, tt.moveNumber, tt.move)
+			}
+			if len(activeGames) != 0 {
+				t.Errorf("rejected import left %d games", len(activeGames))
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package uc2024
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// warnInactiveGames tells the side to move when their game is close to
+// being purged for inactivity, or to them losing it by abandonment
+func warnInactiveGames() {
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	if config.InactivityWarning <= 0 {
+		return
+	}
+	for key, game := range activeGames {
+		// Whichever comes first, the purge or being ruled to have
+		// abandoned the game
+		remaining := game.inactivityRemaining()
+		if abandonment, ok := game.abandonmentRemaining(); ok {
+			remaining = min(remaining, abandonment)
+		}
+		if game.gameOver || game.inactivityWarned || remaining > config.InactivityWarning || remaining <= 0 {
+			continue
+		}
+
+		game.inactivityWarned = true
+		saveGame(game)
+
+		publishTo(Event{
+			Type:      EventInactivityWarning,
+			GameKey:   key,
+			Team:      moveTeam(len(game.moves)),
+			ExpiresIn: remaining.Seconds(),
+		}, moveTeam(len(game.moves)))
+	}
+}
+
+// warnInactiveGamesLoop checks far more often than the purge runs so the
+// warning arrives close to the configured lead time
+func warnInactiveGamesLoop() {
+	for {
+		time.Sleep(5 * time.Second)
+		warnInactiveGames()
+	}
+}
+
+// postHeartbeat keeps a game alive for a player who is connected but hasn't
+// moved, so only games whose players have really gone are purged
+func postHeartbeat(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	team, seated := game.playerIps[getPlayerKey(c)]
+	if !seated {
+		forbidden(c, ErrNotSeated)
+		return
+	}
+
+	game.lastReceivedTime = now()
+	game.lastHeartbeat[team] = game.lastReceivedTime
+	if game.inactivityWarned {
+		game.inactivityWarned = false
+		publishTo(Event{
+			Type:    EventInactivityCancelled,
+			GameKey: gameKey,
+		}, moveTeam(len(game.moves)))
+	}
+	saveGame(game)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":                "ok",
+		"inactivity_expires_in": max(game.inactivityRemaining(), 0).Seconds(),
+	})
+}
@@ -0,0 +1,163 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestInactivityWarning(t *testing.T) {
+	clock := newTestClock()
+	r := newTestServer(t, func(cfg *Config) {
+		cfg.Clock = clock
+		cfg.InactivityWarning = time.Minute
+		cfg.AbandonmentTimeout = 5 * time.Minute
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	gameKey, players := startTestGame(t, r, nil)
+	playMoves(t, r, gameKey, players, "e4")
+	conn := subscribe(t, server, gameKey, players[PlayerTeamBlack])
+
+	warned := func() bool {
+		accessLock.RLock()
+		defer accessLock.RUnlock()
+		return activeGames[gameKey].inactivityWarned
+	}
+
+	// Still further off than the lead time
+	clock.advance(3 * time.Minute)
+	warnInactiveGames()
+	if warned() {
+		t.Fatal("warned before the lead time")
+	}
+
+	// The abandonment ruling is closer than the purge so it sets the time
+	clock.advance(90 * time.Second)
+	warnInactiveGames()
+	event := nextEvent(t, conn, EventInactivityWarning)
+	if event.GameKey != gameKey || event.Team != PlayerTeamBlack || event.ExpiresIn != 30 {
+		t.Errorf("warning = %+v, want black with 30 seconds left", event)
+	}
+	if !warned() {
+		t.Error("game not marked as warned")
+	}
+}
+
+func TestInactivityWarningDisabled(t *testing.T) {
+	clock := newTestClock()
+	r := newTestServer(t, func(cfg *Config) {
+		cfg.Clock = clock
+		cfg.InactivityWarning = 0
+	})
+	gameKey, players := startTestGame(t, r, nil)
+	playMoves(t, r, gameKey, players, "e4")
+
+	clock.advance(config.AbandonmentTimeout - time.Second)
+	warnInactiveGames()
+
+	accessLock.RLock()
+	defer accessLock.RUnlock()
+	if activeGames[gameKey].inactivityWarned {
+		t.Error("warned with the warning disabled")
+	}
+}
+
+// A lobby nobody joined is reaped on the shorter pre-game timeout unless the
+// host keeps it alive
+func TestPreGamePurge(t *testing.T) {
+	tests := []struct {
+		name      string
+		started   bool
+		heartbeat bool
+		kept      bool
+	}{
+		{"waiting", false, false, false},
+		{"waiting with heartbeat", false, true, true},
+		{"started", true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock()
+			r := newTestServer(t, func(cfg *Config) {
+				cfg.Clock = clock
+				cfg.PreGameInactivityTimeout = 3 * time.Minute
+				cfg.InactivityTimeout = 10 * time.Minute
+			})
+			var gameKey string
+			if tt.started {
+				gameKey, _ = startTestGame(t, r, nil)
+			} else {
+				gameKey = createTestGame(t, r, "host", nil)
+			}
+
+			clock.advance(2 * time.Minute)
+			if tt.heartbeat {
+				if status, body := call(t, r, http.MethodPost, "/heartbeat/"+gameKey, url.Values{"player_key": {"host"}}); status != http.StatusOK {
+					t.Fatalf("heartbeat = %d %v", status, body)
+				}
+			}
+			clock.advance(2 * time.Minute)
+			purgeInactiveGames()
+
+			accessLock.RLock()
+			_, kept := activeGames[gameKey]
+			accessLock.RUnlock()
+			if kept != tt.kept {
+				t.Errorf("kept = %t, want %t", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestHeartbeatCancelsWarning(t *testing.T) {
+	clock := newTestClock()
+	r := newTestServer(t, func(cfg *Config) {
+		cfg.Clock = clock
+		cfg.InactivityWarning = time.Minute
+		cfg.AbandonmentTimeout = 5 * time.Minute
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	gameKey, players := startTestGame(t, r, nil)
+	playMoves(t, r, gameKey, players, "e4")
+	conn := subscribe(t, server, gameKey, players[PlayerTeamBlack])
+
+	clock.advance(4*time.Minute + 30*time.Second)
+	warnInactiveGames()
+	nextEvent(t, conn, EventInactivityWarning)
+
+	status, body := call(t, r, http.MethodPost, "/heartbeat/"+gameKey, url.Values{"player_key": {players[PlayerTeamBlack]}})
+	if status != http.StatusOK {
+		t.Fatalf("heartbeat = %d %v", status, body)
+	}
+	if event := nextEvent(t, conn, EventInactivityCancelled); event.GameKey != gameKey {
+		t.Errorf("cancel event = %+v, want game %s", event, gameKey)
+	}
+
+	// The side to move has been seen again so the clock starts over
+	clock.advance(4 * time.Minute)
+	abandonGames()
+	purgeInactiveGames()
+	accessLock.RLock()
+	game, ok := activeGames[gameKey]
+	accessLock.RUnlock()
+	if !ok || game.gameOver {
+		t.Errorf("heartbeating game ended: present %t, over %t", ok, game.gameOver)
+	}
+}
+
+func TestHeartbeatRejected(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey := createTestGame(t, r, "host", nil)
+
+	status, body := call(t, r, http.MethodPost, "/heartbeat/"+gameKey, url.Values{"player_key": {"stranger"}})
+	if status != http.StatusForbidden || body["code"] != ErrNotSeated.Code {
+		t.Errorf("heartbeat from stranger = %d %v, want %d %s", status, body, http.StatusForbidden, ErrNotSeated.Code)
+	}
+}
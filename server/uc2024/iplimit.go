@@ -0,0 +1,29 @@
+package uc2024
+
+// Addresses aren't stored with correspondence games, so games restored after
+// a restart don't count toward anyone's cap until they are rejoined.
+
+// gamesForIP counts the unfinished games a player from ip is seated in.
+// Callers must hold accessLock.
+func gamesForIP(ip string) int {
+	count := 0
+	for _, game := range activeGames {
+		if game.gameOver {
+			continue
+		}
+		for _, addr := range game.playerAddrs {
+			if addr == ip {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// ipAtGameCap reports whether ip already has config.MaxGamesPerIP games
+// going, so one client can't use up the server's games. Callers must hold
+// accessLock.
+func ipAtGameCap(ip string) bool {
+	return config.MaxGamesPerIP > 0 && gamesForIP(ip) >= config.MaxGamesPerIP
+}
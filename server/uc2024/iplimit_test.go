@@ -0,0 +1,58 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// callFrom is call with the request coming from addr
+func callFrom(t *testing.T, r http.Handler, addr string, method string, path string, params url.Values) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/uc2024"+path+"?"+params.Encode(), nil)
+	req.RemoteAddr = addr + ":1234"
+	return send(t, r, req)
+}
+
+func TestGamesPerIPCap(t *testing.T) {
+	r := newTestServer(t, func(cfg *Config) {
+		cfg.MaxGamesPerIP = 2
+	})
+	create := func(addr string, playerKey string) (int, map[string]any) {
+		return callFrom(t, r, addr, http.MethodPost, "/create", url.Values{"player_key": {playerKey}, "chess_variant": {"Standard"}})
+	}
+
+	var hosted []string
+	for _, playerKey := range []string{"one", "two"} {
+		status, body := create("10.0.0.1", playerKey)
+		if status != http.StatusOK {
+			t.Fatalf("create %s: %d %v", playerKey, status, body)
+		}
+		hosted = append(hosted, body["game_key"].(string))
+	}
+
+	status, body := create("10.0.0.1", "three")
+	if status != http.StatusTooManyRequests || body["code"] != ErrTooManyGamesForIP.Code {
+		t.Errorf("create past the cap = %d %v, want %d %s", status, body, http.StatusTooManyRequests, ErrTooManyGamesForIP.Code)
+	}
+
+	// Joining counts the same as hosting
+	status, body = create("10.0.0.2", "other")
+	if status != http.StatusOK {
+		t.Fatalf("create from another address: %d %v", status, body)
+	}
+	other := body["game_key"].(string)
+	status, body = callFrom(t, r, "10.0.0.1", http.MethodPost, "/join/"+other, url.Values{"player_key": {"three"}})
+	if status != http.StatusTooManyRequests || body["code"] != ErrTooManyGamesForIP.Code {
+		t.Errorf("join past the cap = %d %v, want %d %s", status, body, http.StatusTooManyRequests, ErrTooManyGamesForIP.Code)
+	}
+
+	// A finished game frees its slot
+	if status, body := callFrom(t, r, "10.0.0.1", http.MethodPost, "/resign/"+hosted[0], url.Values{"player_key": {"one"}}); status != http.StatusOK {
+		t.Fatalf("resign: %d %v", status, body)
+	}
+	if status, body := create("10.0.0.1", "three"); status != http.StatusOK {
+		t.Errorf("create after a game finished = %d %v, want %d", status, body, http.StatusOK)
+	}
+}
@@ -0,0 +1,453 @@
+package uc2024
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+// LegalMove is a move the side to move can make, in SAN as postMove takes
+// it and as coordinates for clients highlighting squares
+type LegalMove struct {
+	SAN       string `json:"san"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Promotion string `json:"promotion,omitempty"`
+	// Coordinate form such as e7e8q
+	UCI string `json:"uci"`
+}
+
+var promotionPieces = []string{"Q", "R", "B", "N"}
+
+// candidateMove is a move pgn can be asked about before it is written as SAN
+type candidateMove struct {
+	from    pgn.Position
+	to      pgn.Position
+	piece   byte
+	capture bool
+	promote string
+	castle  string
+}
+
+func (m candidateMove) coordinates() LegalMove {
+	move := LegalMove{
+		From:      m.from.String(),
+		To:        m.to.String(),
+		Promotion: m.promote,
+	}
+	move.UCI = move.From + move.To + strings.ToLower(m.promote)
+	return move
+}
+
+// pseudoLegalMoves lists the moves color's pieces could make ignoring
+// whether they leave the king in check
+func pseudoLegalMoves(board *pgn.Board, color pgn.Color) []candidateMove {
+	var moves []candidateMove
+	enPassant := ""
+	if fields := strings.Fields(board.String()); len(fields) > 3 {
+		enPassant = fields[3]
+	}
+
+	for file := 0; file < 8; file++ {
+		for rank := 0; rank < 8; rank++ {
+			piece := pieceAt(board, file, rank)
+			if piece == pgn.NoPiece || piece.Color() != color {
+				continue
+			}
+			from := squareAt(file, rank)
+			kind := pieceKind(piece)
+
+			add := func(toFile int, toRank int) bool {
+				to := squareAt(toFile, toRank)
+				if to == pgn.NoPosition {
+					return false
+				}
+				target := board.GetPiece(to)
+				if target != pgn.NoPiece && target.Color() == color {
+					return false
+				}
+				moves = append(moves, candidateMove{from: from, to: to, piece: kind, capture: target != pgn.NoPiece})
+				return target == pgn.NoPiece
+			}
+
+			switch kind {
+			case 'p':
+				moves = append(moves, pawnMoves(board, color, file, rank, enPassant)...)
+			case 'n':
+				for _, offset := range knightOffsets {
+					add(file+offset[0], rank+offset[1])
+				}
+			case 'k':
+				for _, offset := range kingOffsets {
+					add(file+offset[0], rank+offset[1])
+				}
+				moves = append(moves, castlingMoves(board, color, from)...)
+			default:
+				var directions [][2]int
+				if kind == 'r' || kind == 'q' {
+					directions = append(directions, rookDirections...)
+				}
+				if kind == 'b' || kind == 'q' {
+					directions = append(directions, bishopDirections...)
+				}
+				for _, direction := range directions {
+					for step := 1; add(file+direction[0]*step, rank+direction[1]*step); step++ {
+					}
+				}
+			}
+		}
+	}
+
+	return moves
+}
+
+func pawnMoves(board *pgn.Board, color pgn.Color, file int, rank int, enPassant string) []candidateMove {
+	forward, startRank, lastRank := 1, 1, 7
+	if color == pgn.Black {
+		forward, startRank, lastRank = -1, 6, 0
+	}
+	from := squareAt(file, rank)
+
+	var moves []candidateMove
+	add := func(toFile int, toRank int, capture bool) {
+		to := squareAt(toFile, toRank)
+		if toRank != lastRank {
+			moves = append(moves, candidateMove{from: from, to: to, piece: 'p', capture: capture})
+			return
+		}
+		for _, promote := range promotionPieces {
+			moves = append(moves, candidateMove{from: from, to: to, piece: 'p', capture: capture, promote: promote})
+		}
+	}
+
+	if pieceAt(board, file, rank+forward) == pgn.NoPiece && squareAt(file, rank+forward) != pgn.NoPosition {
+		add(file, rank+forward, false)
+		if rank == startRank && pieceAt(board, file, rank+2*forward) == pgn.NoPiece {
+			add(file, rank+2*forward, false)
+		}
+	}
+
+	for _, side := range []int{-1, 1} {
+		to := squareAt(file+side, rank+forward)
+		if to == pgn.NoPosition {
+			continue
+		}
+		target := board.GetPiece(to)
+		if (target != pgn.NoPiece && target.Color() != color) || to.String() == enPassant {
+			add(file+side, rank+forward, true)
+		}
+	}
+
+	return moves
+}
+
+// castlingMoves gives the castles color still has the right to, with the
+// squares between king and rook empty and the king not passing through check
+func castlingMoves(board *pgn.Board, color pgn.Color, king pgn.Position) []candidateMove {
+	fields := strings.Fields(board.String())
+	if len(fields) < 3 || inCheck(board, color) {
+		return nil
+	}
+	rights := fields[2]
+	kingside, queenside := "K", "Q"
+	if color == pgn.Black {
+		kingside, queenside = "k", "q"
+	}
+
+	file, rank := squareCoords(king)
+	if file != 4 {
+		return nil
+	}
+
+	var moves []candidateMove
+	castle := func(right string, san string, direction int, empty int) {
+		if !strings.Contains(rights, right) {
+			return
+		}
+		for f := file + direction; f != file+direction*(empty+1); f += direction {
+			if pieceAt(board, f, rank) != pgn.NoPiece {
+				return
+			}
+		}
+		for f := file + direction; f != file+direction*3; f += direction {
+			if squareAttacked(board, squareAt(f, rank), opponentColor(color)) {
+				return
+			}
+		}
+		moves = append(moves, candidateMove{from: king, to: squareAt(file+2*direction, rank), piece: 'k', castle: san})
+	}
+	castle(kingside, "O-O", 1, 2)
+	castle(queenside, "O-O-O", -1, 3)
+
+	return moves
+}
+
+// sanFor writes a move as SAN, disambiguated against the other moves of the
+// same piece kind to the same square
+func sanFor(move candidateMove, moves []candidateMove) string {
+	if len(move.castle) > 0 {
+		return move.castle
+	}
+
+	to := move.to.String()
+	from := move.from.String()
+	if move.piece == 'p' {
+		san := to
+		if move.capture {
+			san = from[:1] + "x" + to
+		}
+		if len(move.promote) > 0 {
+			san += "=" + move.promote
+		}
+		return san
+	}
+
+	sameFile, sameRank, others := false, false, false
+	for _, other := range moves {
+		if other.piece != move.piece || other.to != move.to || other.from == move.from || len(other.castle) > 0 {
+			continue
+		}
+		others = true
+		otherFrom := other.from.String()
+		sameFile = sameFile || otherFrom[0] == from[0]
+		sameRank = sameRank || otherFrom[1] == from[1]
+	}
+
+	san := strings.ToUpper(string(move.piece))
+	switch {
+	case !others:
+	case !sameFile:
+		san += from[:1]
+	case !sameRank:
+		san += from[1:]
+	default:
+		san += from
+	}
+	if move.capture {
+		san += "x"
+	}
+	return san + to
+}
+
+// kingSafeMoves drops the moves that leave color's own king in check
+func kingSafeMoves(board *pgn.Board, color pgn.Color) []candidateMove {
+	var safe []candidateMove
+	for _, move := range pseudoLegalMoves(board, color) {
+		next := *board
+		if err := next.MakeMove(pgn.Move{From: move.from, To: move.to, Promote: promotionPiece(move.promote)}); err != nil {
+			continue
+		}
+		if !inCheck(&next, color) {
+			safe = append(safe, move)
+		}
+	}
+	return safe
+}
+
+// standardMoves lists the moves team can make that don't leave their own
+// king in check, which is every legal move in standard chess
+func standardMoves(game *ActiveGame, board *pgn.Board, team PlayerTeam) []LegalMove {
+	color := teamColor(team)
+	legal := kingSafeMoves(board, color)
+
+	var moves []LegalMove
+	for _, move := range legal {
+		san := sanFor(move, legal)
+		// Only offer what postMove will take, pgn has to read the SAN back
+		// as this very move
+		parsed, err := board.MoveFromAlgebraic(san, color)
+		if err != nil || parsed.From != move.from || parsed.To != move.to {
+			continue
+		}
+
+		legalMove := move.coordinates()
+		legalMove.SAN = san + checkSuffix(game, board, san, team)
+		moves = append(moves, legalMove)
+	}
+	return moves
+}
+
+// legalMoves lists the moves the game's variant allows team, sorted by
+// coordinates
+func legalMoves(game *ActiveGame, board *pgn.Board, team PlayerTeam) []LegalMove {
+	moves := append([]LegalMove{}, variantRules(game.chessVariant).LegalMoves(game, board, team)...)
+	sort.Slice(moves, func(i, j int) bool {
+		return moves[i].UCI < moves[j].UCI
+	})
+	return moves
+}
+
+// checkSuffix is the + or # a legal move is written with when it gives
+// check or mate. In drop variants a check that can be blocked by a drop
+// isn't mate.
+func checkSuffix(game *ActiveGame, board *pgn.Board, move string, team PlayerTeam) string {
+	rules := variantRules(game.chessVariant)
+	opponent := opponentColor(teamColor(team))
+
+	next := *board
+	if err := rules.PlayMove(&next, move, team); err != nil || !inCheck(&next, opponent) {
+		return ""
+	}
+	if len(kingSafeMoves(&next, opponent)) > 0 {
+		return "+"
+	}
+	if drops, ok := rules.(dropVariant); ok {
+		pockets := drops.Pockets(game.chessVariant, append(slices.Clone(game.moves), move))
+		if len(dropMoves(&next, pockets[team.opponent()], team.opponent())) > 0 {
+			return "+"
+		}
+	}
+	return "#"
+}
+
+// promotionPiece is the piece pgn expects in a move, which is lower case
+// for either colour
+func promotionPiece(promote string) pgn.Piece {
+	if len(promote) == 0 {
+		return pgn.NoPiece
+	}
+	return pgn.Piece(strings.ToLower(promote)[0])
+}
+
+// getLegalMoves lists the side to move's legal moves, only those from the
+// from square when it is given
+func getLegalMoves(c *gin.Context) {
+	from := strings.ToLower(param(c, "from"))
+	if len(from) > 0 {
+		if _, err := pgn.ParsePosition(from); err != nil {
+			badRequest(c, ErrInvalidSquare)
+			return
+		}
+	}
+
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	team := moveTeam(len(game.moves))
+	moves := []LegalMove{}
+	if !game.gameOver {
+		board := game.board()
+		if board == nil {
+			conflict(c, ErrPositionUnknown)
+			return
+		}
+		for _, move := range legalMoves(&game, board, team) {
+			if len(from) == 0 || move.From == from {
+				moves = append(moves, move)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"team":  team,
+		"moves": moves,
+	})
+}
+
+// isLegalMove is whether the move is one legalMoves lists, compared by
+// coordinates so any SAN spelling of it counts
+func isLegalMove(game *ActiveGame, board *pgn.Board, move string, team PlayerTeam) bool {
+	uci := strings.TrimRight(move, "+#")
+	if _, _, ok := parseDrop(move); !ok {
+		parsed, err := board.MoveFromAlgebraic(move, teamColor(team))
+		if err != nil {
+			return false
+		}
+		uci = parsed.From.String() + parsed.To.String()
+		if parsed.Promote != pgn.NoPiece {
+			uci += strings.ToLower(string(parsed.Promote))
+		}
+	}
+
+	for _, legal := range legalMoves(game, board, team) {
+		if legal.UCI == uci {
+			return true
+		}
+	}
+	return false
+}
+
+// legalMove is the legality check postMove and postValidateMove share. It
+// reads the move's notation and checks it against the variant's rules for the
+// side to move, giving the move as it would be recorded. The error is nil
+// when the move is legal.
+func legalMove(game *ActiveGame, move string) (string, *APIError) {
+	move, ok := normalizeMove(game, move)
+	if !ok {
+		return "", &ErrInvalidMove
+	}
+	if err := checkVariantMove(game, move); err != nil {
+		return "", &ErrIllegalMove
+	}
+	return move, nil
+}
+
+// postValidateMove answers whether the side to move could play the move
+// now, going through the same checks as postMove without playing it. Every
+// answer is a 200, reason is the error code postMove would give.
+func postValidateMove(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+	move := param(c, "move")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	team := moveTeam(len(game.moves))
+	reject := func(err APIError) {
+		c.JSON(http.StatusOK, gin.H{
+			"legal":  false,
+			"reason": err.Code,
+			"team":   team,
+		})
+	}
+
+	switch {
+	case game.gameOver:
+		reject(ErrGameOver)
+		return
+	case len(game.playerIps) < 2:
+		reject(ErrGameNotReady)
+		return
+	case len(move) > config.maxMoveLength(game.chessVariant):
+		reject(ErrMoveTooLong)
+		return
+	}
+
+	move, err := legalMove(&game, move)
+	if err != nil {
+		reject(*err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"legal": true,
+		"move":  move,
+		"team":  team,
+	})
+}
@@ -0,0 +1,51 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// postValidateMove and postMove go through legalMove, so they have to agree
+// on every move
+func TestValidateAgreesWithMove(t *testing.T) {
+	// White's knight on c3 is pinned to the king by the bishop on b4
+	opening := []string{"d4", "e6", "Nc3", "Bb4"}
+
+	tests := []struct {
+		name     string
+		move     string
+		wantCode string
+	}{
+		{"exposes the king", "Ne4", ErrIllegalMove.Code},
+		{"pinned piece along the pin", "Nb5", ErrIllegalMove.Code},
+		{"not a move", "Zz9", ErrInvalidMove.Code},
+		{"no piece can get there", "Nd5", ErrIllegalMove.Code},
+		{"blocks the pin", "Bd2", ""},
+		{"other knight", "Nf3", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+			gameKey, players := startTestGame(t, r, nil)
+			playMoves(t, r, gameKey, players, opening...)
+
+			_, validated := call(t, r, http.MethodPost, "/game/"+gameKey+"/validate", url.Values{"move": {tt.move}})
+			status, moved := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {players[PlayerTeamWhite]}, "move": {tt.move}})
+
+			if len(tt.wantCode) == 0 {
+				if validated["legal"] != true || status != http.StatusOK {
+					t.Errorf("validate = %v, move = %d %v, want both to accept it", validated, status, moved)
+				}
+				return
+			}
+			if validated["legal"] != false || validated["reason"] != tt.wantCode {
+				t.Errorf("validate = %v, want %s", validated, tt.wantCode)
+			}
+			if status != http.StatusBadRequest || moved["code"] != tt.wantCode {
+				t.Errorf("move = %d %v, want %d %s", status, moved, http.StatusBadRequest, tt.wantCode)
+			}
+		})
+	}
+}
@@ -1,10 +1,10 @@
 package uc2024
 
 import (
-	"fmt"
-	"math/rand"
+	"errors"
 	"net/http"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,54 +16,286 @@ type PlayerTeam string
 const (
 	PlayerTeamWhite PlayerTeam = "white"
 	PlayerTeamBlack PlayerTeam = "black"
+	// Only reported back to callers who aren't seated, never stored
+	PlayerTeamSpectator PlayerTeam = "spectator"
 )
 
+type GameResult string
+
+const (
+	GameResultWhite GameResult = "white"
+	GameResultBlack GameResult = "black"
+	GameResultDraw  GameResult = "draw"
+)
+
+type Termination string
+
+const (
+	TerminationMoveLimit Termination = "move_limit"
+	TerminationResign    Termination = "resign"
+)
+
+// FinalMove is the move that ended the game, so clients can play it out
+// before showing the result
+type FinalMove struct {
+	// Zero based index into the game's moves
+	Index int    `json:"index"`
+	SAN   string `json:"san"`
+	// Position after the move, empty when the server can't follow the variant
+	FEN string `json:"fen,omitempty"`
+}
+
 type ActiveGame struct {
+	key              string
+	mode             GameMode
 	moves            []string
 	gameOver         bool
+	result           GameResult
+	termination      Termination
 	lastReceivedTime time.Time
-	startTime        time.Time
-	playerIps        map[string]PlayerTeam
-	host             string
-	chessVariant     string
+	lastMoveTime     time.Time
+	// When each move was received, in step with moves, and when the second
+	// player sat down so the first move's think time can be worked out
+	moveTimes []time.Time
+	readyTime time.Time
+	// Longest the side to move may take, counted from turnStarted, before
+	// they forfeit. Zero disables it. In the increment clock mode it is the
+	// increment.
+	clockMode     ClockMode
+	moveTimeLimit time.Duration
+	turnStarted   time.Time
+	startTime     time.Time
+	playerIps     map[string]PlayerTeam
+	// Remote address each player key was seated from
+	playerAddrs    map[string]string
+	host           string
+	chessVariant   string
+	spectateTokens map[string]bool
+	password       *gamePassword
+	takebacks      takebackState
+	// Moves queued by a player to be played as soon as it is their turn
+	premoves    map[PlayerTeam]string
+	idempotency []idempotentResponse
+	boardCache  boardCache
+	// Whether the side to move has been warned the game is about to be purged
+	inactivityWarned bool
+	// Each player's last heartbeat, so a side that has gone quiet can be
+	// told apart from one whose opponent is keeping the game alive
+	lastHeartbeat map[PlayerTeam]time.Time
+	// Optional names used for ratings
+	playerNames map[PlayerTeam]string
+	// What the server did to the game, capped at config.GameLogSize
+	log []GameLogEntry
+	// Set when a move ended the game, nil for resignations and purges
+	finalMove *FinalMove
 }
 
-var accessLock *sync.Mutex = &sync.Mutex{}
+var config Config = DefaultConfig()
+var storage Storage = newMemoryStorage()
+
+// accessLock guards activeGames. Handlers that only read a game without
+// touching its board cache can share it.
+var accessLock *sync.RWMutex = &sync.RWMutex{}
 var activeGames map[string]ActiveGame = make(map[string]ActiveGame)
 
 func init() {
-	go purgeInactiveGames()
+	go purgeInactiveGamesLoop()
+	go warnInactiveGamesLoop()
+	go refreshGamesListLoop()
+	go forfeitSlowMovesLoop()
+	go abandonGamesLoop()
+}
+
+func (game *ActiveGame) finish(result GameResult, termination Termination) {
+	game.gameOver = true
+	game.result = result
+	game.termination = termination
+	game.record(GameLogEntry{
+		Type:        GameLogGameOver,
+		Result:      result,
+		Termination: termination,
+	})
+	updateRatings(game)
+
+	publish(Event{
+		Type:        EventGameOver,
+		GameKey:     game.key,
+		Result:      result,
+		Termination: termination,
+		FinalMove:   game.finalMove,
+	})
+}
+
+// hostTeam guards against games whose host lost their seat, reading the map
+// directly would quietly report an empty team
+func (game *ActiveGame) hostTeam() (PlayerTeam, bool) {
+	team, ok := game.playerIps[game.host]
+	if !ok || (team != PlayerTeamWhite && team != PlayerTeamBlack) {
+		return "", false
+	}
+	return team, true
+}
+
+func (game *ActiveGame) inactivityRemaining() time.Duration {
+	timeout, _ := game.timeouts()
+	return timeout - since(game.lastReceivedTime)
+}
+
+func (game *ActiveGame) lifetimeRemaining() time.Duration {
+	_, lifetime := game.timeouts()
+	return lifetime - since(game.startTime)
 }
 
 func getGame(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
 	gameKey := c.Param("game_key")
 
 	accessLock.Lock()
 	defer accessLock.Unlock()
 	game, ok := activeGames[gameKey]
 	if !ok {
-		time.Sleep(5 * time.Second)
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "game not found",
-		})
+		gameMissing(c, gameKey)
+		return
+	}
+
+	hostTeam, ok := game.hostTeam()
+	if !ok {
+		logger.Error("game has no host team", "game_key", gameKey)
+		respondError(c, http.StatusInternalServerError, ErrNoHostTeam)
 		return
 	}
 
+	// Heal a board cache that drifted from the moves before a move is checked
+	// against it. The cache isn't stored so there is nothing to persist.
+	if game.repairBoardCache() {
+		activeGames[gameKey] = game
+	}
+
+	var lastMoveAt *string
+	if len(game.moves) > 0 {
+		formatted := game.lastMoveTime.UTC().Format(time.RFC3339)
+		lastMoveAt = &formatted
+	}
+
+	// Tell the caller which seat is theirs without echoing any keys
+	yourTeam, seated := game.playerIps[getPlayerKey(c)]
+	if !seated {
+		yourTeam = PlayerTeamSpectator
+	}
+
+	// Only games with a move time limit have a deadline
+	var moveExpiresIn *float64
+	if remaining, limited := game.moveTimeRemaining(); limited {
+		seconds := max(remaining, 0).Seconds()
+		moveExpiresIn = &seconds
+	}
+
+	// Only Three-Check keeps a tally
+	var checks map[PlayerTeam]int
+	if variantName(game.chessVariant) == "ThreeCheck" {
+		checks = countChecks(game.chessVariant, game.moves)
+	}
+
+	// Pieces in hand, only for variants that drop them back in
+	var pockets map[PlayerTeam]Pocket
+	if drops, ok := variantRules(game.chessVariant).(dropVariant); ok {
+		pockets = drops.Pockets(game.chessVariant, game.moves)
+	}
+
+	// Changes only when the position does, not when the clocks or players do
+	hash := positionHash(game.board(), pockets)
+
 	c.JSON(http.StatusOK, gin.H{
-		"moves":         game.moves,
-		"game_ready":    len(game.playerIps) == 2,
-		"host_team":     game.playerIps[game.host],
-		"game_complete": game.gameOver,
+		"moves":               game.moves,
+		"mode":                game.mode,
+		"game_ready":          len(game.playerIps) == 2,
+		"host_team":           hostTeam,
+		"your_team":           yourTeam,
+		"opponent_present":    seated && len(game.playerIps) == 2,
+		"game_complete":       game.gameOver,
+		"result":              game.result,
+		"termination":         game.termination,
+		"final_move":          game.finalMove,
+		"started_at":          game.startTime.UTC().Format(time.RFC3339),
+		"last_move_at":        lastMoveAt,
+		"takebacks_remaining": game.takebacks.remainingByTeam(),
+		"checks":              checks,
+		"pockets":             pockets,
+		"position_hash":       hash,
+		// Seconds until the game is purged for inactivity or for its age
+		"inactivity_expires_in": max(game.inactivityRemaining(), 0).Seconds(),
+		"lifetime_expires_in":   max(game.lifetimeRemaining(), 0).Seconds(),
+		// The move time limit and what the side to move has left of it in
+		// seconds, zero and null for games without one. Both are for the
+		// current move only, no clock mode carries time over.
+		"clock_mode":      game.clockMode,
+		"move_time_limit": game.moveTimeLimit.Seconds(),
+		"move_expires_in": moveExpiresIn,
+	})
+}
+
+// applyMove plays a move that has already been checked, tells subscribers
+// and ends the game if the move finished it
+func (game *ActiveGame) applyMove(move string) {
+	game.moves = append(game.moves, move)
+	game.moveTimes = append(game.moveTimes, now())
+	game.playOnBoard(move)
+	game.record(GameLogEntry{
+		Type:       GameLogMove,
+		Team:       moveTeam(len(game.moves) - 1),
+		Move:       move,
+		MoveNumber: len(game.moves),
+	})
+	game.lastReceivedTime = now()
+	game.lastMoveTime = game.lastReceivedTime
+	game.turnStarted = game.lastReceivedTime
+	// Moving on implicitly withdraws or declines a pending takeback
+	game.takebacks.requested = ""
+	if game.inactivityWarned {
+		game.inactivityWarned = false
+		publishTo(Event{
+			Type:    EventInactivityCancelled,
+			GameKey: game.key,
+		}, moveTeam(len(game.moves)-1))
+	}
+
+	publish(Event{
+		Type:       EventMove,
+		GameKey:    game.key,
+		Move:       move,
+		MoveNumber: len(game.moves),
 	})
+
+	result, termination, over := variantOutcome(game)
+	if !over && len(game.moves) >= config.MaxMoves {
+		// Games that hit the move cap are drawn so they don't sit in limbo
+		// until they are purged
+		result, termination, over = GameResultDraw, TerminationMoveLimit, true
+	}
+	if !over {
+		return
+	}
+
+	game.finalMove = &FinalMove{
+		Index: len(game.moves) - 1,
+		SAN:   move,
+	}
+	if board := game.board(); board != nil {
+		game.finalMove.FEN = board.String()
+	}
+	game.finish(result, termination)
 }
 
 func postMove(c *gin.Context) {
 	gameKey := c.Param("game_key")
-	move := c.Query("move")
-	if len(move) > 20 {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "move too long",
-		})
+	move := param(c, "move")
+
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
 		return
 	}
 
@@ -71,112 +303,395 @@ func postMove(c *gin.Context) {
 	defer accessLock.Unlock()
 	game, ok := activeGames[gameKey]
 	if !ok {
-		time.Sleep(5 * time.Second)
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "game not found",
-		})
+		gameMissing(c, gameKey)
+		return
+	}
+
+	// A retry of a move that was already played gets the original answer
+	idempotencyKey := param(c, "idempotency_key")
+	if response, ok := game.idempotentResponse(idempotencyKey); ok {
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
+	// The deadline may have passed since the last check for slow moves
+	if game.forfeitIfOutOfTime() {
+		saveGame(game)
+	}
+
 	if game.gameOver {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "game already over",
-		})
+		forbidden(c, gameOverError(&game))
 		return
 	}
 
-	if len(game.moves) > 500 {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "max moves hit",
-		})
+	if len(move) > config.maxMoveLength(game.chessVariant) {
+		forbidden(c, ErrMoveTooLong)
 		return
 	}
 
-	game.moves = append(game.moves, move)
-	game.lastReceivedTime = time.Now()
-	activeGames[gameKey] = game
+	if game.isSpectator(getPlayerKey(c)) {
+		forbidden(c, ErrSpectatorMove)
+		return
+	}
+
+	// The seat comes from the token subject when tokens are configured, so
+	// only the player on move can play it
+	team, seated := game.playerIps[getPlayerKey(c)]
+	if !seated {
+		forbidden(c, ErrNotSeated)
+		return
+	}
+
+	if len(game.playerIps) < 2 {
+		conflict(c, ErrGameNotReady)
+		return
+	}
+
+	if team != moveTeam(len(game.moves)) {
+		forbidden(c, ErrNotYourTurn)
+		return
+	}
+
+	move, err := legalMove(&game, move)
+	if err != nil {
+		badRequest(c, *err)
+		return
+	}
+
+	game.applyMove(move)
+	c.Set(logTeam, string(team))
+	c.Set(logMoveNumber, len(game.moves))
+	game.playPremove()
+
+	response := gin.H{
+		"status":        "ok",
+		"move":          move,
+		"game_complete": game.gameOver,
+		"result":        game.result,
+		"termination":   game.termination,
+		"final_move":    game.finalMove,
+	}
+	game.rememberResponse(idempotencyKey, response)
+	saveGame(game)
+
+	c.JSON(http.StatusOK, response)
+}
+
+func postResign(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	team, seated := game.playerIps[getPlayerKey(c)]
+	if !seated {
+		forbidden(c, ErrNotSeated)
+		return
+	}
+
+	if game.gameOver {
+		forbidden(c, gameOverError(&game))
+		return
+	}
+
+	c.Set(logTeam, string(team))
+	game.finish(GameResult(team.opponent()), TerminationResign)
+	saveGame(game)
 
 	c.JSON(http.StatusOK, gin.H{
-		"status": "ok",
+		"status":        "ok",
+		"game_complete": game.gameOver,
+		"result":        game.result,
+		"termination":   game.termination,
 	})
 }
 
-func generateGameKey() string {
-	possibleKeyChars := []rune("abcdefghjkmnrstuvwxyz34678")
-	gameKey := ""
-	for i := 0; i < 6; i++ {
-		gameKey += string(possibleKeyChars[rand.Intn(len(possibleKeyChars))])
+// Draws of a fresh game key before giving up. With the keyspace Validate
+// insists on a draw collides less than once in 10,000 so running out means
+// something is badly wrong.
+const maxGameKeyAttempts = 10
+
+var errNoGameKey = errors.New("every game key drawn is taken")
+
+// generateGameKey picks a key no live or recently purged game has. Must be
+// called with accessLock held so the key can't be taken before it's used.
+func generateGameKey() (string, error) {
+	possibleKeyChars := []rune(config.GameKeyAlphabet)
+	for attempt := 0; attempt < maxGameKeyAttempts; attempt++ {
+		gameKey := ""
+		for i := 0; i < config.GameKeyLength; i++ {
+			gameKey += string(possibleKeyChars[randomIntn(len(possibleKeyChars))])
+		}
+
+		_, active := activeGames[gameKey]
+		_, purged := purgedGames[gameKey]
+		if !active && !purged {
+			return gameKey, nil
+		}
 	}
 
-	return gameKey
+	return "", errNoGameKey
 }
 
 func getPlayerKey(c *gin.Context) string {
-	return c.Query("player_key")
+	if len(config.JWTSecret) > 0 {
+		return tokenSubject(c)
+	}
+	return param(c, "player_key")
 }
 
-func checkPlayerKey(c *gin.Context) bool {
-	return len(getPlayerKey(c)) <= 0 || len(getPlayerKey(c)) > 20
+// getPlayerName returns the optional name a player is rated under
+func getPlayerName(c *gin.Context) (string, bool) {
+	// Ratings follow the account when players have one
+	if len(config.JWTSecret) > 0 {
+		return tokenSubject(c), true
+	}
+
+	name := strings.TrimSpace(param(c, "player_name"))
+	return name, len(name) <= 32
+}
+
+// Player keys end up in map keys and hashed into logs so only allow
+// characters that can't break either. Long enough for the UUIDs the game
+// client generates.
+const maxPlayerKeyLength = 64
+
+var playerKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+func checkPlayerKey(c *gin.Context) (APIError, bool) {
+	playerKey := getPlayerKey(c)
+	switch {
+	case len(playerKey) == 0 && len(config.JWTSecret) > 0:
+		return ErrTokenRequired, false
+	case len(playerKey) == 0:
+		return ErrPlayerKeyEmpty, false
+	case len(playerKey) > maxPlayerKeyLength:
+		return ErrPlayerKeyTooLong, false
+	case !playerKeyPattern.MatchString(playerKey):
+		return ErrInvalidPlayerKey, false
+	}
+	return APIError{}, true
+}
+
+// SupportedVariants are the variant names accepted by create, Chess960 is
+// sent with its seed as Chess960(seed) or without one for the server to pick
+var SupportedVariants = []string{"Standard", "Chess960", "Horde", "Horsies", "Kawns", "RacingKings", "ThreeCheck", "Crazyhouse"}
+
+var chessVariantPattern = regexp.MustCompile(`^(?:Chess960(?:\(\d{0,10}\))?|Standard|Horde|Horsies|Kawns|RacingKings|ThreeCheck|Crazyhouse)$`)
+
+func validChessVariant(chessVariant string) bool {
+	if !chessVariantPattern.MatchString(chessVariant) {
+		return false
+	}
+	// The pattern allows seeds past uint32, which the client can't shuffle
+	// with and would leave the game without a layout
+	if chess960Seed.MatchString(chessVariant) {
+		_, ok := variantSeed(chessVariant)
+		return ok
+	}
+	return true
+}
+
+func randomTeam() PlayerTeam {
+	if randomIntn(2) == 0 {
+		return PlayerTeamWhite
+	}
+	return PlayerTeamBlack
+}
+
+func (team PlayerTeam) opponent() PlayerTeam {
+	if team == PlayerTeamWhite {
+		return PlayerTeamBlack
+	}
+	return PlayerTeamWhite
+}
+
+func newActiveGame(key string, host string, team PlayerTeam, chessVariant string) ActiveGame {
+	game := ActiveGame{
+		key:              key,
+		mode:             GameModeRealtime,
+		clockMode:        ClockModeNone,
+		moves:            []string{},
+		startTime:        now(),
+		lastReceivedTime: now(),
+		host:             host,
+		playerIps: map[string]PlayerTeam{
+			host: team,
+		},
+		playerAddrs:    map[string]string{},
+		chessVariant:   chessVariant,
+		spectateTokens: map[string]bool{},
+		playerNames:    map[PlayerTeam]string{},
+		premoves:       map[PlayerTeam]string{},
+		lastHeartbeat:  map[PlayerTeam]time.Time{},
+		takebacks: newTakebackState(TakebackPolicy{
+			Allowed: true,
+			Max:     config.MaxTakebacks,
+		}),
+	}
+	game.record(GameLogEntry{
+		Type: GameLogCreated,
+		Team: team,
+	})
+	return game
 }
 
 func postCreateGame(c *gin.Context) {
-	if !checkPlayerKey(c) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid player key",
-		})
+	createGame(c, false)
+}
+
+// postCreateFromPGN creates a game that carries on from the moves in the pgn
+// param, so an imported game or a study position can be played out
+func postCreateFromPGN(c *gin.Context) {
+	createGame(c, true)
+}
+
+func createGame(c *gin.Context, imported bool) {
+	if err, ok := checkPlayerKey(c); !ok {
+		badRequest(c, err)
 		return
 	}
 
-	chessVariant := c.Query("chess_variant")
-	validPattern := "^(Chess960\\(\\d{0,10}\\))|(Standard)|(Horde)|(Horsies)|(Kawns)$"
-	re := regexp.MustCompile(validPattern)
-	if !re.Match([]byte(chessVariant)) {
-		fmt.Printf("Invalid chess variant: %s\n", chessVariant)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid chess variant",
-		})
+	playerName, ok := getPlayerName(c)
+	if !ok {
+		badRequest(c, ErrInvalidPlayerName)
+		return
+	}
+
+	chessVariant := param(c, "chess_variant")
+	if !validChessVariant(chessVariant) {
+		c.Set(logChessVariant, chessVariant)
+		badRequest(c, invalidVariantError())
+		return
+	}
+	chessVariant = seedVariant(chessVariant)
+
+	takebacks, ok := takebackPolicy(c)
+	if !ok {
+		badRequest(c, ErrInvalidTakebackPolicy)
 		return
 	}
 
-	gameKey := generateGameKey()
+	mode, ok := gameMode(c)
+	if !ok {
+		badRequest(c, ErrInvalidGameMode)
+		return
+	}
+
+	clockMode, moveLimit, ok := moveClock(c)
+	if !ok {
+		badRequest(c, ErrInvalidMoveTimeLimit)
+		return
+	}
+	if clockMode == ClockModeIncrement {
+		takebacks.Allowed = false
+	}
 
 	accessLock.Lock()
 	defer accessLock.Unlock()
 	if len(activeGames) > 100 {
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"error": "too many active games",
-		})
+		tooManyRequests(c, ErrTooManyGames)
 		return
 	}
 
-	var team PlayerTeam
-	if rand.Int()%2 == 0 {
-		team = PlayerTeamWhite
-	} else {
-		team = PlayerTeamBlack
+	if ipAtGameCap(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyGamesForIP)
+		return
 	}
 
-	activeGames[gameKey] = ActiveGame{
-		moves:            []string{},
-		startTime:        time.Now(),
-		lastReceivedTime: time.Now(),
-		host:             getPlayerKey(c),
-		playerIps: map[string]PlayerTeam{
-			getPlayerKey(c): team,
-		},
-		chessVariant: chessVariant,
+	gameKey, err := generateGameKey()
+	if err != nil {
+		logger.Error("generating game key", "error", err)
+		serviceUnavailable(c, ErrNoGameKey)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"game_key": gameKey,
-	})
+	team := randomTeam()
+	game := newActiveGame(gameKey, getPlayerKey(c), team, chessVariant)
+	game.playerAddrs[getPlayerKey(c)] = c.ClientIP()
+	game.password = newGamePassword(param(c, "password"))
+	game.takebacks = newTakebackState(takebacks)
+	game.mode = mode
+	game.clockMode = clockMode
+	game.moveTimeLimit = moveLimit
+	game.playerNames[team] = playerName
+	if imported {
+		if err, ok := game.importMoves(param(c, "pgn")); !ok {
+			badRequest(c, err)
+			return
+		}
+	}
+	saveGame(game)
+	c.Set(logGameKey, gameKey)
+	c.Set(logTeam, string(team))
+
+	response := gin.H{
+		"game_key":      gameKey,
+		"chess_variant": chessVariant,
+		// Empty for variants whose layout the server doesn't know
+		"initial_fen": variantRules(chessVariant).StartingFEN(chessVariant),
+	}
+	if imported {
+		response["moves"] = game.moves
+	}
+	if seed, ok := variantSeed(chessVariant); ok {
+		response["seed"] = seed
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// variantName strips the seed from variants like Chess960(1234)
+func variantName(chessVariant string) string {
+	name, _, _ := strings.Cut(chessVariant, "(")
+	return name
+}
+
+// clientSupportsVariant checks the optional supported_variants the joiner
+// sent, a list in a JSON body or repeated in the query string, and either way
+// entries may be comma separated. Clients that don't send it are assumed to
+// support everything.
+func clientSupportsVariant(c *gin.Context, chessVariant string) bool {
+	supported := paramList(c, "supported_variants")
+	if len(supported) == 0 {
+		return true
+	}
+
+	for _, param := range supported {
+		for _, variant := range strings.Split(param, ",") {
+			variant = strings.TrimSpace(variant)
+			if variant == chessVariant || variant == variantName(chessVariant) {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
 func postJoinGame(c *gin.Context) {
-	if !checkPlayerKey(c) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "invalid player key",
-		})
+	if err, ok := checkPlayerKey(c); !ok {
+		badRequest(c, err)
+		return
+	}
+
+	playerName, ok := getPlayerName(c)
+	if !ok {
+		badRequest(c, ErrInvalidPlayerName)
+		return
+	}
+
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
 		return
 	}
 
@@ -186,76 +701,203 @@ func postJoinGame(c *gin.Context) {
 	defer accessLock.Unlock()
 	game, ok := activeGames[gameKey]
 	if !ok {
-		time.Sleep(5 * time.Second)
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "game not found",
+		gameMissing(c, gameKey)
+		return
+	}
+
+	// The seat is checked and claimed under one hold of accessLock, so of
+	// racing joiners exactly one gets it. Someone already seated is handled
+	// first so a joiner retrying after a lost response keeps their team.
+	playerKey := getPlayerKey(c)
+	if team, seated := game.playerIps[playerKey]; seated {
+		if playerKey == game.host {
+			conflict(c, ErrHostJoin)
+			return
+		}
+		hostTeam, _ := game.hostTeam()
+		c.Set(logTeam, string(team))
+		c.JSON(http.StatusOK, gin.H{
+			"game_key":      gameKey,
+			"host":          hostTeam,
+			"team":          team,
+			"chess_variant": game.chessVariant,
+			"initial_fen":   variantRules(game.chessVariant).StartingFEN(game.chessVariant),
 		})
 		return
 	}
 
 	if len(game.playerIps) >= 2 {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "game already full",
-		})
+		forbidden(c, ErrGameFull)
 		return
 	}
 
-	var team PlayerTeam
-	if game.playerIps[game.host] == PlayerTeamWhite {
-		team = PlayerTeamBlack
-	} else {
-		team = PlayerTeamWhite
+	if ipAtGameCap(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyGamesForIP)
+		return
 	}
 
-	game.playerIps[getPlayerKey(c)] = team
-	activeGames[gameKey] = game
+	if game.isSpectator(playerKey) {
+		forbidden(c, ErrSpectatorMove)
+		return
+	}
+
+	if !game.password.matches(param(c, "password")) {
+		forbidden(c, ErrWrongPassword)
+		return
+	}
+
+	if !clientSupportsVariant(c, game.chessVariant) {
+		conflict(c, ErrUnsupportedVariant)
+		return
+	}
+
+	hostTeam, ok := game.hostTeam()
+	if !ok {
+		logger.Error("game has no host team", "game_key", gameKey)
+		conflict(c, ErrNoHostTeam)
+		return
+	}
+
+	team := hostTeam.opponent()
+	game.playerIps[playerKey] = team
+	game.playerAddrs[playerKey] = c.ClientIP()
+	game.playerNames[team] = playerName
+	game.lastReceivedTime = now()
+	game.readyTime = game.lastReceivedTime
+	game.turnStarted = game.readyTime
+	game.record(GameLogEntry{
+		Type: GameLogJoined,
+		Team: team,
+	})
+	saveGame(game)
+	// Save the host from polling for game_ready
+	publishTo(Event{
+		Type:    EventOpponentJoined,
+		GameKey: gameKey,
+		Team:    team,
+	}, hostTeam)
+	c.Set(logTeam, string(team))
 
 	c.JSON(http.StatusOK, gin.H{
 		"game_key":      gameKey,
-		"host":          game.playerIps[game.host],
+		"host":          hostTeam,
+		"team":          team,
 		"chess_variant": game.chessVariant,
+		"initial_fen":   variantRules(game.chessVariant).StartingFEN(game.chessVariant),
 	})
 }
 
+// purgeInactiveGames removes every game that is out of time or has gone
+// quiet, along with the seeks and lookups that have expired
 func purgeInactiveGames() {
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	for _, game := range activeGames {
+		if game.lifetimeRemaining() <= 0 {
+			purgeGame(&game, TerminationTimeLimit)
+		} else if game.inactivityRemaining() <= 0 {
+			// Rule on a game the side to move walked away from first so
+			// its result outlives the purge
+			game.forfeitIfAbandoned()
+			purgeGame(&game, TerminationInactivity)
+		}
+	}
+	forgetPurgedGames()
+	purgeSeeks()
+	purgeFailedLookups()
+}
+
+func purgeInactiveGamesLoop() {
 	for {
 		time.Sleep(1 * time.Minute)
-		accessLock.Lock()
-		for key, game := range activeGames {
-			if time.Since(game.lastReceivedTime) > 10*time.Minute || time.Since(game.startTime) > 1*time.Hour {
-				delete(activeGames, key)
-			}
-		}
-		accessLock.Unlock()
+		purgeInactiveGames()
 	}
 }
 
 func deleteGame(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
 	gameKey := c.Param("game_key")
 
 	accessLock.Lock()
 	defer accessLock.Unlock()
-	_, ok := activeGames[gameKey]
+	game, ok := activeGames[gameKey]
 	if !ok {
-		time.Sleep(5 * time.Second)
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "game not found",
-		})
+		gameMissing(c, gameKey)
 		return
 	}
 
-	delete(activeGames, gameKey)
+	removeGame(&game)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "ok",
 	})
 }
 
-func AddChessServerGroup(r *gin.Engine) {
+func AddChessServerGroup(r *gin.Engine, cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if cfg.Random != nil {
+		seedRandom(cfg.Random)
+	}
+
+	newStorage, err := NewStorage(cfg.StorageFile)
+	if err != nil {
+		return err
+	}
+
+	// The background loops started by init read these under accessLock
+	accessLock.Lock()
+	config = cfg
+	if cfg.Clock != nil {
+		clock = cfg.Clock
+	}
+	storage = newStorage
+	accessLock.Unlock()
+
+	if err := restoreGames(); err != nil {
+		return err
+	}
+
 	group := r.Group("/uc2024")
+	group.Use(requestLogger(), bodyParams(), playerIdentity())
 	group.POST("/create", postCreateGame)
+	group.POST("/create-from-pgn", postCreateFromPGN)
 	group.POST("/join/:game_key", postJoinGame)
 	group.POST("/move/:game_key", postMove)
+	group.POST("/premove/:game_key", postPremove)
+	group.DELETE("/premove/:game_key", deletePremove)
+	group.POST("/seek", postSeek)
+	group.GET("/seek/status", getSeekStatus)
+	group.DELETE("/seek", deleteSeek)
+	group.POST("/spectate-link/:game_key", postSpectateLink)
+	group.POST("/resign/:game_key", postResign)
+	group.POST("/heartbeat/:game_key", postHeartbeat)
+	group.POST("/takeback/:game_key", postTakebackRequest)
+	group.POST("/takeback/:game_key/accept", postTakebackAccept)
+	group.POST("/takeback/:game_key/decline", postTakebackDecline)
+	group.GET("/subscribe/:game_key", getSubscribe)
 	group.GET("/game/:game_key", getGame)
+	group.GET("/game/:game_key/status", getGameStatus)
+	group.GET("/game/:game_key/move/:index", getGameMove)
+	group.GET("/game/:game_key/full", getGameFull)
+	group.GET("/game/:game_key/pgn", getGamePGN)
+	group.GET("/game/:game_key/legal", getLegalMoves)
+	group.POST("/game/:game_key/validate", postValidateMove)
 	group.DELETE("/game/:game_key", deleteGame)
+	group.GET("/games", getGames)
+	group.GET("/rating/:player", getRating)
+	group.GET("/version", getVersion)
+
+	admin := group.Group("/admin", adminOnly())
+	admin.GET("/game/:game_key", getAdminGame)
+	admin.DELETE("/game/:game_key", deleteAdminGame)
+	admin.GET("/game/:game_key/log", getAdminGameLog)
+	admin.GET("/summary", getAdminSummary)
+
+	return nil
 }
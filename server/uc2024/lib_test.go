@@ -0,0 +1,456 @@
+package uc2024
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testClock is a Clock moved forward by hand
+type testClock struct {
+	lock *sync.Mutex
+	now  time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{lock: &sync.Mutex{}, now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestServer clears every game and returns a router serving the chess
+// routes. edit may change the default config before it is applied.
+func newTestServer(t *testing.T, edit func(cfg *Config)) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := DefaultConfig()
+	cfg.StorageFile = filepath.Join(t.TempDir(), "storage.json")
+	cfg.Clock = realClock{}
+	cfg.Random = rand.NewSource(1)
+	if edit != nil {
+		edit(&cfg)
+	}
+
+	accessLock.Lock()
+	activeGames = map[string]ActiveGame{}
+	purgedGames = map[string]purgedGame{}
+	seeks = map[string]seekEntry{}
+	accessLock.Unlock()
+	lookupLock.Lock()
+	failedLookups = map[string]lookupRecord{}
+	lookupLock.Unlock()
+
+	r := gin.New()
+	if err := AddChessServerGroup(r, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// call sends the params in the query string and decodes the JSON response
+func call(t *testing.T, r http.Handler, method string, path string, params url.Values) (int, map[string]any) {
+	t.Helper()
+	return send(t, r, httptest.NewRequest(method, "/uc2024"+path+"?"+params.Encode(), nil))
+}
+
+// send serves a prepared request and decodes the JSON response
+func send(t *testing.T, r http.Handler, req *http.Request) (int, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: %v: %s", req.Method, req.URL, err, w.Body)
+	}
+	return w.Code, body
+}
+
+// createTestGame hosts a game as hostKey and returns its key
+func createTestGame(t *testing.T, r http.Handler, hostKey string, params url.Values) string {
+	t.Helper()
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("player_key", hostKey)
+	if !params.Has("chess_variant") {
+		params.Set("chess_variant", "Standard")
+	}
+
+	status, body := call(t, r, http.MethodPost, "/create", params)
+	if status != http.StatusOK {
+		t.Fatalf("create: %d %v", status, body)
+	}
+	return body["game_key"].(string)
+}
+
+// startTestGame creates a game and seats a second player, giving the game
+// key and the player key on each team
+func startTestGame(t *testing.T, r http.Handler, params url.Values) (string, map[PlayerTeam]string) {
+	t.Helper()
+	gameKey := createTestGame(t, r, "host", params)
+
+	status, body := call(t, r, http.MethodPost, "/join/"+gameKey, url.Values{"player_key": {"guest"}})
+	if status != http.StatusOK {
+		t.Fatalf("join: %d %v", status, body)
+	}
+	guestTeam := PlayerTeam(body["team"].(string))
+
+	return gameKey, map[PlayerTeam]string{
+		guestTeam:            "guest",
+		guestTeam.opponent(): "host",
+	}
+}
+
+// playMoves plays the moves in turn from the starting position, failing the
+// test if any is turned down
+func playMoves(t *testing.T, r http.Handler, gameKey string, players map[PlayerTeam]string, moves ...string) {
+	t.Helper()
+	status, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if status != http.StatusOK {
+		t.Fatalf("game: %d %v", status, body)
+	}
+	played := len(gameMoves(body))
+
+	for i, move := range moves {
+		team := moveTeam(played + i)
+		status, body := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {players[team]}, "move": {move}})
+		if status != http.StatusOK {
+			t.Fatalf("move %s: %d %v", move, status, body)
+		}
+	}
+}
+
+// gameMoves is the move list of a game response, empty before any move
+func gameMoves(body map[string]any) []any {
+	moves, _ := body["moves"].([]any)
+	return moves
+}
+
+func TestMoveBeforeOpponentJoins(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey := createTestGame(t, r, "host", nil)
+
+	for _, move := range []string{"e4", "Nf3"} {
+		status, body := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {"host"}, "move": {move}})
+		if status != http.StatusConflict || body["code"] != ErrGameNotReady.Code {
+			t.Errorf("move %s before join = %d %v, want %d %s", move, status, body, http.StatusConflict, ErrGameNotReady.Code)
+		}
+	}
+
+	_, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if moves := gameMoves(body); len(moves) != 0 {
+		t.Errorf("moves recorded before join: %v", moves)
+	}
+
+	status, body := call(t, r, http.MethodPost, "/join/"+gameKey, url.Values{"player_key": {"guest"}})
+	if status != http.StatusOK {
+		t.Fatalf("join: %d %v", status, body)
+	}
+	white := "host"
+	if body["team"] == string(PlayerTeamWhite) {
+		white = "guest"
+	}
+	status, body = call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {white}, "move": {"e4"}})
+	if status != http.StatusOK {
+		t.Errorf("move after join = %d %v", status, body)
+	}
+}
+
+func TestGenerateGameKeyAvoidsTakenKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		active []string
+		purged []string
+		// Empty when every key is taken
+		wantKey string
+	}{
+		{"free keys", nil, nil, ""},
+		{"one live game", []string{"a"}, nil, "b"},
+		{"one purged game", nil, []string{"b"}, "a"},
+		{"all taken", []string{"a"}, []string{"b"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+
+			// Too small for Validate, so set after the server is up
+			accessLock.Lock()
+			config.GameKeyAlphabet = "ab"
+			config.GameKeyLength = 1
+			for _, key := range tt.active {
+				activeGames[key] = newActiveGame(key, "host", PlayerTeamWhite, "Standard")
+			}
+			for _, key := range tt.purged {
+				purgedGames[key] = purgedGame{}
+			}
+			accessLock.Unlock()
+
+			allTaken := len(tt.active)+len(tt.purged) == 2
+			for i := 0; i < 20; i++ {
+				accessLock.Lock()
+				gameKey, err := generateGameKey()
+				accessLock.Unlock()
+				switch {
+				case allTaken && err == nil:
+					t.Fatalf("generateGameKey() = %q with every key taken", gameKey)
+				case !allTaken && err != nil:
+					t.Fatalf("generateGameKey() = %v", err)
+				case len(tt.wantKey) > 0 && gameKey != tt.wantKey:
+					t.Fatalf("generateGameKey() = %q, want %q", gameKey, tt.wantKey)
+				}
+			}
+
+			if !allTaken {
+				return
+			}
+			status, body := call(t, r, http.MethodPost, "/create", url.Values{"player_key": {"host"}, "chess_variant": {"Standard"}})
+			if status != http.StatusServiceUnavailable || body["code"] != ErrNoGameKey.Code {
+				t.Errorf("create = %d %v, want %d %s", status, body, http.StatusServiceUnavailable, ErrNoGameKey.Code)
+			}
+		})
+	}
+}
+
+// Run with -race, every joiner goes at the one free seat at once
+func TestConcurrentJoinsSeatOnePlayer(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey := createTestGame(t, r, "host", nil)
+
+	const joiners = 50
+	statuses := make([]int, joiners)
+	codes := make([]string, joiners)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < joiners; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			req := httptest.NewRequest(http.MethodPost, "/uc2024/join/"+gameKey+"?player_key=joiner-"+strconv.Itoa(i), nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var body APIError
+			json.Unmarshal(w.Body.Bytes(), &body)
+			statuses[i], codes[i] = w.Code, body.Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	seated := 0
+	for i := range statuses {
+		switch {
+		case statuses[i] == http.StatusOK:
+			seated++
+		case statuses[i] != http.StatusForbidden || codes[i] != ErrGameFull.Code:
+			t.Errorf("joiner %d = %d %s, want %d %s", i, statuses[i], codes[i], http.StatusForbidden, ErrGameFull.Code)
+		}
+	}
+	if seated != 1 {
+		t.Errorf("%d joiners were seated, want 1", seated)
+	}
+
+	accessLock.RLock()
+	players := len(activeGames[gameKey].playerIps)
+	accessLock.RUnlock()
+	if players != 2 {
+		t.Errorf("game has %d players, want 2", players)
+	}
+}
+
+func TestMoveSeatAndTurn(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey, players := startTestGame(t, r, nil)
+
+	tests := []struct {
+		name       string
+		playerKey  string
+		wantStatus int
+		wantCode   string
+	}{
+		{"not seated", "stranger", http.StatusForbidden, ErrNotSeated.Code},
+		{"off turn", players[PlayerTeamBlack], http.StatusForbidden, ErrNotYourTurn.Code},
+		{"on turn", players[PlayerTeamWhite], http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {tt.playerKey}, "move": {"e4"}})
+			if status != tt.wantStatus || (len(tt.wantCode) > 0 && body["code"] != tt.wantCode) {
+				t.Errorf("move = %d %v, want %d %s", status, body, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestPlayerKeyFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		playerKey string
+		code      string
+	}{
+		{"empty", "", ErrPlayerKeyEmpty.Code},
+		{"too long", strings.Repeat("k", maxPlayerKeyLength+1), ErrPlayerKeyTooLong.Code},
+		{"space", "player one", ErrInvalidPlayerKey.Code},
+		{"slash", "player/1", ErrInvalidPlayerKey.Code},
+		{"not ascii", "spieler-ä", ErrInvalidPlayerKey.Code},
+		{"longest", strings.Repeat("k", maxPlayerKeyLength), ""},
+		{"url safe", "Player_1.a~b-c", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+			gameKey := createTestGame(t, r, "host", nil)
+
+			for _, path := range []string{"/create", "/join/" + gameKey, "/seek"} {
+				status, body := call(t, r, http.MethodPost, path, url.Values{"player_key": {tt.playerKey}, "chess_variant": {"Standard"}})
+				if len(tt.code) == 0 {
+					if status != http.StatusOK {
+						t.Errorf("%s = %d %v, want %d", path, status, body, http.StatusOK)
+					}
+					continue
+				}
+				if status != http.StatusBadRequest || body["code"] != tt.code {
+					t.Errorf("%s = %d %v, want %d %s", path, status, body, http.StatusBadRequest, tt.code)
+				}
+			}
+		})
+	}
+}
+
+// A game whose host lost their seat, or holds it only as a spectator, is
+// turned away rather than reported with an empty host team
+func TestNoHostTeam(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(game *ActiveGame)
+	}{
+		{"seat removed", func(game *ActiveGame) {
+			delete(game.playerIps, game.host)
+		}},
+		{"spectator seat", func(game *ActiveGame) {
+			game.playerIps[game.host] = PlayerTeamSpectator
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+			gameKey := createTestGame(t, r, "host", nil)
+			game := activeGames[gameKey]
+			tt.corrupt(&game)
+			activeGames[gameKey] = game
+
+			status, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+			if status != http.StatusInternalServerError || body["code"] != ErrNoHostTeam.Code {
+				t.Errorf("game = %d %v, want %d %s", status, body, http.StatusInternalServerError, ErrNoHostTeam.Code)
+			}
+
+			status, body = call(t, r, http.MethodPost, "/join/"+gameKey, url.Values{"player_key": {"guest"}})
+			if status != http.StatusConflict || body["code"] != ErrNoHostTeam.Code {
+				t.Errorf("join = %d %v, want %d %s", status, body, http.StatusConflict, ErrNoHostTeam.Code)
+			}
+			if _, seated := activeGames[gameKey].playerIps["guest"]; seated {
+				t.Error("guest seated in a game with no host")
+			}
+		})
+	}
+}
+
+// Every action on a finished game says how it ended
+func TestActionsAfterGameOver(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey, players := startTestGame(t, r, nil)
+	playMoves(t, r, gameKey, players, "e4", "e5")
+	if status, body := call(t, r, http.MethodPost, "/resign/"+gameKey, url.Values{"player_key": {players[PlayerTeamWhite]}}); status != http.StatusOK {
+		t.Fatalf("resign: %d %v", status, body)
+	}
+
+	tests := []struct {
+		path string
+		team PlayerTeam
+		move string
+	}{
+		{"/move/", PlayerTeamWhite, "Nf3"},
+		{"/premove/", PlayerTeamBlack, "Nc6"},
+		{"/resign/", PlayerTeamBlack, ""},
+		{"/takeback/", PlayerTeamBlack, ""},
+	}
+
+	for _, tt := range tests {
+		status, body := call(t, r, http.MethodPost, tt.path+gameKey, url.Values{"player_key": {players[tt.team]}, "move": {tt.move}})
+		if status != http.StatusForbidden || body["code"] != ErrGameOver.Code {
+			t.Errorf("%s = %d %v, want %d %s", tt.path, status, body, http.StatusForbidden, ErrGameOver.Code)
+			continue
+		}
+		if body["result"] != string(GameResultBlack) || body["termination"] != string(TerminationResign) {
+			t.Errorf("%s game over = %v, want black winning by %s", tt.path, body, TerminationResign)
+		}
+	}
+}
+
+func TestFinalMove(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey, players := startTestGame(t, r, nil)
+	playMoves(t, r, gameKey, players, "f3", "e5", "g4")
+
+	status, body := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {players[PlayerTeamBlack]}, "move": {"Qh4"}})
+	if status != http.StatusOK || body["game_complete"] != true {
+		t.Fatalf("mating move = %d %v, want the game over", status, body)
+	}
+
+	mated := testGame("Standard", "f3", "e5", "g4", "Qh4")
+	want := map[string]any{"index": float64(3), "san": "Qh4", "fen": mated.board().String()}
+	if got := body["final_move"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("move final_move = %v, want %v", got, want)
+	}
+	_, body = call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if got := body["final_move"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("game final_move = %v, want %v", got, want)
+	}
+
+	status, body = call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {players[PlayerTeamWhite]}, "move": {"Kf2"}})
+	if status != http.StatusForbidden || body["code"] != ErrGameOver.Code || body["result"] != string(GameResultBlack) || body["termination"] != string(TerminationCheckmate) {
+		t.Errorf("move after mate = %d %v, want %d %s by %s", status, body, http.StatusForbidden, ErrGameOver.Code, TerminationCheckmate)
+	}
+}
+
+func TestNoFinalMoveOnResign(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey, players := startTestGame(t, r, nil)
+	playMoves(t, r, gameKey, players, "e4")
+	if status, body := call(t, r, http.MethodPost, "/resign/"+gameKey, url.Values{"player_key": {players[PlayerTeamBlack]}}); status != http.StatusOK {
+		t.Fatalf("resign: %d %v", status, body)
+	}
+
+	_, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if got := body["final_move"]; got != nil {
+		t.Errorf("final_move after resigning = %v, want none", got)
+	}
+}
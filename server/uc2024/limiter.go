@@ -0,0 +1,65 @@
+package uc2024
+
+import (
+	"sync"
+	"time"
+)
+
+type lookupRecord struct {
+	misses       int
+	lastMiss     time.Time
+	blockedUntil time.Time
+}
+
+// failedLookups tracks clients that keep asking for games that don't exist.
+// Honest clients get a fast 404 for the odd typo, only clients that keep
+// missing are blocked, and for longer each time they miss again.
+var lookupLock *sync.Mutex = &sync.Mutex{}
+var failedLookups map[string]lookupRecord = make(map[string]lookupRecord)
+
+func lookupBlocked(ip string) bool {
+	if config.FailedLookupThreshold <= 0 {
+		return false
+	}
+
+	lookupLock.Lock()
+	defer lookupLock.Unlock()
+	record, ok := failedLookups[ip]
+	return ok && now().Before(record.blockedUntil)
+}
+
+func recordFailedLookup(ip string) {
+	if config.FailedLookupThreshold <= 0 {
+		return
+	}
+
+	lookupLock.Lock()
+	defer lookupLock.Unlock()
+	now := now()
+	record := failedLookups[ip]
+	if now.Sub(record.lastMiss) > config.FailedLookupWindow {
+		record.misses = 0
+	}
+	record.misses++
+	record.lastMiss = now
+
+	if over := record.misses - config.FailedLookupThreshold; over > 0 {
+		backoff := config.FailedLookupBackoff
+		for i := 1; i < over && backoff < config.FailedLookupMaxBackoff; i++ {
+			backoff *= 2
+		}
+		record.blockedUntil = now.Add(min(backoff, config.FailedLookupMaxBackoff))
+	}
+
+	failedLookups[ip] = record
+}
+
+func purgeFailedLookups() {
+	lookupLock.Lock()
+	defer lookupLock.Unlock()
+	for ip, record := range failedLookups {
+		if since(record.lastMiss) > config.FailedLookupWindow && now().After(record.blockedUntil) {
+			delete(failedLookups, ip)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package uc2024
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys handlers fill in so the request log can say which game and
+// player a request was about
+const (
+	logGameKey    = "log_game_key"
+	logTeam       = "log_team"
+	logMoveNumber = "log_move_number"
+	logErrorCode  = "log_error_code"
+	// The variant asked for when it was rejected
+	logChessVariant = "log_chess_variant"
+)
+
+var logger *slog.Logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// hashPlayerKey lets log lines for the same player be matched up without
+// writing the key itself anywhere
+func hashPlayerKey(playerKey string) string {
+	if len(playerKey) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(playerKey))
+	return hex.EncodeToString(sum[:6])
+}
+
+// requestLogger logs every mutating request once it has been handled
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if c.Request.Method == http.MethodGet {
+			return
+		}
+
+		gameKey := c.GetString(logGameKey)
+		if len(gameKey) == 0 {
+			gameKey = c.Param("game_key")
+		}
+
+		attrs := []any{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.FullPath()),
+			slog.Int("status", c.Writer.Status()),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", c.ClientIP()),
+			slog.String("game_key", gameKey),
+			slog.String("player", hashPlayerKey(getPlayerKey(c))),
+		}
+		if team := c.GetString(logTeam); len(team) > 0 {
+			attrs = append(attrs, slog.String("team", team))
+		}
+		if moveNumber, ok := c.Get(logMoveNumber); ok {
+			attrs = append(attrs, slog.Any("move_number", moveNumber))
+		}
+		if code := c.GetString(logErrorCode); len(code) > 0 {
+			attrs = append(attrs, slog.String("error", code))
+		}
+		if chessVariant, ok := c.Get(logChessVariant); ok {
+			attrs = append(attrs, slog.Any("chess_variant", chessVariant))
+		}
+
+		logger.Info("request", attrs...)
+	}
+}
@@ -0,0 +1,205 @@
+package uc2024
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+// Accepted move grammar, matched after casing has been normalised:
+//
+//	castle: O-O | O-O-O
+//	piece:  [KQRBN] [a-h1-8]{0,4} x? [a-h][1-8]
+//	pawn:   ([a-h] x)? [a-h][1-8] (=[QRBN])?
+//
+// each optionally followed by a single + or #. Up to four disambiguation
+// characters are allowed since the game client repeats them when more than
+// one other piece can reach the target square. Castling may be written with
+// zeros, and piece letters, files and the capture x may be in any case.
+// Variants with drops also take those, see dropGrammar.
+var moveGrammar = regexp.MustCompile(`^(O-O(-O)?|[KQRBN][a-h1-8]{0,4}x?[a-h][1-8]|([a-h]x)?[a-h][1-8](=[QRBN])?)[+#]?$`)
+
+// normalizeCasing gives the move with files lower case and piece letters
+// upper case. Only a leading b is ambiguous between a pawn on the b file and
+// a bishop, so it can give two spellings, the client's own reading first.
+func normalizeCasing(move string) []string {
+	upper := strings.ToUpper(move)
+	castle := strings.ReplaceAll(upper, "0", "O")
+	if base := strings.TrimRight(castle, "+#"); base == "O-O" || base == "O-O-O" {
+		return []string{castle}
+	}
+
+	rest := strings.ToLower(move[1:])
+	if i := strings.Index(rest, "="); i >= 0 {
+		rest = rest[:i] + strings.ToUpper(rest[i:])
+	}
+
+	switch upper[0] {
+	case 'K', 'Q', 'R', 'N':
+		return []string{upper[:1] + rest}
+	case 'B':
+		bishop := "B" + rest
+		pawn := "b" + rest
+		if move[0] == 'B' {
+			return []string{bishop, pawn}
+		}
+		return []string{pawn, bishop}
+	default:
+		return []string{strings.ToLower(move[:1]) + rest}
+	}
+}
+
+func teamColor(team PlayerTeam) pgn.Color {
+	if team == PlayerTeamWhite {
+		return pgn.White
+	}
+	return pgn.Black
+}
+
+// replayBoard plays the game so far on a pgn board. It gives nil when the
+// variant isn't supported or pgn can't follow one of the moves, in which
+// case moves are only checked against the grammar.
+func replayBoard(chessVariant string, moves []string) *pgn.Board {
+	fen := variantRules(chessVariant).InitialFEN(chessVariant)
+	if len(fen) == 0 {
+		return nil
+	}
+
+	board, err := pgn.NewBoardFEN(fen)
+	if err != nil {
+		return nil
+	}
+
+	rules := variantRules(chessVariant)
+	team := PlayerTeamWhite
+	for _, move := range moves {
+		if err := rules.PlayMove(board, move, team); err != nil {
+			return nil
+		}
+		team = team.opponent()
+	}
+
+	return board
+}
+
+// normalizeMove fixes the casing of a move, using the board to pick between
+// spellings when it can follow the game. The move is rejected if no spelling
+// matches the grammar. A move no spelling of which pgn can make is kept, so
+// the variant's rules report it as illegal rather than malformed.
+func normalizeMove(game *ActiveGame, move string) (string, bool) {
+	if len(move) == 0 {
+		return "", false
+	}
+
+	// Drops are left for the variant to check against the pockets
+	if drop, ok := normalizeDrop(game.chessVariant, move); ok {
+		return drop, true
+	}
+
+	var candidates []string
+	for _, candidate := range normalizeCasing(move) {
+		if moveGrammar.MatchString(candidate) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	board := game.board()
+	if board == nil {
+		return candidates[0], true
+	}
+
+	team := moveTeam(len(game.moves))
+	for _, candidate := range candidates {
+		if _, err := board.MoveFromAlgebraic(candidate, teamColor(team)); err == nil {
+			return candidate, true
+		}
+	}
+
+	return candidates[0], true
+}
+
+// boardCache is the pgn board after the first moves moves of the game, so
+// it doesn't have to be replayed from the start for every request
+type boardCache struct {
+	board *pgn.Board
+	moves int
+	// The last move played on board and the FEN it left, so a cache that
+	// drifted from the move list is caught instead of trusted
+	last string
+	fen  string
+}
+
+// inStep is whether the cache still holds the position after moves. The
+// board is shared by every copy of the game, so a move played on it that
+// never made it into a saved game shows up as a changed FEN.
+func (cache boardCache) inStep(moves []string) bool {
+	if cache.board == nil || cache.moves != len(moves) {
+		return false
+	}
+	if cache.moves > 0 && cache.last != moves[cache.moves-1] {
+		return false
+	}
+	return cache.board.String() == cache.fen
+}
+
+// rebuildBoard replays the move list into a fresh cache
+func (game *ActiveGame) rebuildBoard() {
+	cache := boardCache{
+		board: replayBoard(game.chessVariant, game.moves),
+		moves: len(game.moves),
+	}
+	if cache.board != nil {
+		cache.fen = cache.board.String()
+		if cache.moves > 0 {
+			cache.last = game.moves[cache.moves-1]
+		}
+	}
+	game.boardCache = cache
+}
+
+// repairBoardCache rebuilds the cache when it claims to be at the current
+// move but no longer matches the move list, which is true when it had to.
+// A cache that is only behind is left for board to catch up.
+func (game *ActiveGame) repairBoardCache() bool {
+	cache := game.boardCache
+	if cache.board == nil || cache.moves != len(game.moves) || cache.inStep(game.moves) {
+		return false
+	}
+
+	logger.Warn("board cache diverged from moves, rebuilding", "game_key", game.key, "moves", len(game.moves))
+	game.rebuildBoard()
+	return true
+}
+
+// board gives the current position, or nil when pgn can't follow the game
+func (game *ActiveGame) board() *pgn.Board {
+	if game.boardCache.inStep(game.moves) {
+		return game.boardCache.board
+	}
+
+	if !game.repairBoardCache() {
+		game.rebuildBoard()
+	}
+	return game.boardCache.board
+}
+
+// playOnBoard keeps the cache in step with a move that was just appended.
+// If the cache is stale it is left for board to rebuild.
+func (game *ActiveGame) playOnBoard(move string) {
+	cache := &game.boardCache
+	if !cache.inStep(game.moves[:len(game.moves)-1]) {
+		return
+	}
+
+	if err := variantRules(game.chessVariant).PlayMove(cache.board, move, moveTeam(cache.moves)); err != nil {
+		*cache = boardCache{}
+		return
+	}
+	cache.moves++
+	cache.last = move
+	cache.fen = cache.board.String()
+}
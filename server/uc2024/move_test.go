@@ -0,0 +1,129 @@
+package uc2024
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCasing(t *testing.T) {
+	tests := []struct {
+		move string
+		want []string
+	}{
+		{"e4", []string{"e4"}},
+		{"E4", []string{"e4"}},
+		{"nf3", []string{"Nf3"}},
+		{"NF3", []string{"Nf3"}},
+		{"qxD7+", []string{"Qxd7+"}},
+		{"EXD5", []string{"exd5"}},
+		{"Nbd2", []string{"Nbd2"}},
+		{"e8=q", []string{"e8=Q"}},
+		{"exf8=n#", []string{"exf8=N#"}},
+		{"0-0", []string{"O-O"}},
+		{"o-o-o", []string{"O-O-O"}},
+		{"0-0+", []string{"O-O+"}},
+		// A leading b is read the way the client wrote it first
+		{"bc4", []string{"bc4", "Bc4"}},
+		{"Bc4", []string{"Bc4", "bc4"}},
+		{"bxc3", []string{"bxc3", "Bxc3"}},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeCasing(tt.move); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeCasing(%q) = %q, want %q", tt.move, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeMove(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves []string
+		move  string
+		want  string
+		ok    bool
+	}{
+		{"pawn", nil, "E4", "e4", true},
+		{"knight", nil, "nf3", "Nf3", true},
+		{"b pawn", nil, "b4", "b4", true},
+		{"bishop written as a pawn", []string{"e4", "e5"}, "bc4", "Bc4", true},
+		{"bishop", []string{"e4", "e5"}, "BC4", "Bc4", true},
+		{"b pawn capture", []string{"b4", "c5"}, "bxc5", "bxc5", true},
+		{"castle with zeros", []string{"e4", "e5", "Nf3", "Nc6", "Bc4", "Nf6"}, "0-0", "O-O", true},
+		{"check suffix", []string{"e4", "f6"}, "qh5+", "Qh5+", true},
+		// Kept for the variant's rules to call illegal
+		{"illegal", nil, "Qh5", "Qh5", true},
+		{"not a move", nil, "zz9", "", false},
+		{"empty", nil, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := testGame("Standard", tt.moves...)
+			got, ok := normalizeMove(&game, tt.move)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("normalizeMove(%q) = %q, %t, want %q, %t", tt.move, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPostMoveRepairsBoardCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(game *ActiveGame)
+	}{
+		{"changed FEN", func(game *ActiveGame) {
+			// Nf3 on the shared board makes the move under test illegal
+			if err := variantRules(game.chessVariant).PlayMove(game.boardCache.board, "Nf3", PlayerTeamWhite); err != nil {
+				t.Fatalf("corrupting board: %v", err)
+			}
+		}},
+		{"mismatched last move", func(game *ActiveGame) {
+			game.boardCache.last = "d5"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := logger
+			logger = slog.New(slog.NewJSONHandler(&logs, nil))
+			t.Cleanup(func() { logger = previous })
+
+			r := newTestServer(t, nil)
+			gameKey, players := startTestGame(t, r, nil)
+			playMoves(t, r, gameKey, players, "e4", "e5")
+
+			game := activeGames[gameKey]
+			if !game.boardCache.inStep(game.moves) {
+				t.Fatal("board cache out of step before corrupting it")
+			}
+			tt.corrupt(&game)
+			activeGames[gameKey] = game
+			logs.Reset()
+
+			status, body := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {players[PlayerTeamWhite]}, "move": {"Nf3"}})
+			if status != http.StatusOK {
+				t.Fatalf("move after corrupting cache = %d %v", status, body)
+			}
+			if !strings.Contains(logs.String(), "board cache diverged") {
+				t.Errorf("no warning logged for the rebuilt cache: %s", logs.String())
+			}
+
+			game = activeGames[gameKey]
+			if !game.boardCache.inStep(game.moves) {
+				t.Error("board cache out of step after the move")
+			}
+			want := replayBoard(game.chessVariant, game.moves).String()
+			if got := game.boardCache.board.String(); got != want {
+				t.Errorf("cached board = %s, want %s", got, want)
+			}
+		})
+	}
+}
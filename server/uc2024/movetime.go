@@ -0,0 +1,102 @@
+package uc2024
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The side to move took longer than the game's move time limit
+const TerminationMoveTimeout Termination = "move_timeout"
+
+// ClockMode is how the side to move is timed
+type ClockMode string
+
+const (
+	// Moves are only limited by move_time_limit when it is given
+	ClockModeNone ClockMode = "none"
+	// No main time, every move gets the increment and going over it on any
+	// one move forfeits. Takebacks are off so a move can't be replayed with
+	// a fresh budget.
+	ClockModeIncrement ClockMode = "increment"
+)
+
+// secondsParam reads an optional whole number of seconds, zero when left
+// out
+func secondsParam(c *gin.Context, name string) (time.Duration, bool) {
+	raw, ok := getParam(c, name)
+	if !ok {
+		return 0, true
+	}
+
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// moveClock reads the clock_mode and the time each move may take. Without a
+// mode the optional move_time_limit caps each move, zero meaning moves can
+// take as long as the inactivity timeout. The increment mode takes its
+// budget from clock_increment instead.
+func moveClock(c *gin.Context) (ClockMode, time.Duration, bool) {
+	limit, ok := secondsParam(c, "move_time_limit")
+	if !ok {
+		return "", 0, false
+	}
+
+	switch mode := ClockMode(param(c, "clock_mode")); mode {
+	case "", ClockModeNone:
+		return ClockModeNone, limit, true
+	case ClockModeIncrement:
+		increment, ok := secondsParam(c, "clock_increment")
+		if !ok || increment <= 0 || limit > 0 {
+			return "", 0, false
+		}
+		return mode, increment, true
+	}
+	return "", 0, false
+}
+
+// moveTimeRemaining is how long the side to move has left to move. It is
+// false when the game has no limit or the clock isn't running yet.
+func (game *ActiveGame) moveTimeRemaining() (time.Duration, bool) {
+	if game.moveTimeLimit <= 0 || game.gameOver || len(game.playerIps) < 2 {
+		return 0, false
+	}
+	return game.moveTimeLimit - since(game.turnStarted), true
+}
+
+// forfeitIfOutOfTime ends the game against the side to move once they are
+// past the limit. It is true when the game was forfeited.
+func (game *ActiveGame) forfeitIfOutOfTime() bool {
+	remaining, limited := game.moveTimeRemaining()
+	if !limited || remaining > 0 {
+		return false
+	}
+
+	game.finish(GameResult(moveTeam(len(game.moves)).opponent()), TerminationMoveTimeout)
+	return true
+}
+
+// forfeitSlowMoves checks every game's move deadline once
+func forfeitSlowMoves() {
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	for _, game := range activeGames {
+		if game.forfeitIfOutOfTime() {
+			saveGame(game)
+		}
+	}
+}
+
+// forfeitSlowMovesLoop runs far more often than the purge so a forfeit lands
+// close to the deadline
+func forfeitSlowMovesLoop() {
+	for {
+		time.Sleep(1 * time.Second)
+		forfeitSlowMoves()
+	}
+}
@@ -0,0 +1,59 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMoveTimeForfeit(t *testing.T) {
+	limit := url.Values{"move_time_limit": {"10"}}
+	increment := url.Values{"clock_mode": {string(ClockModeIncrement)}, "clock_increment": {"10"}}
+	tests := []struct {
+		name   string
+		params url.Values
+		wait   time.Duration
+		// Whether the slow move is caught by the sweep rather than by the
+		// move itself
+		sweep   bool
+		forfeit bool
+	}{
+		{"inside the limit", limit, 9 * time.Second, false, false},
+		{"past the limit on move", limit, 11 * time.Second, false, true},
+		{"past the limit on sweep", limit, 11 * time.Second, true, true},
+		{"inside the increment", increment, 9 * time.Second, false, false},
+		{"past the increment", increment, 10 * time.Second, false, true},
+		{"no limit", nil, time.Hour, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock()
+			r := newTestServer(t, func(cfg *Config) {
+				cfg.Clock = clock
+			})
+			gameKey, players := startTestGame(t, r, tt.params)
+			playMoves(t, r, gameKey, players, "e4")
+
+			clock.advance(tt.wait)
+			if tt.sweep {
+				forfeitSlowMoves()
+			}
+			status, body := call(t, r, http.MethodPost, "/move/"+gameKey, url.Values{"player_key": {players[PlayerTeamBlack]}, "move": {"e5"}})
+
+			if !tt.forfeit {
+				if status != http.StatusOK {
+					t.Errorf("move = %d %v, want %d", status, body, http.StatusOK)
+				}
+				return
+			}
+			if status != http.StatusForbidden || body["code"] != ErrGameOver.Code {
+				t.Fatalf("move = %d %v, want %d %s", status, body, http.StatusForbidden, ErrGameOver.Code)
+			}
+			if body["result"] != string(GameResultWhite) || body["termination"] != string(TerminationMoveTimeout) {
+				t.Errorf("game over = %v, want white winning on %s", body, TerminationMoveTimeout)
+			}
+		})
+	}
+}
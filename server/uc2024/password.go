@@ -0,0 +1,41 @@
+package uc2024
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+)
+
+// gamePassword keeps a salted hash of a private game's password, the
+// password itself is never stored
+type gamePassword struct {
+	salt []byte
+	hash []byte
+}
+
+func hashPassword(salt []byte, password string) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, salt...), password...))
+	return sum[:]
+}
+
+func newGamePassword(password string) *gamePassword {
+	if len(password) == 0 {
+		return nil
+	}
+
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return &gamePassword{
+		salt: salt,
+		hash: hashPassword(salt, password),
+	}
+}
+
+// matches is true for games without a password
+func (p *gamePassword) matches(password string) bool {
+	if p == nil {
+		return true
+	}
+
+	return subtle.ConstantTimeCompare(p.hash, hashPassword(p.salt, password)) == 1
+}
@@ -0,0 +1,137 @@
+package uc2024
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formattedMoveTimes gives when each move was received, nil for games that
+// came from storage before times were kept
+func (game *ActiveGame) formattedMoveTimes() []string {
+	if len(game.moveTimes) != len(game.moves) {
+		return nil
+	}
+
+	formatted := make([]string, len(game.moveTimes))
+	for i, t := range game.moveTimes {
+		formatted[i] = t.UTC().Format(time.RFC3339Nano)
+	}
+	return formatted
+}
+
+// thinkTime is how long the player took over the move at index. It's false
+// when the times aren't known.
+func (game *ActiveGame) thinkTime(index int) (time.Duration, bool) {
+	if len(game.moveTimes) != len(game.moves) {
+		return 0, false
+	}
+
+	previous := game.readyTime
+	if index > 0 {
+		previous = game.moveTimes[index-1]
+	}
+	if previous.IsZero() {
+		return 0, false
+	}
+	return max(game.moveTimes[index].Sub(previous), 0), true
+}
+
+func pgnResult(game *ActiveGame) string {
+	if !game.gameOver {
+		return "*"
+	}
+
+	switch game.result {
+	case GameResultWhite:
+		return "1-0"
+	case GameResultBlack:
+		return "0-1"
+	case GameResultDraw:
+		return "1/2-1/2"
+	}
+	return "*"
+}
+
+// pgnDuration writes a duration as H:MM:SS the way clock comments expect
+func pgnDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// gamePGN exports the game with each move's think time as a %emt comment.
+// There are no server side clocks so %clk is never written.
+func gamePGN(game *ActiveGame) string {
+	result := pgnResult(game)
+	names := map[PlayerTeam]string{}
+	for _, team := range []PlayerTeam{PlayerTeamWhite, PlayerTeamBlack} {
+		names[team] = game.playerNames[team]
+		if len(names[team]) == 0 {
+			names[team] = "?"
+		}
+	}
+
+	var b strings.Builder
+	tag := func(name string, value string) {
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		value = strings.ReplaceAll(value, `"`, `\"`)
+		fmt.Fprintf(&b, "[%s \"%s\"]\n", name, value)
+	}
+	tag("Event", "Ultimate Chess 2024")
+	tag("Site", game.key)
+	tag("Date", game.startTime.UTC().Format("2006.01.02"))
+	tag("White", names[PlayerTeamWhite])
+	tag("Black", names[PlayerTeamBlack])
+	tag("Result", result)
+	if name := variantName(game.chessVariant); name != "Standard" {
+		tag("Variant", name)
+	}
+	if len(game.termination) > 0 {
+		tag("Termination", string(game.termination))
+	}
+	b.WriteString("\n")
+
+	commented := false
+	for i, move := range game.moves {
+		// Black's move needs its number again when a comment came between
+		if i%2 == 0 {
+			fmt.Fprintf(&b, "%d. ", i/2+1)
+		} else if commented {
+			fmt.Fprintf(&b, "%d... ", i/2+1)
+		}
+		b.WriteString(move)
+
+		think, ok := game.thinkTime(i)
+		if ok {
+			fmt.Fprintf(&b, " { [%%emt %s] }", pgnDuration(think))
+		}
+		commented = ok
+		b.WriteString(" ")
+	}
+	b.WriteString(result)
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+func getGamePGN(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/x-chess-pgn; charset=utf-8", []byte(gamePGN(&game)))
+}
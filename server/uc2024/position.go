@@ -0,0 +1,40 @@
+package uc2024
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+// positionHash identifies the position on the board so clients can tell a
+// move apart from a change to the game around it. It is the first 16 hex
+// characters of the SHA-256 of the first four FEN fields (placement, side to
+// move, castling and en passant) followed by each side's pocket for drop
+// variants, written as " white:P1N2 black:" in PNBRQ order. The move
+// counters are left out so a position reached again hashes the same. It is
+// nil when pgn can't follow the game.
+func positionHash(board *pgn.Board, pockets map[PlayerTeam]Pocket) *string {
+	if board == nil {
+		return nil
+	}
+
+	fields := strings.Fields(board.String())
+	position := strings.Join(fields[:min(len(fields), 4)], " ")
+	if pockets != nil {
+		for _, team := range []PlayerTeam{PlayerTeamWhite, PlayerTeamBlack} {
+			position += " " + string(team) + ":"
+			for _, piece := range "PNBRQ" {
+				if count := pockets[team][string(piece)]; count > 0 {
+					position += fmt.Sprintf("%c%d", piece, count)
+				}
+			}
+		}
+	}
+
+	sum := sha256.Sum256([]byte(position))
+	hash := hex.EncodeToString(sum[:8])
+	return &hash
+}
@@ -0,0 +1,87 @@
+package uc2024
+
+import "testing"
+
+// gameHash is the position hash a game response would carry
+func gameHash(t *testing.T, chessVariant string, moves ...string) string {
+	t.Helper()
+	game := testGame(chessVariant, moves...)
+	var pockets map[PlayerTeam]Pocket
+	if drops, ok := variantRules(chessVariant).(dropVariant); ok {
+		pockets = drops.Pockets(chessVariant, game.moves)
+	}
+	hash := positionHash(game.board(), pockets)
+	if hash == nil {
+		t.Fatalf("no hash for %s %v", chessVariant, moves)
+	}
+	return *hash
+}
+
+func TestPositionHashStable(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+	}{
+		{"same moves", []string{"e4", "e5"}, []string{"e4", "e5"}},
+		{"transposition", []string{"Nf3", "Nc6", "Nc3"}, []string{"Nc3", "Nc6", "Nf3"}},
+		// Only the move clocks differ from the start
+		{"back to the start", nil, []string{"Nf3", "Nf6", "Ng1", "Ng8"}},
+	}
+
+	for _, tt := range tests {
+		if a, b := gameHash(t, "Standard", tt.a...), gameHash(t, "Standard", tt.b...); a != b {
+			t.Errorf("%s: hash %s after %v, %s after %v", tt.name, a, tt.a, b, tt.b)
+		}
+	}
+}
+
+func TestPositionHashChanges(t *testing.T) {
+	seen := map[string]int{}
+	moves := []string{"e4", "e5", "Nf3", "Nc6"}
+	for i := 0; i <= len(moves); i++ {
+		hash := gameHash(t, "Standard", moves[:i]...)
+		if previous, ok := seen[hash]; ok {
+			t.Errorf("hash after %d moves matches the one after %d", i, previous)
+		}
+		seen[hash] = i
+	}
+
+	// Same squares, different side to move
+	if gameHash(t, "Standard", "Nf3", "Nf6", "Ng1") == gameHash(t, "Standard", "Nf3") {
+		t.Error("hash ignores the side to move")
+	}
+}
+
+func TestPositionHashPockets(t *testing.T) {
+	game := testGame("Crazyhouse")
+	board := game.board()
+	empty := *positionHash(board, map[PlayerTeam]Pocket{})
+	tests := []map[PlayerTeam]Pocket{
+		{PlayerTeamWhite: {"P": 1}},
+		{PlayerTeamBlack: {"P": 1}},
+		{PlayerTeamWhite: {"P": 2}},
+		{PlayerTeamWhite: {"N": 1}},
+	}
+
+	seen := map[string]bool{empty: true}
+	for _, pockets := range tests {
+		hash := *positionHash(board, pockets)
+		if seen[hash] {
+			t.Errorf("pockets %v hash the same as another pocket", pockets)
+		}
+		seen[hash] = true
+	}
+
+	// The capture puts a pawn in white's pocket, so the board alone isn't
+	// the whole position
+	game = testGame("Crazyhouse", "e4", "d5", "exd5")
+	if gameHash(t, "Crazyhouse", game.moves...) == *positionHash(game.board(), nil) {
+		t.Error("Crazyhouse hash ignores the pockets")
+	}
+}
+
+func TestPositionHashNoBoard(t *testing.T) {
+	if hash := positionHash(nil, nil); hash != nil {
+		t.Errorf("positionHash(nil) = %s, want nil", *hash)
+	}
+}
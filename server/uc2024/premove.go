@@ -0,0 +1,147 @@
+package uc2024
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sent only to the premover when their premove couldn't be played
+const EventPremoveDiscarded EventType = "premove_discarded"
+
+// playPremove plays the side to move's premove if they queued one. A premove
+// the new position doesn't allow is dropped and the premover is told.
+func (game *ActiveGame) playPremove() {
+	team := moveTeam(len(game.moves))
+	premove, ok := game.premoves[team]
+	if !ok || game.gameOver {
+		return
+	}
+	delete(game.premoves, team)
+
+	if move, ok := normalizeMove(game, premove); ok && checkVariantMove(game, move) == nil {
+		game.applyMove(move)
+		return
+	}
+
+	game.record(GameLogEntry{
+		Type:       GameLogPremoveDiscarded,
+		Team:       team,
+		Move:       premove,
+		MoveNumber: len(game.moves),
+	})
+	publishTo(Event{
+		Type:    EventPremoveDiscarded,
+		GameKey: game.key,
+		Move:    premove,
+		Team:    team,
+	}, team)
+}
+
+// matchesMoveGrammar checks the move could be a move at all, whether it is
+// legal can only be known once it is played
+func matchesMoveGrammar(chessVariant string, move string) bool {
+	if len(move) == 0 {
+		return false
+	}
+	if _, ok := normalizeDrop(chessVariant, move); ok {
+		return true
+	}
+	for _, candidate := range normalizeCasing(move) {
+		if moveGrammar.MatchString(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// postPremove queues a move for the player to be played the moment their
+// opponent moves, replacing any premove they already had
+func postPremove(c *gin.Context) {
+	gameKey := c.Param("game_key")
+	move := param(c, "move")
+
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	if game.gameOver {
+		forbidden(c, gameOverError(&game))
+		return
+	}
+
+	if len(move) > config.maxMoveLength(game.chessVariant) {
+		forbidden(c, ErrMoveTooLong)
+		return
+	}
+
+	team, seated := game.playerIps[getPlayerKey(c)]
+	if !seated {
+		forbidden(c, ErrNotSeated)
+		return
+	}
+
+	if len(game.playerIps) < 2 {
+		conflict(c, ErrGameNotReady)
+		return
+	}
+
+	if moveTeam(len(game.moves)) == team {
+		conflict(c, ErrPremoveOnTurn)
+		return
+	}
+
+	if !matchesMoveGrammar(game.chessVariant, move) {
+		badRequest(c, ErrInvalidMove)
+		return
+	}
+
+	game.premoves[team] = move
+	saveGame(game)
+	c.Set(logTeam, string(team))
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"premove": move,
+	})
+}
+
+// deletePremove cancels the player's premove if they have one
+func deletePremove(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	team, seated := game.playerIps[getPlayerKey(c)]
+	if !seated {
+		forbidden(c, ErrNotSeated)
+		return
+	}
+
+	delete(game.premoves, team)
+	saveGame(game)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
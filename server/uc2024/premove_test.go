@@ -0,0 +1,110 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// premove queues move for playerKey, failing the test if it's turned down
+func premove(t *testing.T, r http.Handler, gameKey string, playerKey string, move string) {
+	t.Helper()
+	status, body := call(t, r, http.MethodPost, "/premove/"+gameKey, url.Values{"player_key": {playerKey}, "move": {move}})
+	if status != http.StatusOK {
+		t.Fatalf("premove %s: %d %v", move, status, body)
+	}
+}
+
+func TestPremovePlayed(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey, players := startTestGame(t, r, nil)
+
+	premove(t, r, gameKey, players[PlayerTeamBlack], "e5")
+	playMoves(t, r, gameKey, players, "e4")
+
+	_, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if got, want := gameMoves(body), []any{"e4", "e5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("moves = %v, want %v", got, want)
+	}
+
+	// Used up, so white's next move leaves black on move
+	playMoves(t, r, gameKey, players, "Nf3")
+	_, body = call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if got := gameMoves(body); len(got) != 3 {
+		t.Errorf("moves after the premove = %v, want 3", got)
+	}
+}
+
+func TestPremoveDiscarded(t *testing.T) {
+	r := newTestServer(t, nil)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	gameKey, players := startTestGame(t, r, nil)
+	conn := subscribe(t, server, gameKey, players[PlayerTeamBlack])
+
+	// Only legal if white opens with d4
+	premove(t, r, gameKey, players[PlayerTeamBlack], "exd4")
+	playMoves(t, r, gameKey, players, "e4")
+
+	event := nextEvent(t, conn, EventPremoveDiscarded)
+	if event.GameKey != gameKey || event.Move != "exd4" || event.Team != PlayerTeamBlack {
+		t.Errorf("discard event = %+v, want black's exd4", event)
+	}
+
+	_, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if got, want := gameMoves(body), []any{"e4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("moves = %v, want %v", got, want)
+	}
+	if types, _ := logTypes(gameKey); !slices.Contains(types, GameLogPremoveDiscarded) {
+		t.Errorf("log %v has no discarded premove", types)
+	}
+
+	// Black still gets to move
+	playMoves(t, r, gameKey, players, "e5")
+}
+
+func TestPremoveCancelled(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey, players := startTestGame(t, r, nil)
+
+	premove(t, r, gameKey, players[PlayerTeamBlack], "e5")
+	status, body := call(t, r, http.MethodDelete, "/premove/"+gameKey, url.Values{"player_key": {players[PlayerTeamBlack]}})
+	if status != http.StatusOK {
+		t.Fatalf("cancel premove: %d %v", status, body)
+	}
+	playMoves(t, r, gameKey, players, "e4")
+
+	_, body = call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if got, want := gameMoves(body), []any{"e4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("moves = %v, want %v", got, want)
+	}
+}
+
+func TestPremoveRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		team   PlayerTeam
+		move   string
+		status int
+		code   string
+	}{
+		{"on turn", PlayerTeamWhite, "e4", http.StatusConflict, ErrPremoveOnTurn.Code},
+		{"not a move", PlayerTeamBlack, "zz9", http.StatusBadRequest, ErrInvalidMove.Code},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+			gameKey, players := startTestGame(t, r, nil)
+
+			status, body := call(t, r, http.MethodPost, "/premove/"+gameKey, url.Values{"player_key": {players[tt.team]}, "move": {tt.move}})
+			if status != tt.status || body["code"] != tt.code {
+				t.Errorf("premove %s = %d %v, want %d %s", tt.move, status, body, tt.status, tt.code)
+			}
+		})
+	}
+}
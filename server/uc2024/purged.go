@@ -0,0 +1,82 @@
+package uc2024
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Why a game still in progress was purged
+	TerminationInactivity Termination = "inactivity"
+	TerminationTimeLimit  Termination = "time_limit"
+	TerminationAdminPurge Termination = "admin_purge"
+)
+
+// purgedGame remembers a purged game for a while so its players get told it
+// expired rather than that the key never existed
+type purgedGame struct {
+	result      GameResult
+	termination Termination
+	purgedAt    time.Time
+}
+
+// purgedGames is guarded by accessLock
+var purgedGames map[string]purgedGame = make(map[string]purgedGame)
+
+// purgeGame removes the game, remembering reason as how it ended unless it
+// was already over. Must be called with accessLock held.
+func purgeGame(game *ActiveGame, reason Termination) {
+	removeGame(game)
+	if config.MaxPurgedGames <= 0 {
+		return
+	}
+
+	tombstone := purgedGame{
+		result:      game.result,
+		termination: game.termination,
+		purgedAt:    now(),
+	}
+	if !game.gameOver {
+		tombstone.termination = reason
+	}
+
+	// Make room by forgetting the oldest
+	for len(purgedGames) >= config.MaxPurgedGames {
+		oldestKey := ""
+		for key, purged := range purgedGames {
+			if len(oldestKey) == 0 || purged.purgedAt.Before(purgedGames[oldestKey].purgedAt) {
+				oldestKey = key
+			}
+		}
+		delete(purgedGames, oldestKey)
+	}
+	purgedGames[game.key] = tombstone
+}
+
+// forgetPurgedGames must be called with accessLock held
+func forgetPurgedGames() {
+	for key, purged := range purgedGames {
+		if since(purged.purgedAt) > config.PurgedGameMemory {
+			delete(purgedGames, key)
+		}
+	}
+}
+
+// gameMissing responds to a lookup of a key with no active game. Recently
+// purged games get 410, anything else counts as a failed lookup. Must be
+// called with accessLock held.
+func gameMissing(c *gin.Context, gameKey string) {
+	purged, ok := purgedGames[gameKey]
+	if !ok {
+		recordFailedLookup(c.ClientIP())
+		notFound(c, ErrGameNotFound)
+		return
+	}
+
+	err := ErrGameExpired
+	err.Result = purged.result
+	err.Termination = purged.termination
+	respondError(c, http.StatusGone, err)
+}
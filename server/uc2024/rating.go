@@ -0,0 +1,125 @@
+package uc2024
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const initialRating = 1500
+
+type Rating struct {
+	Rating float64 `json:"rating"`
+	Games  int     `json:"games"`
+	Wins   int     `json:"wins"`
+	Losses int     `json:"losses"`
+	Draws  int     `json:"draws"`
+}
+
+func (r Rating) provisional() bool {
+	return r.Games < config.ProvisionalGames
+}
+
+func (r Rating) kFactor() float64 {
+	if r.provisional() {
+		return config.ProvisionalKFactor
+	}
+	return config.KFactor
+}
+
+func loadRating(player string) (Rating, error) {
+	rating, ok, err := storage.LoadRating(player)
+	if err != nil {
+		return Rating{}, err
+	}
+	if !ok {
+		rating.Rating = initialRating
+	}
+	return rating, nil
+}
+
+// expectedScore is the standard Elo expectation of a scoring against b
+func expectedScore(a float64, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// updateRatings applies a finished game to both players' ratings. Games where
+// either player didn't give a name are unrated.
+func updateRatings(game *ActiveGame) {
+	white := game.playerNames[PlayerTeamWhite]
+	black := game.playerNames[PlayerTeamBlack]
+	if len(white) == 0 || len(black) == 0 || white == black {
+		return
+	}
+
+	var whiteScore float64
+	switch game.result {
+	case GameResultWhite:
+		whiteScore = 1
+	case GameResultBlack:
+		whiteScore = 0
+	case GameResultDraw:
+		whiteScore = 0.5
+	default:
+		return
+	}
+
+	whiteRating, err := loadRating(white)
+	if err != nil {
+		logger.Error("loading rating", "player", white, "error", err)
+		return
+	}
+	blackRating, err := loadRating(black)
+	if err != nil {
+		logger.Error("loading rating", "player", black, "error", err)
+		return
+	}
+
+	whiteExpected := expectedScore(whiteRating.Rating, blackRating.Rating)
+	whiteDelta := whiteRating.kFactor() * (whiteScore - whiteExpected)
+	blackDelta := blackRating.kFactor() * ((1 - whiteScore) - (1 - whiteExpected))
+
+	whiteRating.Rating += whiteDelta
+	blackRating.Rating += blackDelta
+	whiteRating.Games++
+	blackRating.Games++
+	switch game.result {
+	case GameResultWhite:
+		whiteRating.Wins++
+		blackRating.Losses++
+	case GameResultBlack:
+		whiteRating.Losses++
+		blackRating.Wins++
+	case GameResultDraw:
+		whiteRating.Draws++
+		blackRating.Draws++
+	}
+
+	if err := storage.SaveRating(white, whiteRating); err != nil {
+		logger.Error("saving rating", "player", white, "error", err)
+	}
+	if err := storage.SaveRating(black, blackRating); err != nil {
+		logger.Error("saving rating", "player", black, "error", err)
+	}
+}
+
+func getRating(c *gin.Context) {
+	player := c.Param("player")
+
+	rating, err := loadRating(player)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrStorage)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"player":      player,
+		"rating":      math.Round(rating.Rating),
+		"games":       rating.Games,
+		"wins":        rating.Wins,
+		"losses":      rating.Losses,
+		"draws":       rating.Draws,
+		"provisional": rating.provisional(),
+	})
+}
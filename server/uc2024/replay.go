@@ -0,0 +1,96 @@
+package uc2024
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getGameMove returns a single move and the position after it so replay
+// viewers can jump straight to any point in the game
+func getGameMove(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		badRequest(c, ErrInvalidMoveIndex)
+		return
+	}
+
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	if index < 0 || index >= len(game.moves) {
+		notFound(c, ErrMoveNotFound)
+		return
+	}
+
+	// The position is only known for variants the pgn board can follow
+	var fen *string
+	if board := replayBoard(game.chessVariant, game.moves[:index+1]); board != nil {
+		position := board.String()
+		fen = &position
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"index": index,
+		"move":  game.moves[index],
+		"fen":   fen,
+	})
+}
+
+// getGameFull gives everything a client needs to rebuild the game after a
+// cold reconnect without replaying the moves itself
+func getGameFull(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	var fen *string
+	if board := game.board(); board != nil {
+		position := board.String()
+		fen = &position
+	}
+	// Keep whatever the board cache rebuilt
+	saveGame(game)
+
+	hostTeam, _ := game.hostTeam()
+	c.JSON(http.StatusOK, gin.H{
+		"game_key":      gameKey,
+		"chess_variant": game.chessVariant,
+		"moves":         game.moves,
+		"move_times":    game.formattedMoveTimes(),
+		"fen":           fen,
+		"turn":          moveTeam(len(game.moves)),
+		"host_team":     hostTeam,
+		"game_ready":    len(game.playerIps) == 2,
+		"game_complete": game.gameOver,
+		"result":        game.result,
+		"termination":   game.termination,
+		// There are no server side clocks yet
+		"clocks":              nil,
+		"takebacks_remaining": game.takebacks.remainingByTeam(),
+	})
+}
@@ -0,0 +1,158 @@
+package uc2024
+
+import (
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+// The pgn board can follow moves but doesn't say much about the position,
+// these fill in what the variant rules need
+
+var (
+	knightOffsets    = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingOffsets      = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	rookDirections   = [][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	bishopDirections = [][2]int{{1, 1}, {-1, 1}, {-1, -1}, {1, -1}}
+)
+
+// squareAt gives the position for zero based file and rank, NoPosition when
+// off the board
+func squareAt(file int, rank int) pgn.Position {
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return pgn.NoPosition
+	}
+	return pgn.PositionFromFileRank(pgn.FileA+pgn.File(file), pgn.Rank1+pgn.Rank(rank))
+}
+
+func squareCoords(pos pgn.Position) (int, int) {
+	return int(pos.GetFile() - pgn.FileA), int(pos.GetRank() - pgn.Rank1)
+}
+
+func pieceAt(board *pgn.Board, file int, rank int) pgn.Piece {
+	pos := squareAt(file, rank)
+	if pos == pgn.NoPosition {
+		return pgn.NoPiece
+	}
+	return board.GetPiece(pos)
+}
+
+// pieceKind is the lower case letter of the piece regardless of colour
+func pieceKind(piece pgn.Piece) byte {
+	return byte(piece) | 0x20
+}
+
+func isPiece(piece pgn.Piece, color pgn.Color, kinds string) bool {
+	if piece == pgn.NoPiece || piece.Color() != color {
+		return false
+	}
+	for i := 0; i < len(kinds); i++ {
+		if pieceKind(piece) == kinds[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func opponentColor(color pgn.Color) pgn.Color {
+	if color == pgn.White {
+		return pgn.Black
+	}
+	return pgn.White
+}
+
+// squareAttacked reports whether any piece of color attacks target
+func squareAttacked(board *pgn.Board, target pgn.Position, by pgn.Color) bool {
+	file, rank := squareCoords(target)
+
+	for _, offset := range knightOffsets {
+		if isPiece(pieceAt(board, file+offset[0], rank+offset[1]), by, "n") {
+			return true
+		}
+	}
+
+	for _, offset := range kingOffsets {
+		if isPiece(pieceAt(board, file+offset[0], rank+offset[1]), by, "k") {
+			return true
+		}
+	}
+
+	// Pawns attack forward so look back down the board for them
+	pawnRank := rank - 1
+	if by == pgn.Black {
+		pawnRank = rank + 1
+	}
+	if isPiece(pieceAt(board, file-1, pawnRank), by, "p") || isPiece(pieceAt(board, file+1, pawnRank), by, "p") {
+		return true
+	}
+
+	slides := func(directions [][2]int, kinds string) bool {
+		for _, direction := range directions {
+			for f, r := file+direction[0], rank+direction[1]; squareAt(f, r) != pgn.NoPosition; f, r = f+direction[0], r+direction[1] {
+				piece := pieceAt(board, f, r)
+				if piece == pgn.NoPiece {
+					continue
+				}
+				if isPiece(piece, by, kinds) {
+					return true
+				}
+				break
+			}
+		}
+		return false
+	}
+
+	return slides(rookDirections, "rq") || slides(bishopDirections, "bq")
+}
+
+// inCheck reports whether color's king is attacked. Positions without that
+// king, like Horde's white side, are never in check.
+func inCheck(board *pgn.Board, color pgn.Color) bool {
+	king := board.FindKing(color)
+	if king == pgn.NoPosition {
+		return false
+	}
+	return squareAttacked(board, king, opponentColor(color))
+}
+
+// afterMove plays move on a copy of board so the position can be inspected
+// without touching the game's cached board
+func afterMove(board *pgn.Board, move string, team PlayerTeam) (*pgn.Board, error) {
+	next := *board
+	if err := next.MakeAlgebraicMove(move, teamColor(team)); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// insufficientMaterial reports a dead position where neither side has the
+// material left to mate: bare kings, a single minor piece, or only bishops
+// that all stand on squares of one colour
+func insufficientMaterial(board *pgn.Board) bool {
+	minors := 0
+	bishopColors := map[int]bool{}
+	knights := 0
+	for file := 0; file < 8; file++ {
+		for rank := 0; rank < 8; rank++ {
+			piece := pieceAt(board, file, rank)
+			if piece == pgn.NoPiece {
+				continue
+			}
+			switch pieceKind(piece) {
+			case 'k':
+			case 'b':
+				minors++
+				bishopColors[(file+rank)%2] = true
+			case 'n':
+				minors++
+				knights++
+			default:
+				// A pawn, rook or queen can still mate
+				return false
+			}
+		}
+	}
+
+	if minors <= 1 {
+		return true
+	}
+	return knights == 0 && len(bishopColors) == 1
+}
@@ -0,0 +1,39 @@
+package uc2024
+
+import (
+	"testing"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+func TestInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want bool
+	}{
+		{"bare kings", "8/8/4k3/8/8/3K4/8/8 w - - 0 1", true},
+		{"king and bishop", "8/8/4k3/8/8/3K4/5B2/8 w - - 0 1", true},
+		{"king and knight", "8/8/4k3/8/8/3K4/8/6n1 w - - 0 1", true},
+		{"bishops on light squares", "8/8/4k3/2b5/8/3K4/5B2/8 w - - 0 1", true},
+		{"bishops on both colours", "8/8/4k3/1b6/8/3K4/5B2/8 w - - 0 1", false},
+		{"knight and bishop", "8/8/4k3/8/8/3K4/5B2/6n1 w - - 0 1", false},
+		{"two knights", "8/8/4k3/8/8/3K4/8/5NN1 w - - 0 1", false},
+		{"pawn", "8/8/4k3/8/8/3K4/4P3/8 w - - 0 1", false},
+		{"rook", "8/8/4k3/8/8/3K4/8/7r w - - 0 1", false},
+		{"queen", "8/8/4k3/8/8/3K4/8/Q7 w - - 0 1", false},
+		{"starting position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board, err := pgn.NewBoardFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := insufficientMaterial(board); got != tt.want {
+				t.Errorf("insufficientMaterial = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
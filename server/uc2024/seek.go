@@ -0,0 +1,188 @@
+package uc2024
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type seekEntry struct {
+	chessVariant string
+	timeControl  string
+	playerName   string
+	ip           string
+	created      time.Time
+	// Filled in once the seek has been matched with an opponent
+	gameKey string
+	team    PlayerTeam
+}
+
+// seeks are keyed by player key and guarded by accessLock since matching
+// creates a game
+var seeks map[string]seekEntry = make(map[string]seekEntry)
+
+func (seek *seekEntry) expired() bool {
+	return len(seek.gameKey) == 0 && since(seek.created) > config.SeekTimeout
+}
+
+func (seek *seekEntry) compatible(other seekEntry) bool {
+	return variantName(seek.chessVariant) == variantName(other.chessVariant) &&
+		seek.timeControl == other.timeControl
+}
+
+// postSeek puts the player in the waiting pool, or pairs them with a
+// compatible seeker already waiting and starts the game straight away
+func postSeek(c *gin.Context) {
+	if err, ok := checkPlayerKey(c); !ok {
+		badRequest(c, err)
+		return
+	}
+
+	chessVariant := param(c, "chess_variant")
+	if !validChessVariant(chessVariant) {
+		c.Set(logChessVariant, chessVariant)
+		badRequest(c, invalidVariantError())
+		return
+	}
+
+	playerName, ok := getPlayerName(c)
+	if !ok {
+		badRequest(c, ErrInvalidPlayerName)
+		return
+	}
+
+	playerKey := getPlayerKey(c)
+	seek := seekEntry{
+		chessVariant: seedVariant(chessVariant),
+		timeControl:  param(c, "time_control"),
+		playerName:   playerName,
+		ip:           c.ClientIP(),
+		created:      now(),
+	}
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+
+	// Don't lose a match the player hasn't collected yet
+	if existing, ok := seeks[playerKey]; ok && len(existing.gameKey) > 0 {
+		delete(seeks, playerKey)
+		c.JSON(http.StatusOK, gin.H{
+			"status":        "matched",
+			"game_key":      existing.gameKey,
+			"team":          existing.team,
+			"chess_variant": existing.chessVariant,
+			"initial_fen":   variantRules(existing.chessVariant).StartingFEN(existing.chessVariant),
+		})
+		return
+	}
+
+	if ipAtGameCap(seek.ip) {
+		tooManyRequests(c, ErrTooManyGamesForIP)
+		return
+	}
+
+	for opponentKey, waiting := range seeks {
+		if opponentKey == playerKey || len(waiting.gameKey) > 0 || waiting.expired() || !waiting.compatible(seek) || ipAtGameCap(waiting.ip) {
+			continue
+		}
+
+		if len(activeGames) > 100 {
+			tooManyRequests(c, ErrTooManyGames)
+			return
+		}
+
+		// The seeker who waited hosts, their variant wins so both agree on a
+		// Chess960 seed
+		gameKey, err := generateGameKey()
+		if err != nil {
+			logger.Error("generating game key", "error", err)
+			serviceUnavailable(c, ErrNoGameKey)
+			return
+		}
+		game := newActiveGame(gameKey, opponentKey, randomTeam(), waiting.chessVariant)
+		team := game.playerIps[opponentKey].opponent()
+		game.playerIps[playerKey] = team
+		game.playerAddrs[opponentKey] = waiting.ip
+		game.playerAddrs[playerKey] = seek.ip
+		game.readyTime = game.startTime
+		game.turnStarted = game.readyTime
+		game.record(GameLogEntry{
+			Type: GameLogJoined,
+			Team: team,
+		})
+		game.playerNames[game.playerIps[opponentKey]] = waiting.playerName
+		game.playerNames[team] = playerName
+		saveGame(game)
+
+		waiting.gameKey = gameKey
+		waiting.team = game.playerIps[opponentKey]
+		seeks[opponentKey] = waiting
+		delete(seeks, playerKey)
+
+		c.Set(logGameKey, gameKey)
+		c.Set(logTeam, string(team))
+		c.JSON(http.StatusOK, gin.H{
+			"status":        "matched",
+			"game_key":      gameKey,
+			"team":          team,
+			"chess_variant": game.chessVariant,
+			"initial_fen":   variantRules(game.chessVariant).StartingFEN(game.chessVariant),
+		})
+		return
+	}
+
+	seeks[playerKey] = seek
+	c.JSON(http.StatusOK, gin.H{
+		"status": "waiting",
+	})
+}
+
+// getSeekStatus is polled by a waiting seeker to find out if they were matched
+func getSeekStatus(c *gin.Context) {
+	playerKey := getPlayerKey(c)
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	seek, ok := seeks[playerKey]
+	if !ok || seek.expired() {
+		delete(seeks, playerKey)
+		notFound(c, ErrSeekNotFound)
+		return
+	}
+
+	if len(seek.gameKey) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "waiting",
+		})
+		return
+	}
+
+	delete(seeks, playerKey)
+	c.JSON(http.StatusOK, gin.H{
+		"status":        "matched",
+		"game_key":      seek.gameKey,
+		"team":          seek.team,
+		"chess_variant": seek.chessVariant,
+	})
+}
+
+func deleteSeek(c *gin.Context) {
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	delete(seeks, getPlayerKey(c))
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+// purgeSeeks drops expired seeks and matches nobody came back for. Callers
+// must hold accessLock.
+func purgeSeeks() {
+	for playerKey, seek := range seeks {
+		if seek.expired() || since(seek.created) > config.InactivityTimeout {
+			delete(seeks, playerKey)
+		}
+	}
+}
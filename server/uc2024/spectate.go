@@ -0,0 +1,54 @@
+package uc2024
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func generateSpectateToken() string {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// isSpectator reports whether key is one of the game's read only spectate
+// tokens rather than a seat
+func (game *ActiveGame) isSpectator(key string) bool {
+	return len(key) > 0 && game.spectateTokens[key]
+}
+
+// postSpectateLink hands the host a token they can share so others can watch
+// the game without being able to play in it
+func postSpectateLink(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return
+	}
+
+	if getPlayerKey(c) != game.host {
+		forbidden(c, ErrNotHost)
+		return
+	}
+
+	token := generateSpectateToken()
+	game.spectateTokens[token] = true
+	saveGame(game)
+
+	c.JSON(http.StatusOK, gin.H{
+		"game_key":       gameKey,
+		"spectate_token": token,
+	})
+}
@@ -0,0 +1,42 @@
+package uc2024
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getGameStatus says whether a shared game key can be joined without
+// joining it or returning the rest of the game. Unknown keys still count
+// towards the lookup limit so this can't be used to guess keys faster.
+func getGameStatus(c *gin.Context) {
+	ip := c.ClientIP()
+	if lookupBlocked(ip) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	gameKey := c.Param("game_key")
+
+	accessLock.RLock()
+	defer accessLock.RUnlock()
+	game, ok := activeGames[gameKey]
+	if !ok {
+		recordFailedLookup(ip)
+		c.JSON(http.StatusOK, gin.H{
+			"exists":   false,
+			"joinable": false,
+			"variant":  "",
+			"full":     false,
+		})
+		return
+	}
+
+	full := len(game.playerIps) >= 2
+	c.JSON(http.StatusOK, gin.H{
+		"exists":   true,
+		"joinable": !full && !game.gameOver,
+		"variant":  game.chessVariant,
+		"full":     full,
+	})
+}
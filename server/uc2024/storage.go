@@ -0,0 +1,161 @@
+package uc2024
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// Storage is where anything that has to outlive a game is kept
+type Storage interface {
+	LoadRating(player string) (Rating, bool, error)
+	SaveRating(player string, rating Rating) error
+	// Correspondence games, and every game during a graceful restart, keyed
+	// by game key
+	LoadGames() ([]StoredGame, error)
+	SaveGame(game StoredGame) error
+	DeleteGame(key string) error
+}
+
+type storedData struct {
+	Ratings map[string]Rating     `json:"ratings"`
+	Games   map[string]StoredGame `json:"games"`
+}
+
+// memoryStorage is used when no storage file is configured, everything is
+// lost on restart
+type memoryStorage struct {
+	lock *sync.Mutex
+	data storedData
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		lock: &sync.Mutex{},
+		data: storedData{
+			Ratings: map[string]Rating{},
+			Games:   map[string]StoredGame{},
+		},
+	}
+}
+
+func (s *memoryStorage) LoadRating(player string) (Rating, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rating, ok := s.data.Ratings[player]
+	return rating, ok, nil
+}
+
+func (s *memoryStorage) SaveRating(player string, rating Rating) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Ratings[player] = rating
+	return nil
+}
+
+func (s *memoryStorage) LoadGames() ([]StoredGame, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	games := make([]StoredGame, 0, len(s.data.Games))
+	for _, game := range s.data.Games {
+		games = append(games, game)
+	}
+	return games, nil
+}
+
+func (s *memoryStorage) SaveGame(game StoredGame) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Games[game.Key] = game
+	return nil
+}
+
+func (s *memoryStorage) DeleteGame(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.data.Games, key)
+	return nil
+}
+
+// fileStorage keeps everything in memory and rewrites a single JSON file on
+// every change
+type fileStorage struct {
+	memoryStorage
+	path string
+}
+
+func newFileStorage(path string) (*fileStorage, error) {
+	s := &fileStorage{
+		memoryStorage: *newMemoryStorage(),
+		path:          path,
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, &s.data); err != nil {
+		return nil, err
+	}
+	if s.data.Ratings == nil {
+		s.data.Ratings = map[string]Rating{}
+	}
+	if s.data.Games == nil {
+		s.data.Games = map[string]StoredGame{}
+	}
+
+	return s, nil
+}
+
+func (s *fileStorage) SaveRating(player string, rating Rating) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Ratings[player] = rating
+	return s.flush()
+}
+
+func (s *fileStorage) SaveGame(game StoredGame) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Games[game.Key] = game
+	return s.flush()
+}
+
+func (s *fileStorage) DeleteGame(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.data.Games[key]; !ok {
+		return nil
+	}
+	delete(s.data.Games, key)
+	return s.flush()
+}
+
+// flush writes to a temp file first so a crash mid write can't lose the
+// existing data. Callers must hold the lock.
+func (s *fileStorage) flush() error {
+	raw, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func NewStorage(path string) (Storage, error) {
+	if len(path) == 0 {
+		return newMemoryStorage(), nil
+	}
+
+	return newFileStorage(path)
+}
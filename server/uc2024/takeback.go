@@ -0,0 +1,251 @@
+package uc2024
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	EventTakebackRequested EventType = "takeback_requested"
+	EventTakebackDeclined  EventType = "takeback_declined"
+	EventTakeback          EventType = "takeback"
+)
+
+// TakebackPolicy is chosen by the host when the game is created
+type TakebackPolicy struct {
+	Allowed bool `json:"allowed"`
+	Max     int  `json:"max"`
+}
+
+type takebackState struct {
+	policy TakebackPolicy
+	used   map[PlayerTeam]int
+	// Team waiting on the opponent to accept, empty when nothing is pending
+	requested PlayerTeam
+}
+
+func newTakebackState(policy TakebackPolicy) takebackState {
+	return takebackState{
+		policy: policy,
+		used:   map[PlayerTeam]int{},
+	}
+}
+
+// takebackPolicy reads allow_takebacks and max_takebacks, anything missing
+// falls back to the configured defaults
+func takebackPolicy(c *gin.Context) (TakebackPolicy, bool) {
+	policy := TakebackPolicy{
+		Allowed: true,
+		Max:     config.MaxTakebacks,
+	}
+
+	if raw, ok := getParam(c, "allow_takebacks"); ok {
+		allowed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return policy, false
+		}
+		policy.Allowed = allowed
+	}
+
+	if raw, ok := getParam(c, "max_takebacks"); ok {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return policy, false
+		}
+		policy.Max = limit
+	}
+
+	return policy, true
+}
+
+func (state *takebackState) remaining(team PlayerTeam) int {
+	if !state.policy.Allowed {
+		return 0
+	}
+	return max(state.policy.Max-state.used[team], 0)
+}
+
+func (state *takebackState) remainingByTeam() map[PlayerTeam]int {
+	return map[PlayerTeam]int{
+		PlayerTeamWhite: state.remaining(PlayerTeamWhite),
+		PlayerTeamBlack: state.remaining(PlayerTeamBlack),
+	}
+}
+
+// moveTeam is who played the move at index, white always moves first
+func moveTeam(index int) PlayerTeam {
+	if index%2 == 0 {
+		return PlayerTeamWhite
+	}
+	return PlayerTeamBlack
+}
+
+// undoTo gives how many moves remain once team's last move, and any reply to
+// it, is taken back. It's false when team hasn't moved yet.
+func (game *ActiveGame) undoTo(team PlayerTeam) (int, bool) {
+	for i := len(game.moves) - 1; i >= 0; i-- {
+		if moveTeam(i) == team {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// seatedTakebackGame loads the game for a takeback request and checks the
+// caller is playing in it. It writes the error response itself.
+func seatedTakebackGame(c *gin.Context) (ActiveGame, PlayerTeam, bool) {
+	gameKey := c.Param("game_key")
+	game, ok := activeGames[gameKey]
+	if !ok {
+		gameMissing(c, gameKey)
+		return game, "", false
+	}
+
+	team, seated := game.playerIps[getPlayerKey(c)]
+	if !seated {
+		forbidden(c, ErrNotSeated)
+		return game, "", false
+	}
+
+	if game.gameOver {
+		forbidden(c, gameOverError(&game))
+		return game, "", false
+	}
+
+	c.Set(logTeam, string(team))
+	return game, team, true
+}
+
+func postTakebackRequest(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, team, ok := seatedTakebackGame(c)
+	if !ok {
+		return
+	}
+
+	if game.takebacks.remaining(team) <= 0 {
+		forbidden(c, ErrNoTakebacks)
+		return
+	}
+
+	if _, ok := game.undoTo(team); !ok {
+		conflict(c, ErrNothingToTakeBack)
+		return
+	}
+
+	game.takebacks.requested = team
+	game.record(GameLogEntry{
+		Type:       GameLogTakebackRequested,
+		Team:       team,
+		MoveNumber: len(game.moves),
+	})
+	saveGame(game)
+
+	publish(Event{
+		Type:    EventTakebackRequested,
+		GameKey: game.key,
+		Team:    team,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+func postTakebackAccept(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, team, ok := seatedTakebackGame(c)
+	if !ok {
+		return
+	}
+
+	requester := game.takebacks.requested
+	if len(requester) == 0 || requester == team {
+		conflict(c, ErrNoTakebackPending)
+		return
+	}
+
+	keep, ok := game.undoTo(requester)
+	if !ok {
+		conflict(c, ErrNothingToTakeBack)
+		return
+	}
+
+	game.moves = game.moves[:keep]
+	game.moveTimes = game.moveTimes[:min(keep, len(game.moveTimes))]
+	game.takebacks.used[requester]++
+	game.takebacks.requested = ""
+	// The requester's turn starts again from now
+	game.turnStarted = now()
+	// Premoves were queued against a position that is gone now
+	clear(game.premoves)
+	game.record(GameLogEntry{
+		Type:       GameLogTakebackAccepted,
+		Team:       requester,
+		MoveNumber: len(game.moves),
+	})
+	saveGame(game)
+
+	publish(Event{
+		Type:       EventTakeback,
+		GameKey:    game.key,
+		Team:       requester,
+		MoveNumber: len(game.moves),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"moves":  game.moves,
+	})
+}
+
+func postTakebackDecline(c *gin.Context) {
+	if lookupBlocked(c.ClientIP()) {
+		tooManyRequests(c, ErrTooManyLookups)
+		return
+	}
+
+	accessLock.Lock()
+	defer accessLock.Unlock()
+	game, team, ok := seatedTakebackGame(c)
+	if !ok {
+		return
+	}
+
+	requester := game.takebacks.requested
+	if len(requester) == 0 || requester == team {
+		conflict(c, ErrNoTakebackPending)
+		return
+	}
+
+	game.takebacks.requested = ""
+	game.record(GameLogEntry{
+		Type: GameLogTakebackDeclined,
+		Team: requester,
+	})
+	saveGame(game)
+
+	publish(Event{
+		Type:    EventTakebackDeclined,
+		GameKey: game.key,
+		Team:    requester,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
@@ -0,0 +1,120 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// takebacksRemaining is the takebacks_remaining of a game response
+func takebacksRemaining(t *testing.T, r http.Handler, gameKey string) map[string]any {
+	t.Helper()
+	status, body := call(t, r, http.MethodGet, "/game/"+gameKey, nil)
+	if status != http.StatusOK {
+		t.Fatalf("game: %d %v", status, body)
+	}
+	remaining, _ := body["takebacks_remaining"].(map[string]any)
+	return remaining
+}
+
+func TestTakebackPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    url.Values
+		remaining float64
+	}{
+		{"default", nil, 3},
+		{"disallowed", url.Values{"allow_takebacks": {"false"}}, 0},
+		{"limited", url.Values{"max_takebacks": {"1"}}, 1},
+		{"none", url.Values{"max_takebacks": {"0"}}, 0},
+		{"limit ignored when disallowed", url.Values{"allow_takebacks": {"false"}, "max_takebacks": {"5"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t, nil)
+			gameKey, _ := startTestGame(t, r, tt.params)
+
+			want := map[string]any{"white": tt.remaining, "black": tt.remaining}
+			if got := takebacksRemaining(t, r, gameKey); !reflect.DeepEqual(got, want) {
+				t.Errorf("takebacks_remaining = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestInvalidTakebackPolicy(t *testing.T) {
+	for _, params := range []url.Values{
+		{"allow_takebacks": {"maybe"}},
+		{"max_takebacks": {"-1"}},
+		{"max_takebacks": {"two"}},
+	} {
+		params.Set("player_key", "host")
+		params.Set("chess_variant", "Standard")
+		r := newTestServer(t, nil)
+
+		status, body := call(t, r, http.MethodPost, "/create", params)
+		if status != http.StatusBadRequest || body["code"] != ErrInvalidTakebackPolicy.Code {
+			t.Errorf("create %v = %d %v, want %d %s", params, status, body, http.StatusBadRequest, ErrInvalidTakebackPolicy.Code)
+		}
+	}
+}
+
+func TestTakebackLimit(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey, players := startTestGame(t, r, url.Values{"max_takebacks": {"1"}})
+	request := func(team PlayerTeam) (int, map[string]any) {
+		return call(t, r, http.MethodPost, "/takeback/"+gameKey, url.Values{"player_key": {players[team]}})
+	}
+
+	playMoves(t, r, gameKey, players, "e4", "e5")
+	if status, body := request(PlayerTeamWhite); status != http.StatusOK {
+		t.Fatalf("takeback request: %d %v", status, body)
+	}
+	status, body := call(t, r, http.MethodPost, "/takeback/"+gameKey+"/accept", url.Values{"player_key": {players[PlayerTeamBlack]}})
+	if status != http.StatusOK {
+		t.Fatalf("takeback accept: %d %v", status, body)
+	}
+	// White's move goes and so does black's reply to it
+	if moves := gameMoves(body); len(moves) != 0 {
+		t.Errorf("moves after takeback = %v, want none", moves)
+	}
+
+	want := map[string]any{"white": float64(0), "black": float64(1)}
+	if got := takebacksRemaining(t, r, gameKey); !reflect.DeepEqual(got, want) {
+		t.Errorf("takebacks_remaining = %v, want %v", got, want)
+	}
+
+	playMoves(t, r, gameKey, players, "d4", "d5")
+	if status, body := request(PlayerTeamWhite); status != http.StatusForbidden || body["code"] != ErrNoTakebacks.Code {
+		t.Errorf("second takeback request = %d %v, want %d %s", status, body, http.StatusForbidden, ErrNoTakebacks.Code)
+	}
+	if status, body := request(PlayerTeamBlack); status != http.StatusOK {
+		t.Errorf("black's takeback request = %d %v, want %d", status, body, http.StatusOK)
+	}
+}
+
+// A move can't be taken back for a fresh increment, whatever the host asked
+func TestTakebacksOffWithIncrement(t *testing.T) {
+	r := newTestServer(t, nil)
+	gameKey, players := startTestGame(t, r, url.Values{
+		"clock_mode":      {string(ClockModeIncrement)},
+		"clock_increment": {"30"},
+		"allow_takebacks": {"true"},
+		"max_takebacks":   {"5"},
+	})
+
+	want := map[string]any{"white": float64(0), "black": float64(0)}
+	if got := takebacksRemaining(t, r, gameKey); !reflect.DeepEqual(got, want) {
+		t.Errorf("takebacks_remaining = %v, want %v", got, want)
+	}
+
+	playMoves(t, r, gameKey, players, "e4", "e5")
+	for _, team := range []PlayerTeam{PlayerTeamWhite, PlayerTeamBlack} {
+		status, body := call(t, r, http.MethodPost, "/takeback/"+gameKey, url.Values{"player_key": {players[team]}})
+		if status != http.StatusForbidden || body["code"] != ErrNoTakebacks.Code {
+			t.Errorf("%s takeback request = %d %v, want %d %s", team, status, body, http.StatusForbidden, ErrNoTakebacks.Code)
+		}
+	}
+}
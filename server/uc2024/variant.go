@@ -0,0 +1,317 @@
+package uc2024
+
+import (
+	"errors"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+const (
+	TerminationKingRace             Termination = "king_race"
+	TerminationThreeCheck           Termination = "three_check"
+	TerminationInsufficientMaterial Termination = "insufficient_material"
+	TerminationCheckmate            Termination = "checkmate"
+	TerminationStalemate            Termination = "stalemate"
+)
+
+var errIllegalMove = errors.New("move is illegal in this variant")
+
+// Variant is the rules the server knows for a chess variant. Variants the
+// pgn board can't follow have no starting position and their moves are only
+// checked against the grammar.
+type Variant interface {
+	// InitialFEN is the starting position for the full variant string, which
+	// may carry a seed. Empty when the pgn board can't follow the variant.
+	InitialFEN(chessVariant string) string
+	// StartingFEN is the position the client sets up, known for some
+	// variants the pgn board can't follow. Empty when the server doesn't
+	// know it.
+	StartingFEN(chessVariant string) string
+	// LegalMoves lists every move team can make in the position, written
+	// with the + or # it gives. Empty when the pgn board can't follow the
+	// variant.
+	LegalMoves(game *ActiveGame, board *pgn.Board, team PlayerTeam) []LegalMove
+	// CheckMove rejects a move team can't make in the position
+	CheckMove(game *ActiveGame, board *pgn.Board, move string, team PlayerTeam) error
+	// PlayMove makes a move CheckMove accepted on the board
+	PlayMove(board *pgn.Board, move string, team PlayerTeam) error
+	// CheckTermination reports whether the last move ended the game under
+	// the variant's own win conditions
+	CheckTermination(game *ActiveGame, board *pgn.Board) (GameResult, Termination, bool)
+	// StalemateResult is how the game ends when team, who is to move, has no
+	// legal move and isn't in check. A draw in chess, variants such as
+	// Antichess give the stalemated side the win.
+	StalemateResult(team PlayerTeam) GameResult
+}
+
+// standardVariant is normal chess from a fixed starting position, with the
+// pgn library deciding what is legal
+type standardVariant struct {
+	fen string
+}
+
+func (v standardVariant) InitialFEN(chessVariant string) string {
+	return v.fen
+}
+
+func (v standardVariant) StartingFEN(chessVariant string) string {
+	return v.fen
+}
+
+func (v standardVariant) LegalMoves(game *ActiveGame, board *pgn.Board, team PlayerTeam) []LegalMove {
+	return standardMoves(game, board, team)
+}
+
+// CheckMove accepts only the moves LegalMoves lists. The variant is looked
+// up from the game so variants embedding standardVariant check against
+// their own moves.
+func (v standardVariant) CheckMove(game *ActiveGame, board *pgn.Board, move string, team PlayerTeam) error {
+	if !isLegalMove(game, board, move, team) {
+		return errIllegalMove
+	}
+	return nil
+}
+
+func (v standardVariant) PlayMove(board *pgn.Board, move string, team PlayerTeam) error {
+	return board.MakeAlgebraicMove(move, teamColor(team))
+}
+
+func (v standardVariant) CheckTermination(game *ActiveGame, board *pgn.Board) (GameResult, Termination, bool) {
+	if result, termination, over := noMovesOutcome(game, board, moveTeam(len(game.moves))); over {
+		return result, termination, true
+	}
+	if insufficientMaterial(board) {
+		return GameResultDraw, TerminationInsufficientMaterial, true
+	}
+	return "", "", false
+}
+
+func (v standardVariant) StalemateResult(team PlayerTeam) GameResult {
+	return GameResultDraw
+}
+
+// grammarVariant is for variants the pgn board can't set up
+type grammarVariant struct{}
+
+func (grammarVariant) InitialFEN(chessVariant string) string {
+	return ""
+}
+
+func (grammarVariant) StartingFEN(chessVariant string) string {
+	return ""
+}
+
+// LegalMoves is never reached since there is no board to list moves on
+func (grammarVariant) LegalMoves(game *ActiveGame, board *pgn.Board, team PlayerTeam) []LegalMove {
+	return nil
+}
+
+func (grammarVariant) CheckMove(game *ActiveGame, board *pgn.Board, move string, team PlayerTeam) error {
+	return nil
+}
+
+// PlayMove is never reached since there is no board to play on
+func (grammarVariant) PlayMove(board *pgn.Board, move string, team PlayerTeam) error {
+	return nil
+}
+
+func (grammarVariant) CheckTermination(game *ActiveGame, board *pgn.Board) (GameResult, Termination, bool) {
+	return "", "", false
+}
+
+// StalemateResult is never reached since there is no board to run out of
+// moves on
+func (grammarVariant) StalemateResult(team PlayerTeam) GameResult {
+	return GameResultDraw
+}
+
+// layoutVariant is a variant the pgn board can't follow from a fixed
+// starting position
+type layoutVariant struct {
+	grammarVariant
+	fen string
+}
+
+func (v layoutVariant) StartingFEN(chessVariant string) string {
+	return v.fen
+}
+
+// racingKingsVariant never allows a check, and the first king to the
+// eighth rank wins
+type racingKingsVariant struct {
+	standardVariant
+}
+
+// LegalMoves leaves out checks, neither side may ever be in check
+func (v racingKingsVariant) LegalMoves(game *ActiveGame, board *pgn.Board, team PlayerTeam) []LegalMove {
+	var moves []LegalMove
+	for _, move := range standardMoves(game, board, team) {
+		if next, err := afterMove(board, move.SAN, team); err == nil && !inCheck(next, opponentColor(teamColor(team))) {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+func (v racingKingsVariant) CheckTermination(game *ActiveGame, board *pgn.Board) (GameResult, Termination, bool) {
+	return racingKingsOutcome(board, moveTeam(len(game.moves)-1))
+}
+
+// threeCheckVariant is won by giving the third check
+type threeCheckVariant struct {
+	standardVariant
+}
+
+func (v threeCheckVariant) CheckTermination(game *ActiveGame, board *pgn.Board) (GameResult, Termination, bool) {
+	for team, checks := range countChecks(game.chessVariant, game.moves) {
+		if checks >= 3 {
+			return GameResult(team), TerminationThreeCheck, true
+		}
+	}
+	return v.standardVariant.CheckTermination(game, board)
+}
+
+// variants are keyed by name without any seed. The layouts are the
+// client's, its Horde has four pawns on the fifth rank as well as the usual
+// four full ranks.
+var variants = map[string]Variant{
+	"Standard":    standardVariant{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+	"Chess960":    chess960Variant{},
+	"Horde":       layoutVariant{fen: "rnbqkbnr/pppppppp/8/1PP2PP1/PPPPPPPP/PPPPPPPP/PPPPPPPP/PPPPKPPP w kq - 0 1"},
+	"Horsies":     standardVariant{fen: "nnnnknnn/pppppppp/8/8/8/8/PPPPPPPP/NNNNKNNN w - - 0 1"},
+	"Kawns":       layoutVariant{fen: "rbbqkbbr/nnnnnnnn/8/8/8/8/NNNNNNNN/RBBQKBBR w - - 0 1"},
+	"RacingKings": racingKingsVariant{standardVariant{fen: "8/8/8/8/8/8/krbnNBRK/qrbnNBRQ w - - 0 1"}},
+	"ThreeCheck":  threeCheckVariant{standardVariant{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"}},
+	"Crazyhouse":  crazyhouseVariant{standardVariant{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"}},
+}
+
+// variantRules looks up the rules for a variant string, unknown variants
+// fall back to checking the grammar only
+func variantRules(chessVariant string) Variant {
+	if variant, ok := variants[variantName(chessVariant)]; ok {
+		return variant
+	}
+	return grammarVariant{}
+}
+
+// checkVariantMove checks the move against the variant's rules when the pgn
+// board can follow the game
+func checkVariantMove(game *ActiveGame, move string) error {
+	board := game.board()
+	if board == nil {
+		return nil
+	}
+
+	return variantRules(game.chessVariant).CheckMove(game, board, move, moveTeam(len(game.moves)))
+}
+
+// variantOutcome checks if the last move ended the game
+func variantOutcome(game *ActiveGame) (GameResult, Termination, bool) {
+	board := game.board()
+	if board == nil {
+		return "", "", false
+	}
+
+	return variantRules(game.chessVariant).CheckTermination(game, board)
+}
+
+// noMovesOutcome ends the game when team, who is to move, has no legal
+// move. It is checkmate if they are in check and stalemate otherwise, with
+// the game's variant deciding who a stalemate favours. The variant is looked
+// up from the game so variants embedding standardVariant keep their own.
+func noMovesOutcome(game *ActiveGame, board *pgn.Board, team PlayerTeam) (GameResult, Termination, bool) {
+	if len(kingSafeMoves(board, teamColor(team))) > 0 {
+		return "", "", false
+	}
+	if inCheck(board, teamColor(team)) {
+		return GameResult(team.opponent()), TerminationCheckmate, true
+	}
+	return variantRules(game.chessVariant).StalemateResult(team), TerminationStalemate, true
+}
+
+func kingOnLastRank(board *pgn.Board, color pgn.Color) bool {
+	king := board.FindKing(color)
+	return king != pgn.NoPosition && king.GetRank() == pgn.Rank8
+}
+
+// blackCanReachLastRank is whether black's king has a move onto the eighth
+// rank, which is the only thing that can still draw once white gets there
+func blackCanReachLastRank(board *pgn.Board) bool {
+	king := board.FindKing(pgn.Black)
+	if king == pgn.NoPosition || king.GetRank() != pgn.Rank7 {
+		return false
+	}
+
+	// Take the king off so squares it would be moving along the line of an
+	// attacker aren't treated as shielded by it
+	withoutKing := *board
+	withoutKing.RemovePiece(king, pgn.BlackKing)
+
+	file, rank := squareCoords(king)
+	for f := file - 1; f <= file+1; f++ {
+		target := squareAt(f, rank+1)
+		if target == pgn.NoPosition {
+			continue
+		}
+		if piece := board.GetPiece(target); piece != pgn.NoPiece && piece.Color() == pgn.Black {
+			continue
+		}
+		if !squareAttacked(&withoutKing, target, pgn.White) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// racingKingsOutcome applies the finish rules. White moves first so when
+// white's king reaches the eighth rank black gets one reply to draw by
+// reaching it too.
+func racingKingsOutcome(board *pgn.Board, moved PlayerTeam) (GameResult, Termination, bool) {
+	white := kingOnLastRank(board, pgn.White)
+	black := kingOnLastRank(board, pgn.Black)
+
+	switch {
+	case white && black:
+		return GameResultDraw, TerminationKingRace, true
+	case black:
+		return GameResultBlack, TerminationKingRace, true
+	case white && moved == PlayerTeamBlack:
+		// Black had their reply and didn't make it
+		return GameResultWhite, TerminationKingRace, true
+	case white && !blackCanReachLastRank(board):
+		return GameResultWhite, TerminationKingRace, true
+	}
+
+	return "", "", false
+}
+
+// countChecks replays the game counting the checks each side has given. It
+// is nil when the pgn board can't follow the game.
+func countChecks(chessVariant string, moves []string) map[PlayerTeam]int {
+	fen := variantRules(chessVariant).InitialFEN(chessVariant)
+	if len(fen) == 0 {
+		return nil
+	}
+
+	board, err := pgn.NewBoardFEN(fen)
+	if err != nil {
+		return nil
+	}
+
+	checks := map[PlayerTeam]int{
+		PlayerTeamWhite: 0,
+		PlayerTeamBlack: 0,
+	}
+	for i, move := range moves {
+		team := moveTeam(i)
+		if err := board.MakeAlgebraicMove(move, teamColor(team)); err != nil {
+			return nil
+		}
+		if inCheck(board, teamColor(team.opponent())) {
+			checks[team]++
+		}
+	}
+
+	return checks
+}
@@ -0,0 +1,295 @@
+package uc2024
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+// testGame is a game of the variant with the moves already played
+func testGame(chessVariant string, moves ...string) ActiveGame {
+	game := newActiveGame("test", "host", PlayerTeamWhite, chessVariant)
+	game.moves = moves
+	return game
+}
+
+// withVariant registers a variant for the length of the test, so its rules
+// can be tried from a position of the test's choosing
+func withVariant(t *testing.T, name string, variant Variant) {
+	t.Helper()
+	variants[name] = variant
+	t.Cleanup(func() {
+		delete(variants, name)
+	})
+}
+
+func TestVariantLegalMoves(t *testing.T) {
+	tests := []struct {
+		name         string
+		chessVariant string
+		moves        []string
+		move         string
+		legal        bool
+	}{
+		{"standard pinned knight", "Standard", []string{"d4", "e6", "Nc3", "Bb4"}, "Ne4", false},
+		{"standard unpinned knight", "Standard", []string{"d4", "e6", "Nc3", "Bb4"}, "Nf3", true},
+		{"standard ignoring check", "Standard", []string{"e4", "d6", "Bb5+"}, "a6", false},
+		{"standard blocking check", "Standard", []string{"e4", "d6", "Bb5+"}, "c6", true},
+		{"standard opponent's pawn", "Standard", []string{"e4"}, "e4", false},
+		{"three check ignoring check", "ThreeCheck", []string{"e4", "d6", "Bb5+"}, "a6", false},
+		{"three check blocking check", "ThreeCheck", []string{"e4", "d6", "Bb5+"}, "Nc6", true},
+		{"horsies pawn", "Horsies", nil, "e4", true},
+		{"horsies disambiguated knight", "Horsies", nil, "Nbc3", true},
+		{"horsies ambiguous knight", "Horsies", nil, "Nc3", false},
+		{"chess960 pawn", "Chess960(1)", nil, "e4", true},
+		{"chess960 disambiguated knight", "Chess960(1)", nil, "Nfg3", true},
+		{"chess960 ambiguous knight", "Chess960(1)", nil, "Ng3", false},
+		{"chess960 castle off the standard layout", "Chess960(1)", []string{"e4", "e5", "Nhg3", "Nhg6", "Ne3", "Ne6"}, "O-O", false},
+		{"chess960 bishop", "Chess960(2)", []string{"e4", "e5"}, "Bg4", true},
+		{"racing kings giving check", "RacingKings", nil, "Nc3", false},
+		{"racing kings capture giving check", "RacingKings", nil, "Nxc1", false},
+		{"racing kings quiet knight", "RacingKings", nil, "Nd3", true},
+		{"racing kings king", "RacingKings", nil, "Kh3", true},
+		{"crazyhouse drop from the pocket", "Crazyhouse", []string{"e4", "d5", "exd5", "Qxd5"}, "P@e4", true},
+		{"crazyhouse drop not in the pocket", "Crazyhouse", []string{"e4", "d5", "exd5", "Qxd5"}, "N@f3", false},
+		{"crazyhouse drop on a piece", "Crazyhouse", []string{"e4", "d5", "exd5", "Qxd5"}, "P@d5", false},
+		{"crazyhouse drop blocking check", "Crazyhouse", []string{"e4", "d5", "exd5", "Qxd5", "Nc3", "Qe5+"}, "P@e2", true},
+		{"crazyhouse drop ignoring check", "Crazyhouse", []string{"e4", "d5", "exd5", "Qxd5", "Nc3", "Qe5+"}, "P@a3", false},
+		{"crazyhouse move ignoring check", "Crazyhouse", []string{"e4", "d5", "exd5", "Qxd5", "Nc3", "Qe5+"}, "a3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := testGame(tt.chessVariant, tt.moves...)
+			board := game.board()
+			if board == nil {
+				t.Fatalf("no board for %s after %v", tt.chessVariant, tt.moves)
+			}
+			team := moveTeam(len(tt.moves))
+
+			err := variantRules(tt.chessVariant).CheckMove(&game, board, tt.move, team)
+			if (err == nil) != tt.legal {
+				t.Errorf("CheckMove(%s) = %v, want legal %t", tt.move, err, tt.legal)
+			}
+
+			listed := slices.ContainsFunc(legalMoves(&game, board, team), func(move LegalMove) bool {
+				return strings.TrimRight(move.SAN, "+#") == tt.move
+			})
+			if listed != tt.legal {
+				t.Errorf("LegalMoves lists %s = %t, want %t", tt.move, listed, tt.legal)
+			}
+		})
+	}
+}
+
+func TestUnfollowedVariantsCheckGrammarOnly(t *testing.T) {
+	for _, chessVariant := range []string{"Horde", "Kawns", "Chess960"} {
+		t.Run(chessVariant, func(t *testing.T) {
+			game := testGame(chessVariant, "e4")
+			if board := game.board(); board != nil {
+				t.Fatalf("%s has a board: %s", chessVariant, board)
+			}
+			if err := checkVariantMove(&game, "Qh5"); err != nil {
+				t.Errorf("checkVariantMove = %v, want the move left to the client", err)
+			}
+		})
+	}
+}
+
+// Each layout is the one the client's src/uchess.rs builds. Horde's white
+// pawns on b5, c5, f5 and g5 come from create_horde_board.
+func TestVariantFEN(t *testing.T) {
+	tests := []struct {
+		chessVariant string
+		starting     string
+		// Empty when the pgn board can't follow the variant
+		initial string
+	}{
+		{"Standard", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		{"Horde", "rnbqkbnr/pppppppp/8/1PP2PP1/PPPPPPPP/PPPPPPPP/PPPPPPPP/PPPPKPPP w kq - 0 1", ""},
+		{"Horsies", "nnnnknnn/pppppppp/8/8/8/8/PPPPPPPP/NNNNKNNN w - - 0 1", "nnnnknnn/pppppppp/8/8/8/8/PPPPPPPP/NNNNKNNN w - - 0 1"},
+		{"Kawns", "rbbqkbbr/nnnnnnnn/8/8/8/8/NNNNNNNN/RBBQKBBR w - - 0 1", ""},
+		{"RacingKings", "8/8/8/8/8/8/krbnNBRK/qrbnNBRQ w - - 0 1", "8/8/8/8/8/8/krbnNBRK/qrbnNBRQ w - - 0 1"},
+		{"ThreeCheck", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		{"Crazyhouse", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		{"Chess960(1)", "rbkqrnbn/pppppppp/8/8/8/8/PPPPPPPP/RBKQRNBN w - - 0 1", "rbkqrnbn/pppppppp/8/8/8/8/PPPPPPPP/RBKQRNBN w - - 0 1"},
+		{"MidBattle", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.chessVariant, func(t *testing.T) {
+			rules := variantRules(tt.chessVariant)
+			if got := rules.StartingFEN(tt.chessVariant); got != tt.starting {
+				t.Errorf("StartingFEN = %q, want %q", got, tt.starting)
+			}
+			if got := rules.InitialFEN(tt.chessVariant); got != tt.initial {
+				t.Errorf("InitialFEN = %q, want %q", got, tt.initial)
+			}
+			if len(tt.initial) == 0 {
+				return
+			}
+			board, err := pgn.NewBoardFEN(tt.initial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := board.String(); got != tt.initial {
+				t.Errorf("pgn reads the FEN back as %q", got)
+			}
+		})
+	}
+}
+
+func TestRejectedVariants(t *testing.T) {
+	tests := []string{
+		"",
+		"Chess960garbage",
+		"Chess960(12)x",
+		"xxStandard",
+		"Hordexyz",
+		"standard",
+		"Chess960(12345678901)",
+		"Standard Horde",
+	}
+
+	r := newTestServer(t, nil)
+	for _, chessVariant := range tests {
+		for _, path := range []string{"/create", "/seek"} {
+			status, body := call(t, r, http.MethodPost, path, url.Values{"player_key": {"host"}, "chess_variant": {chessVariant}})
+			if status != http.StatusBadRequest || body["code"] != ErrInvalidVariant.Code {
+				t.Errorf("%s %q = %d %v, want %d %s", path, chessVariant, status, body, http.StatusBadRequest, ErrInvalidVariant.Code)
+				continue
+			}
+			if supported, _ := body["supported_variants"].([]any); len(supported) != len(SupportedVariants) {
+				t.Errorf("%s %q listed %v as supported, want %v", path, chessVariant, body["supported_variants"], SupportedVariants)
+			}
+		}
+	}
+}
+
+// White moves first, so black gets one reply to draw once white's king
+// reaches the eighth rank
+func TestRacingKingsOutcome(t *testing.T) {
+	tests := []struct {
+		name       string
+		fen        string
+		moves      []string
+		wantResult GameResult
+		wantOver   bool
+	}{
+		{"white reaches with a reply to come", "8/1k4K1/8/8/8/8/8/8 w - - 0 1", []string{"Kg8"}, "", false},
+		{"black replies to draw", "8/1k4K1/8/8/8/8/8/8 w - - 0 1", []string{"Kg8", "Kb8"}, GameResultDraw, true},
+		{"black replies short of the rank", "8/1k4K1/8/8/8/8/8/8 w - - 0 1", []string{"Kg8", "Kc6"}, GameResultWhite, true},
+		{"black too far back to reply", "8/6K1/1k6/8/8/8/8/8 w - - 0 1", []string{"Kg8"}, GameResultWhite, true},
+		// The rooks and knight cover a8, b8 and c8
+		{"black's squares covered", "8/1k1N2K1/8/8/8/8/R1R5/8 w - - 0 1", []string{"Kg8"}, GameResultWhite, true},
+		{"black reaches first", "8/1k6/8/8/8/8/6K1/8 w - - 0 1", []string{"Kg3", "Kb8"}, GameResultBlack, true},
+		{"neither there", "8/1k6/8/8/8/8/6K1/8 w - - 0 1", []string{"Kg3", "Kb6"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withVariant(t, "RacingKingsTest", racingKingsVariant{standardVariant{fen: tt.fen}})
+			game := testGame("RacingKingsTest", tt.moves...)
+			if game.board() == nil {
+				t.Fatalf("can't play %v from %s", tt.moves, tt.fen)
+			}
+
+			result, termination, over := variantOutcome(&game)
+			if result != tt.wantResult || over != tt.wantOver {
+				t.Errorf("variantOutcome = %q, %t, want %q, %t", result, over, tt.wantResult, tt.wantOver)
+			}
+			if over && termination != TerminationKingRace {
+				t.Errorf("termination = %q, want %q", termination, TerminationKingRace)
+			}
+		})
+	}
+}
+
+func TestThreeCheck(t *testing.T) {
+	// White checks once with the queen, black twice with the bishop
+	checks := []string{"e4", "e5", "Bb5", "Nc6", "Bxc6", "dxc6", "Qh5", "Nf6", "Qxf7+", "Kxf7", "d4", "Bb4+", "c3", "Bxc3+", "Nxc3", "Qxd4"}
+
+	tests := []struct {
+		name       string
+		moves      []string
+		wantChecks map[PlayerTeam]int
+		wantResult GameResult
+		wantOver   bool
+	}{
+		{"no checks", []string{"e4", "e5"}, map[PlayerTeam]int{PlayerTeamWhite: 0, PlayerTeamBlack: 0}, "", false},
+		{"checks for each side", checks[:12], map[PlayerTeam]int{PlayerTeamWhite: 1, PlayerTeamBlack: 1}, "", false},
+		{"two checks", checks[:14], map[PlayerTeam]int{PlayerTeamWhite: 1, PlayerTeamBlack: 2}, "", false},
+		{"third check", []string{"e4", "e5", "Bc4", "Nc6", "Bxf7+", "Kxf7", "Qh5+", "Ke7", "Qxe5+"}, map[PlayerTeam]int{PlayerTeamWhite: 3, PlayerTeamBlack: 0}, GameResultWhite, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := testGame("ThreeCheck", tt.moves...)
+			if game.board() == nil {
+				t.Fatalf("can't play %v", tt.moves)
+			}
+
+			if got := countChecks(game.chessVariant, game.moves); !reflect.DeepEqual(got, tt.wantChecks) {
+				t.Errorf("countChecks = %v, want %v", got, tt.wantChecks)
+			}
+
+			result, termination, over := variantOutcome(&game)
+			if result != tt.wantResult || over != tt.wantOver {
+				t.Errorf("variantOutcome = %q, %t, want %q, %t", result, over, tt.wantResult, tt.wantOver)
+			}
+			if over && termination != TerminationThreeCheck {
+				t.Errorf("termination = %q, want %q", termination, TerminationThreeCheck)
+			}
+		})
+	}
+}
+
+// stalematedWinsVariant gives a stalemate to the side with no moves, the way
+// Antichess does
+type stalematedWinsVariant struct {
+	standardVariant
+}
+
+func (stalematedWinsVariant) StalemateResult(team PlayerTeam) GameResult {
+	return GameResult(team)
+}
+
+func TestNoMovesOutcome(t *testing.T) {
+	// Qg6 leaves the black king no move, Qg7 mates it
+	const queenNearKing = "7k/8/8/6Q1/8/8/8/K5R1 w - - 0 1"
+
+	tests := []struct {
+		name            string
+		variant         Variant
+		move            string
+		wantResult      GameResult
+		wantTermination Termination
+		wantOver        bool
+	}{
+		{"standard stalemate", standardVariant{fen: queenNearKing}, "Qg6", GameResultDraw, TerminationStalemate, true},
+		{"standard checkmate", standardVariant{fen: queenNearKing}, "Qg7", GameResultWhite, TerminationCheckmate, true},
+		{"standard play on", standardVariant{fen: queenNearKing}, "Qg4", "", "", false},
+		{"variant's stalemate", stalematedWinsVariant{standardVariant{fen: queenNearKing}}, "Qg6", GameResultBlack, TerminationStalemate, true},
+		{"variant's checkmate", stalematedWinsVariant{standardVariant{fen: queenNearKing}}, "Qg7", GameResultWhite, TerminationCheckmate, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withVariant(t, "NoMovesTest", tt.variant)
+			game := testGame("NoMovesTest", tt.move)
+			if game.board() == nil {
+				t.Fatalf("can't play %s", tt.move)
+			}
+
+			result, termination, over := variantOutcome(&game)
+			if result != tt.wantResult || termination != tt.wantTermination || over != tt.wantOver {
+				t.Errorf("variantOutcome = %q, %q, %t, want %q, %q, %t", result, termination, over, tt.wantResult, tt.wantTermination, tt.wantOver)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package uc2024
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":  config.Version,
+		"commit":   config.Commit,
+		"variants": SupportedVariants,
+	})
+}
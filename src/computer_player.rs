@@ -96,8 +96,11 @@ fn load_ai_player_group(
 
     for player_ai_group in player_ai_group.iter() {
         let mut player_ai_group = player_ai_group.1.clone();
+        let mirror_files = player_ai_group.schema_version < 1;
 
         for (name, profile) in player_ai_group.profiles.iter_mut() {
+            profile.piece_square_phases.mirror_files = mirror_files;
+            profile.piece_square_phases.centipawns = profile.table_scale == "centipawns";
             if name == "Not Idiot" {
                 profile.piece_square_phases = BEST_PIECE_SQUARE_PHASES.clone();
             }
@@ -555,9 +558,37 @@ pub struct PieceSquarePhases {
     pub opening: PieceSquareTables,
     pub middle_game: PieceSquareTables,
     pub end_game: PieceSquareTables,
+    // Profiles from before schema version 1 mirrored black's squares through
+    // the centre of the board, swapping files as well as ranks. Set from
+    // the group's version on load, and kept when presets go to a worker.
+    #[serde(default)]
+    pub mirror_files: bool,
+    // Profiles written with the "centipawns" table scale hold a bonus per
+    // square rather than the share of the player's landings on it. Set from
+    // the profile's table_scale on load.
+    #[serde(default)]
+    pub centipawns: bool,
 }
 
 impl PieceSquarePhases {
+    // Index into the tables for a black piece on the square at index
+    pub fn black_index(&self, index: usize) -> usize {
+        if self.mirror_files {
+            63 - index
+        } else {
+            index ^ 56
+        }
+    }
+
+    // What a table value is divided by to give pawns
+    pub fn square_scale(&self) -> f32 {
+        if self.centipawns {
+            100.
+        } else {
+            24.
+        }
+    }
+
     pub fn get_square_table(&self, phase: GamePhase, piece: Piece) -> &[f32] {
         let table = match phase {
             GamePhase::Opening => &self.opening,
@@ -578,12 +609,22 @@ pub struct PlayerAIProfile {
     pub piece_square_phases: PieceSquarePhases,
     pub check_bonus: f32,
     pub decision_algorithm: String,
+    // Which FEN fields the opening book is keyed by, the placement alone
+    // when missing
+    #[serde(default)]
+    pub position_key: String,
+    // Unit of the piece square tables, percentages when missing
+    #[serde(default)]
+    pub table_scale: String,
     #[serde(skip)]
     pub evaluation_presets: Option<EvaluationPresets>,
 }
 
 #[derive(serde::Deserialize, Asset, TypePath, Debug, Resource, Clone)]
 pub struct PlayerAIGroup {
+    // Missing from files written before the pgn parser versioned them
+    #[serde(default)]
+    schema_version: u32,
     profiles: HashMap<String, PlayerAIProfile>,
 }
 
@@ -629,8 +670,6 @@ fn process_profile_computer_turn(
     algebraic_moves: Res<AlgebraicMoves>,
     chess_state: Res<ChessState>,
 ) {
-    let position_hash = pgn_parser_hash(&chess_state.get_fen());
-
     for (entity, team, mut computer_player, com_profile, mut rng) in player_inputs.iter_mut() {
         if computer_player.next_move.is_some() {
             continue;
@@ -662,6 +701,9 @@ fn process_profile_computer_turn(
             PlayerTeam::Black => &profile.black,
         };
 
+        let position_hash =
+            pgn_parser_hash(&chess_state.get_position_key(&profile.position_key));
+
         debug!(
             "color: {} player: {}, turn: {} hash: {} fen: {}",
             team.to_string(),
@@ -1236,3 +1278,83 @@ async fn delayed_turn_eval<T: Rng>(
         selected_move: selected_move.to_string(),
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn tables() -> serde_json::Value {
+        serde_json::json!({
+            "pawn": vec![1; 64],
+            "knight": vec![2; 64],
+            "bishop": vec![3; 64],
+            "rook": vec![4; 64],
+            "queen": vec![5; 64],
+            "king": vec![6; 64],
+        })
+    }
+
+    // A profile the way tools/pgn-parser writes it with piece_square_output
+    // "both", including the fields the game doesn't read yet.
+    // TestProfileLoadsInGame keeps the parser writing everything this needs.
+    #[test]
+    fn loads_parser_profiles() {
+        let group = serde_json::json!({
+            "schema_version": 1,
+            "profiles": {
+                "Me": {
+                    "white": { "positions": { "abc": { "e4": 100 } }, "samples": { "abc": 1 } },
+                    "black": { "positions": {}, "entropy": {} },
+                    "depth": { "levels": [1, 2], "move_hit": [1, 1, 1, 1, 1, 1], "thinking_time": [1, 2] },
+                    "piece_weights": [1, 3, 3, 5, 9, 200],
+                    "piece_square_phases": {
+                        "opening": tables(),
+                        "middle_game": tables(),
+                        "end_game": tables(),
+                    },
+                    "tapered_piece_square_tables": {
+                        "opening": tables(),
+                        "end_game": tables(),
+                    },
+                    "check_bonus": 0.5,
+                    "decision_algorithm": "best",
+                    "aggression": {},
+                    "material": {},
+                },
+            },
+        });
+
+        let group: PlayerAIGroup = serde_json::from_value(group).unwrap();
+        let profile = group.get_profile("Me").unwrap();
+        let king = profile
+            .piece_square_phases
+            .get_square_table(GamePhase::EndGame, Piece::King);
+        assert_eq!(king.len(), 64);
+        assert_eq!(king[0], 6.);
+        assert_eq!(profile.table_scale, "");
+    }
+
+    #[test]
+    fn reads_the_table_scale() {
+        let mut profile: PlayerAIProfile = serde_json::from_value(serde_json::json!({
+            "white": { "positions": {} },
+            "black": { "positions": {} },
+            "depth": { "levels": [1], "move_hit": [1, 1, 1, 1, 1, 1], "thinking_time": [1, 2] },
+            "piece_weights": [1, 3, 3, 5, 9, 200],
+            "piece_square_phases": {
+                "opening": tables(),
+                "middle_game": tables(),
+                "end_game": tables(),
+            },
+            "check_bonus": 0.5,
+            "decision_algorithm": "best",
+            "table_scale": "centipawns",
+        }))
+        .unwrap();
+        assert_eq!(profile.table_scale, "centipawns");
+
+        profile.piece_square_phases.centipawns = profile.table_scale == "centipawns";
+        let presets = EvaluationPresets::new(&profile);
+        assert_eq!(presets.piece_square_phases.square_scale(), 100.);
+    }
+}
@@ -187,6 +187,8 @@ lazy_static! {
                 queen: queens.clone(),
                 king: king_end_game.clone(),
             },
+            mirror_files: false,
+            centipawns: false,
         }
     };
 }
@@ -419,10 +421,10 @@ fn evaluate_piece_square_location(
             for square in bb {
                 let mut index = square.to_index();
                 if color == chess::Color::Black {
-                    index = 63 - index;
+                    index = piece_square_phases.black_index(index);
                 }
 
-                let square_value = square_table[index] / 24.0;
+                let square_value = square_table[index] / piece_square_phases.square_scale();
 
                 position_score += match color {
                     chess::Color::White => square_value,
@@ -555,3 +557,104 @@ fn no_neighbor_on_west_file(pawns: &BitBoard) -> BitBoard {
 fn isolated_pawns(pawns: &BitBoard) -> BitBoard {
     no_neighbor_on_east_file(pawns) & no_neighbor_on_west_file(pawns)
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::str::FromStr;
+
+    // Tables worth their own index so every square scores differently
+    fn ramp_phases(mirror_files: bool) -> PieceSquarePhases {
+        let ramp: Vec<f32> = (0..64).map(|index| index as f32).collect();
+        let tables = PieceSquareTables {
+            pawn: ramp.clone(),
+            knight: ramp.clone(),
+            bishop: ramp.clone(),
+            rook: ramp.clone(),
+            queen: ramp.clone(),
+            king: ramp,
+        };
+
+        PieceSquarePhases {
+            opening: tables.clone(),
+            middle_game: tables.clone(),
+            end_game: tables,
+            mirror_files,
+            centipawns: false,
+        }
+    }
+
+    fn score(phases: &PieceSquarePhases, fen: &str) -> f32 {
+        let board = Board::from_str(fen).unwrap();
+        evaluate_piece_square_location(phases, &board, GamePhase::Opening)
+    }
+
+    #[test]
+    fn black_index_mirrors_ranks() {
+        let phases = ramp_phases(false);
+        // g1 is g8 for black, not b8
+        assert_eq!(phases.black_index(6), 62);
+        assert_eq!(phases.black_index(0), 56);
+        assert_eq!(phases.black_index(52), 12);
+
+        let old_phases = ramp_phases(true);
+        assert_eq!(old_phases.black_index(6), 57);
+    }
+
+    #[test]
+    fn mirrored_positions_score_symmetrically() {
+        // Each position and the same position with the colours swapped and
+        // the board flipped across the ranks
+        let positions = [
+            (
+                "rnbqkbnr/pppppppp/8/8/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2",
+                "rnbqkb1r/pppp1ppp/5n2/4p3/8/8/PPPPPPPP/RNBQKBNR w KQkq - 1 2",
+            ),
+            (
+                "rnbqkbnr/pppppppp/8/8/P6P/8/1PPPPPP1/RNBQKBNR b KQkq - 0 2",
+                "rnbqkbnr/1pppppp1/8/p6p/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 2",
+            ),
+            (
+                "r1bqkbnr/pppppppp/2n5/8/8/5N2/PPPPPPPP/RNBQKB1R w KQkq - 2 2",
+                "rnbqkb1r/pppppppp/5n2/8/8/2N5/PPPPPPPP/R1BQKBNR b KQkq - 2 2",
+            ),
+        ];
+
+        let phases = ramp_phases(false);
+        for (position, mirrored) in positions {
+            let position_score = score(&phases, position);
+            assert_ne!(position_score, 0.0, "{} scored level", position);
+            // The squares are summed in a different order so allow rounding
+            let mirrored_score = score(&phases, mirrored);
+            assert!((position_score + mirrored_score).abs() < 1e-4, "{}", position);
+        }
+    }
+
+    #[test]
+    fn centipawn_tables_score_in_pawns() {
+        let mut phases = ramp_phases(false);
+        let mut table = vec![0.; 64];
+        // e4
+        table[28] = 100.;
+        phases.opening.knight = table;
+        // The kings are on each other's mirror square so only the knight
+        // scores
+        let position = "4k3/8/8/8/4N3/8/8/4K3 w - - 0 1";
+
+        let percentages = score(&phases, position);
+        phases.centipawns = true;
+        let centipawns = score(&phases, position);
+        assert!((percentages - 100. / 24.).abs() < 1e-4);
+        assert!((centipawns - 1.).abs() < 1e-4);
+    }
+
+    #[test]
+    fn old_profiles_keep_centre_mirroring() {
+        // Swapping the colours and turning the board around scores the same
+        // under the old mirroring
+        let phases = ramp_phases(true);
+        let position = "rnbqkbnr/pppppppp/8/8/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2";
+        let rotated = "r1bkqbnr/ppp1pppp/2n5/3p4/8/8/PPPPPPPP/RNBKQBNR w - - 1 2";
+        assert!((score(&phases, position) + score(&phases, rotated)).abs() < 1e-4);
+    }
+}
@@ -565,6 +565,69 @@ impl ChessState {
         &self.fen
     }
 
+    // The opening book key the pgn parser writes for its position_key
+    // option. "castling" adds the castling rights to the placement and
+    // "full" the en passant square as well, anything else is the placement.
+    pub fn get_position_key(&self, position_key: &str) -> String {
+        match position_key {
+            "castling" => format!("{} {}", self.fen, self.castling_field()),
+            "full" => format!(
+                "{} {} {}",
+                self.fen,
+                self.castling_field(),
+                self.en_passant_field()
+            ),
+            _ => self.fen.clone(),
+        }
+    }
+
+    // Castling rights as they appear in a FEN, - when neither side has any
+    fn castling_field(&self) -> String {
+        let mut field = String::new();
+        for (color, king_side, queen_side) in [
+            (chess::Color::White, 'K', 'Q'),
+            (chess::Color::Black, 'k', 'q'),
+        ] {
+            let rights = self.current_position.castle_rights(color);
+            if rights.has_kingside() {
+                field.push(king_side);
+            }
+            if rights.has_queenside() {
+                field.push(queen_side);
+            }
+        }
+
+        if field.is_empty() {
+            field.push('-');
+        }
+        field
+    }
+
+    // The square a pawn skipped with its last move. The pgn parser's board
+    // writes it after every double step, not only when it can be taken, so
+    // the chess crate's own en passant square doesn't match.
+    fn en_passant_field(&self) -> String {
+        let mov = match self.get_last_move() {
+            Some(mov) => mov,
+            None => return "-".to_string(),
+        };
+
+        let from = mov.get_source().get_rank().to_index();
+        let to = mov.get_dest().get_rank().to_index();
+        if self.current_position.piece_on(mov.get_dest()) != Some(Piece::Pawn)
+            || from.abs_diff(to) != 2
+        {
+            return "-".to_string();
+        }
+
+        let skipped = chess::Rank::from_index((from + to) / 2);
+        format!(
+            "{}{}",
+            file_to_string(mov.get_dest().get_file()),
+            rank_to_string(skipped)
+        )
+    }
+
     fn generate_algebraic_moves(&self) -> AlgebraicMoves {
         let mut result = AlgebraicMoves::default();
 
@@ -1193,3 +1256,60 @@ pub fn hash_board(board: &Board) -> u64 {
     }
     hash
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    // server/uc2024/chess960_test.go pins the same layouts for the server's
+    // copy of the shuffle
+    #[test]
+    fn chess960_layouts_match_the_server() {
+        let layouts = [
+            (0, "nrnbkrbq/pppppppp/8/8/8/8/PPPPPPPP/NRNBKRBQ w -"),
+            (1, "rbkqrnbn/pppppppp/8/8/8/8/PPPPPPPP/RBKQRNBN w -"),
+            (2, "rnnbkrbq/pppppppp/8/8/8/8/PPPPPPPP/RNNBKRBQ w -"),
+            (42, "rkrbbnnq/pppppppp/8/8/8/8/PPPPPPPP/RKRBBNNQ w -"),
+            (518, "qrnnbbkr/pppppppp/8/8/8/8/PPPPPPPP/QRNNBBKR w -"),
+            (u32::MAX, "rnbbqkrn/pppppppp/8/8/8/8/PPPPPPPP/RNBBQKRN w -"),
+        ];
+
+        for (seed, want) in layouts {
+            let fen = ChessVariant::Chess960(seed).create_board().to_string();
+            let fields: Vec<&str> = fen.split(' ').take(3).collect();
+            assert_eq!(fields.join(" "), want, "seed {}", seed);
+        }
+    }
+
+    #[test]
+    fn position_keys_match_the_pgn_parser() {
+        let mut state = ChessState::new(ChessVariant::Standard);
+        state.apply_move(ChessMove::new(Square::E2, Square::E4, None));
+
+        let placement = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR";
+        assert_eq!(state.get_position_key(""), placement);
+        assert_eq!(state.get_position_key("placement"), placement);
+        assert_eq!(
+            state.get_position_key("castling"),
+            format!("{} KQkq", placement)
+        );
+        assert_eq!(
+            state.get_position_key("full"),
+            format!("{} KQkq e3", placement)
+        );
+
+        // Only a double step leaves an en passant square
+        state.apply_move(ChessMove::new(Square::G8, Square::F6, None));
+        assert_eq!(
+            state.get_position_key("full"),
+            "rnbqkb1r/pppppppp/5n2/8/4P3/8/PPPP1PPP/RNBQKBNR KQkq -"
+        );
+
+        // Moving the king gives up both of white's castles
+        state.apply_move(ChessMove::new(Square::E1, Square::E2, None));
+        assert_eq!(
+            state.get_position_key("castling"),
+            "rnbqkb1r/pppppppp/5n2/8/4P3/8/PPPPKPPP/RNBQ1BNR kq"
+        );
+    }
+}
@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// AggressionProfile describes how readily the player trades pieces, so the
+// AI can lean towards the same exchange behaviour.
+type AggressionProfile struct {
+	// Share of all the player's moves that were captures, 0 to 1.
+	CaptureRate float32 `json:"capture_rate"`
+	// Percentage of the player's moves onto each square that were captures,
+	// from the player's side of the board (a1 = 0, h8 = 63).
+	Squares [64]int `json:"squares"`
+}
+
+// isCapture reads the capture marker from a SAN move, which is also written
+// for en passant.
+func isCapture(move string) bool {
+	return strings.Contains(move, "x")
+}
+
+func addMoveKind(counts *PlayerCounts, move string, index int) {
+	if isCapture(move) {
+		counts.Captures[index]++
+	} else {
+		counts.QuietMoves[index]++
+	}
+}
+
+func buildAggression(counts *PlayerCounts) AggressionProfile {
+	aggression := AggressionProfile{}
+
+	captures, total := 0, 0
+	for i := range counts.Captures {
+		squareTotal := counts.Captures[i] + counts.QuietMoves[i]
+		if squareTotal > 0 {
+			aggression.Squares[i] = counts.Captures[i] * 100 / squareTotal
+		}
+		captures += counts.Captures[i]
+		total += squareTotal
+	}
+
+	if total > 0 {
+		aggression.CaptureRate = float32(captures) / float32(total)
+	}
+
+	return aggression
+}
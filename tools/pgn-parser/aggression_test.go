@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+func TestAggression(t *testing.T) {
+	tests := []struct {
+		name string
+		game PgnGame
+		rate float32
+		// Capture percentage by square, from Me's side of the board
+		squares map[string]int
+	}{
+		{
+			name:    "white",
+			game:    PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "d5", "exd5", "Qxd5", "Nc3", "Qa5", "d4")},
+			rate:    0.25,
+			squares: map[string]int{"d5": 100, "e4": 0, "c3": 0, "d4": 0},
+		},
+		{
+			// d5 and Qxd5 both land on d5, which is d4 seen from black
+			name:    "black",
+			game:    PgnGame{White: "You", Black: "Me", Variant: "Standard", Moves: moves("e4", "d5", "exd5", "Qxd5")},
+			rate:    0.5,
+			squares: map[string]int{"d4": 50, "d5": 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			aggression := buildAggression(replayCounts(t, test.game))
+			if aggression.CaptureRate != test.rate {
+				t.Errorf("capture_rate = %v, want %v", aggression.CaptureRate, test.rate)
+			}
+			for square, want := range test.squares {
+				position, _ := pgn.ParsePosition(square)
+				if got := aggression.Squares[squareIndex(position)]; got != want {
+					t.Errorf("%s = %d, want %d", square, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAggressionEmpty(t *testing.T) {
+	if got := buildAggression(NewPlayerCounts()); got != (AggressionProfile{}) {
+		t.Errorf("buildAggression with no moves = %+v, want zero", got)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+const (
+	DefaultBlunderDepth     = 12
+	DefaultBlunderThreshold = 200
+	// Centipawns a forced mate is scored as, less a little per move so
+	// quicker mates still score higher
+	mateScore = 100000
+)
+
+// BlunderFilter leaves the player's blunders out of the profile by asking a
+// UCI engine such as Stockfish about each of their moves. Every move costs
+// two searches so it is off unless an engine is given.
+type BlunderFilter struct {
+	// Path to the engine binary, empty disables the filter
+	Engine string `json:"engine"`
+	// Search depth for each evaluation, DefaultBlunderDepth when left out
+	Depth int `json:"depth"`
+	// Moves losing more centipawns than this against the engine's best
+	// move are skipped, DefaultBlunderThreshold when left out
+	Threshold int `json:"threshold"`
+}
+
+func (f BlunderFilter) Validate() error {
+	var errs []error
+	if f.Depth < 0 {
+		errs = append(errs, fmt.Errorf("blunder_filter.depth must not be negative, got %d", f.Depth))
+	}
+	if f.Threshold < 0 {
+		errs = append(errs, fmt.Errorf("blunder_filter.threshold must not be negative, got %d", f.Threshold))
+	}
+	return errors.Join(errs...)
+}
+
+func (f BlunderFilter) depth() int {
+	if f.Depth == 0 {
+		return DefaultBlunderDepth
+	}
+	return f.Depth
+}
+
+func (f BlunderFilter) threshold() int {
+	if f.Threshold == 0 {
+		return DefaultBlunderThreshold
+	}
+	return f.Threshold
+}
+
+// uciEngine is a running engine process spoken to over stdin and stdout.
+type uciEngine struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+}
+
+func startEngine(path string) (*uciEngine, error) {
+	cmd := exec.Command(path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	engine := &uciEngine{cmd: cmd, stdin: stdin, stdout: bufio.NewScanner(stdout)}
+	if err := engine.send("uci"); err != nil {
+		engine.close()
+		return nil, err
+	}
+	if err := engine.waitFor("uciok"); err != nil {
+		engine.close()
+		return nil, err
+	}
+	if err := engine.send("isready"); err != nil {
+		engine.close()
+		return nil, err
+	}
+	if err := engine.waitFor("readyok"); err != nil {
+		engine.close()
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+func (e *uciEngine) send(command string) error {
+	_, err := io.WriteString(e.stdin, command+"\n")
+	return err
+}
+
+func (e *uciEngine) waitFor(reply string) error {
+	for e.stdout.Scan() {
+		if strings.TrimSpace(e.stdout.Text()) == reply {
+			return nil
+		}
+	}
+	if err := e.stdout.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("engine exited waiting for %s", reply)
+}
+
+// evaluate searches the position and gives the score in centipawns for the
+// side to move. With a move given the search is limited to that move.
+func (e *uciEngine) evaluate(fen string, move string, depth int) (int, error) {
+	if err := e.send("position fen " + fen); err != nil {
+		return 0, err
+	}
+	search := fmt.Sprintf("go depth %d", depth)
+	if move != "" {
+		search += " searchmoves " + move
+	}
+	if err := e.send(search); err != nil {
+		return 0, err
+	}
+
+	score, scored := 0, false
+	for e.stdout.Scan() {
+		fields := strings.Fields(e.stdout.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "bestmove" {
+			if !scored {
+				return 0, errors.New("engine gave no score")
+			}
+			return score, nil
+		}
+		if fields[0] != "info" {
+			continue
+		}
+		if value, ok := parseScore(fields); ok {
+			score, scored = value, true
+		}
+	}
+	if err := e.stdout.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("engine exited mid search")
+}
+
+// parseScore reads the score from an info line, bounds from an unfinished
+// iteration are ignored.
+func parseScore(fields []string) (int, bool) {
+	for i := 0; i+2 < len(fields); i++ {
+		if fields[i] != "score" {
+			continue
+		}
+		if i+3 < len(fields) && (fields[i+3] == "lowerbound" || fields[i+3] == "upperbound") {
+			return 0, false
+		}
+
+		value, err := strconv.Atoi(fields[i+2])
+		if err != nil {
+			return 0, false
+		}
+		switch fields[i+1] {
+		case "cp":
+			return value, true
+		case "mate":
+			if value < 0 {
+				return -mateScore - value, true
+			}
+			return mateScore - value, true
+		}
+	}
+	return 0, false
+}
+
+func (e *uciEngine) close() {
+	e.send("quit")
+	e.stdin.Close()
+	e.cmd.Wait()
+}
+
+// enginePool hands out one engine per replaying worker.
+type enginePool struct {
+	filter  BlunderFilter
+	engines chan *uciEngine
+	started []*uciEngine
+	// The first failed evaluation is reported, the rest would only repeat it
+	failed sync.Once
+}
+
+// startEngines starts size engines for the filter. It gives nil, leaving
+// every move in, when no engine is configured or it can't be started.
+func (f BlunderFilter) startEngines(size int) *enginePool {
+	if f.Engine == "" {
+		return nil
+	}
+
+	pool := &enginePool{filter: f, engines: make(chan *uciEngine, size)}
+	for i := 0; i < size; i++ {
+		engine, err := startEngine(f.Engine)
+		if err != nil {
+			fmt.Printf("Blunder filter disabled, starting %s: %v\n", f.Engine, err)
+			pool.close()
+			return nil
+		}
+		pool.started = append(pool.started, engine)
+		pool.engines <- engine
+	}
+
+	return pool
+}
+
+// isBlunder is whether move loses more than the threshold against the best
+// move in the position. Moves the engine couldn't judge are kept.
+func (pool *enginePool) isBlunder(fen string, move pgn.Move) bool {
+	engine := <-pool.engines
+	defer func() { pool.engines <- engine }()
+
+	depth := pool.filter.depth()
+	best, err := engine.evaluate(fen, "", depth)
+	if err == nil {
+		var played int
+		played, err = engine.evaluate(fen, uciMove(move), depth)
+		if err == nil {
+			return best-played > pool.filter.threshold()
+		}
+	}
+
+	pool.failed.Do(func() {
+		fmt.Printf("Blunder filter couldn't evaluate a move, keeping it: %v\n", err)
+	})
+	return false
+}
+
+func (pool *enginePool) close() {
+	for _, engine := range pool.started {
+		engine.close()
+	}
+}
+
+// uciMove writes a move in the engine's coordinate notation, e7e8q.
+func uciMove(move pgn.Move) string {
+	uci := move.From.String() + move.To.String()
+	if move.Promote != pgn.NoPiece {
+		uci += strings.ToLower(string(move.Promote))
+	}
+	return uci
+}
@@ -0,0 +1,37 @@
+package main
+
+// addCaptureSquare tallies a piece that landed on the square by capturing.
+// Quiet arrivals aren't tallied separately, they are the rest of the
+// phase's piece square count.
+func addCaptureSquare(counts *PlayerCounts, phase GamePhase, piece string, index int) {
+	if _, ok := counts.CaptureSquares[phase]; !ok {
+		counts.CaptureSquares[phase] = map[string][64]int{}
+	}
+	table := counts.CaptureSquares[phase][piece]
+	table[index]++
+	counts.CaptureSquares[phase][piece] = table
+}
+
+// splitCaptures fills in the phase's tables for squares reached by a
+// capture and squares reached quietly, each normalised on its own.
+func (g *GenerateInput) splitCaptures(tables *PieceSquareTables, counts *PlayerCounts, phase GamePhase) {
+	captures := map[string][64]int{}
+	quiet := map[string][64]int{}
+	for _, piece := range pieces {
+		key := string(piece)
+		captureValues, quietValues := [64]float64{}, [64]float64{}
+		for i, count := range counts.PieceSquares[phase][key] {
+			captured := counts.CaptureSquares[phase][key][i]
+			captureValues[i] = float64(captured)
+			quietValues[i] = float64(count - captured)
+		}
+
+		captures[key] = g.weightedSquares(phase, key, captureValues)
+		quiet[key] = g.weightedSquares(phase, key, quietValues)
+	}
+
+	captureTables := PieceSquareTableNew(captures)
+	quietTables := PieceSquareTableNew(quiet)
+	tables.Captures = &captureTables
+	tables.Quiet = &quietTables
+}
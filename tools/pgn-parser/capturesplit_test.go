@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+func TestSplitCaptures(t *testing.T) {
+	game := PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "d5", "exd5", "Qxd5", "Nc3", "Qa5", "d4")}
+
+	input := &GenerateInput{PlayerName: "Me", SplitCaptures: true}
+	opening := input.BuildProfile(replayCountsWith(t, input, game)).PiecePhaseTable.Opening
+	if opening.Captures == nil || opening.Quiet == nil {
+		t.Fatalf("split tables missing, captures %v quiet %v", opening.Captures, opening.Quiet)
+	}
+
+	tests := []struct {
+		name  string
+		table [64]int
+		// Percentage by square, unlisted squares are zero
+		squares map[string]int
+	}{
+		{"captured pawn", opening.Captures.Pawn, map[string]int{"d5": 100}},
+		{"quiet pawn", opening.Quiet.Pawn, map[string]int{"e4": 50, "d4": 50}},
+		{"captured knight", opening.Captures.Knight, nil},
+		{"quiet knight", opening.Quiet.Knight, map[string]int{"c3": 100}},
+	}
+
+	for _, test := range tests {
+		want := [64]int{}
+		for square, value := range test.squares {
+			position, _ := pgn.ParsePosition(square)
+			want[squareIndex(position)] = value
+		}
+		if test.table != want {
+			t.Errorf("%s = %v, want %v", test.name, test.table, want)
+		}
+	}
+
+	// The whole table still counts every arrival
+	pawn := opening.Pawn
+	for _, square := range []string{"e4", "d5", "d4"} {
+		position, _ := pgn.ParsePosition(square)
+		if pawn[squareIndex(position)] == 0 {
+			t.Errorf("pawn %s missing from the whole table", square)
+		}
+	}
+}
+
+func TestSplitCapturesOff(t *testing.T) {
+	game := PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "d5", "exd5")}
+
+	input := &GenerateInput{PlayerName: "Me"}
+	opening := input.BuildProfile(replayCountsWith(t, input, game)).PiecePhaseTable.Opening
+	if opening.Captures != nil || opening.Quiet != nil {
+		t.Errorf("split tables set without split_captures, captures %v quiet %v", opening.Captures, opening.Quiet)
+	}
+}
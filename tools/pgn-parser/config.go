@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// overrideFlags collects repeated -set flags.
+type overrideFlags []string
+
+func (o *overrideFlags) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrideFlags) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
+// applyOverrides applies each "<player>.<field>=<value>" override to the
+// matching profiles. The player may be "*" to target every profile and the
+// field is the JSON key path, e.g. "Mango.piece_values.pawn=1.2". Values are
+// parsed as JSON and fall back to a plain string.
+func applyOverrides(profiles []GenerateInput, overrides []string) error {
+	for _, override := range overrides {
+		target, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return fmt.Errorf("override %q is missing a value", override)
+		}
+
+		playerName, field, ok := strings.Cut(target, ".")
+		if !ok {
+			return fmt.Errorf("override %q is missing a field", override)
+		}
+
+		matched := false
+		for i := range profiles {
+			if playerName != "*" && profiles[i].PlayerName != playerName {
+				continue
+			}
+
+			if err := profiles[i].setField(field, value); err != nil {
+				return fmt.Errorf("override %q: %w", override, err)
+			}
+			matched = true
+		}
+
+		if !matched {
+			return fmt.Errorf("override %q: no profile named %s", override, playerName)
+		}
+	}
+
+	return nil
+}
+
+func (g *GenerateInput) setField(field string, value string) error {
+	fields := map[string]any{}
+	{
+		data, err := json.Marshal(g)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+	}
+
+	keys := strings.Split(field, ".")
+	current := fields
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			return fmt.Errorf("unknown field %s", field)
+		}
+		current = next
+	}
+
+	last := keys[len(keys)-1]
+	if _, ok := current[last]; !ok {
+		return fmt.Errorf("unknown field %s", field)
+	}
+
+	var parsed any
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		parsed = value
+	}
+	current[last] = parsed
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	updated := GenerateInput{}
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", field, err)
+	}
+	*g = updated
+
+	return nil
+}
+
+// Validate checks the config for mistakes that would otherwise silently
+// produce a broken or empty profile.
+func (g *GenerateInput) Validate() error {
+	var errs []error
+
+	if g.PlayerName == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+
+	if g.FileName == "" {
+		errs = append(errs, errors.New("file is required"))
+	} else if _, err := os.Stat(g.FileName); err != nil {
+		errs = append(errs, fmt.Errorf("file: %w", err))
+	}
+
+	pieceValues := map[string]float32{
+		"pawn":   g.PieceValueTable.Pawn,
+		"knight": g.PieceValueTable.Knight,
+		"bishop": g.PieceValueTable.Bishop,
+		"rook":   g.PieceValueTable.Rook,
+		"queen":  g.PieceValueTable.Queen,
+	}
+	for _, piece := range []string{"pawn", "knight", "bishop", "rook", "queen"} {
+		if pieceValues[piece] <= 0 {
+			errs = append(errs, fmt.Errorf("piece_values.%s must be positive, got %v", piece, pieceValues[piece]))
+		}
+	}
+
+	if len(g.Depth.Depth) == 0 {
+		errs = append(errs, errors.New("depth.levels must have at least one level"))
+	}
+	for i, weight := range g.Depth.Depth {
+		if weight < 0 {
+			errs = append(errs, fmt.Errorf("depth.levels[%d] must not be negative, got %d", i, weight))
+		}
+	}
+
+	// One hit chance per piece type, in pieces order
+	if len(g.Depth.MoveHit) != len(pieces) {
+		errs = append(errs, fmt.Errorf("depth.move_hit must have %d entries (%s), got %d", len(pieces), pieces, len(g.Depth.MoveHit)))
+	}
+	for i, hit := range g.Depth.MoveHit {
+		if hit < 0 || hit > 1 {
+			errs = append(errs, fmt.Errorf("depth.move_hit[%d] must be between 0 and 1, got %v", i, hit))
+		}
+	}
+
+	// Minimum and maximum thinking time in seconds
+	if len(g.Depth.ThinkingTime) != 2 {
+		errs = append(errs, fmt.Errorf("depth.thinking_time must have 2 entries (min, max), got %d", len(g.Depth.ThinkingTime)))
+	} else if g.Depth.ThinkingTime[0] < 0 || g.Depth.ThinkingTime[0] >= g.Depth.ThinkingTime[1] {
+		errs = append(errs, fmt.Errorf("depth.thinking_time must be a positive range with min < max, got %v", g.Depth.ThinkingTime))
+	}
+
+	if !slices.Contains(DecisionAlgorithms, g.DecisionAlgorithm) {
+		errs = append(errs, fmt.Errorf("unknown decision_algorithm %q, valid values are %v", g.DecisionAlgorithm, DecisionAlgorithms))
+	}
+
+	switch g.TableGating {
+	case "", TableGatingAlways, TableGatingQueensPresent, TableGatingMaterialThreshold:
+	default:
+		errs = append(errs, fmt.Errorf("unknown table_gating %q", g.TableGating))
+	}
+
+	if g.MaterialThreshold < 0 {
+		errs = append(errs, fmt.Errorf("material_threshold must not be negative, got %d", g.MaterialThreshold))
+	}
+
+	if g.MinElo < 0 || g.MaxElo < 0 {
+		errs = append(errs, fmt.Errorf("min_elo and max_elo must not be negative, got %d and %d", g.MinElo, g.MaxElo))
+	} else if g.MaxElo > 0 && g.MinElo > g.MaxElo {
+		errs = append(errs, fmt.Errorf("min_elo %d is above max_elo %d", g.MinElo, g.MaxElo))
+	}
+
+	if err := g.phaseBoundaries().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch g.PositionKey {
+	case "", PositionKeyPlacement, PositionKeyCastling, PositionKeyFull:
+	default:
+		errs = append(errs, fmt.Errorf("unknown position_key %q", g.PositionKey))
+	}
+
+	switch g.PieceSquareOutput {
+	case "", PieceSquareOutputPhases, PieceSquareOutputTapered, PieceSquareOutputBoth:
+	default:
+		errs = append(errs, fmt.Errorf("unknown piece_square_output %q", g.PieceSquareOutput))
+	}
+
+	switch g.TableScale {
+	case "", TableScalePercentages, TableScaleCentipawns:
+	default:
+		errs = append(errs, fmt.Errorf("unknown table_scale %q", g.TableScale))
+	}
+
+	switch g.BadMovePolicy {
+	case "", BadMovePolicyTruncate, BadMovePolicySkip:
+	default:
+		errs = append(errs, fmt.Errorf("unknown bad_move_policy %q", g.BadMovePolicy))
+	}
+
+	if g.OpponentEloTag != "" && strings.ContainsAny(g.OpponentEloTag, " \"") {
+		errs = append(errs, fmt.Errorf("opponent_elo_tag %q isn't a tag name", g.OpponentEloTag))
+	}
+
+	if g.CentipawnRange < 0 {
+		errs = append(errs, fmt.Errorf("centipawn_range must not be negative, got %d", g.CentipawnRange))
+	}
+
+	if err := g.Smoothing.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := g.BlunderFilter.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, validateTableWeights(g.TableWeights)...)
+
+	return errors.Join(errs...)
+}
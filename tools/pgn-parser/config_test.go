@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validConfig is a config entry like those in generate.json, reading from a
+// file that exists
+func validConfig(t *testing.T) GenerateInput {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "games.json")
+	if err := os.WriteFile(fileName, []byte("[]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var g GenerateInput
+	err := json.Unmarshal([]byte(`{
+		"name": "Me",
+		"piece_values": {"pawn": 1, "knight": 3, "bishop": 3, "rook": 5, "queen": 9},
+		"depth": {
+			"move_hit": [0.9, 0.85, 0.9, 0.9, 0.9, 0.9],
+			"levels": [0, 0, 5, 10, 70, 10, 5],
+			"thinking_time": [10.0, 60.0]
+		},
+		"check_bonus": 0.8,
+		"decision_algorithm": "alpha_beta"
+	}`), &g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.FileName = fileName
+	return g
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(g *GenerateInput)
+		// Part of the error, empty when the config is valid
+		want string
+	}{
+		{"valid", func(g *GenerateInput) {}, ""},
+		{"no name", func(g *GenerateInput) { g.PlayerName = "" }, "name is required"},
+		{"no file", func(g *GenerateInput) { g.FileName = "" }, "file is required"},
+		{"missing file", func(g *GenerateInput) { g.FileName += ".missing" }, "file:"},
+		{"zero piece value", func(g *GenerateInput) { g.PieceValueTable.Rook = 0 }, "piece_values.rook must be positive"},
+		{"no depth levels", func(g *GenerateInput) { g.Depth.Depth = nil }, "depth.levels must have at least one level"},
+		{"negative depth level", func(g *GenerateInput) { g.Depth.Depth[2] = -1 }, "depth.levels[2] must not be negative"},
+		{"short move hit", func(g *GenerateInput) { g.Depth.MoveHit = g.Depth.MoveHit[:5] }, "depth.move_hit must have 6 entries"},
+		{"move hit above one", func(g *GenerateInput) { g.Depth.MoveHit[0] = 1.5 }, "depth.move_hit[0] must be between 0 and 1"},
+		{"thinking time backwards", func(g *GenerateInput) { g.Depth.ThinkingTime = []float32{60, 10} }, "depth.thinking_time must be a positive range"},
+		{"one thinking time", func(g *GenerateInput) { g.Depth.ThinkingTime = []float32{10} }, "depth.thinking_time must have 2 entries"},
+		{"unknown gating", func(g *GenerateInput) { g.TableGating = "sometimes" }, `unknown table_gating "sometimes"`},
+		{"negative threshold", func(g *GenerateInput) { g.MaterialThreshold = -1 }, "material_threshold must not be negative"},
+		{"elo range backwards", func(g *GenerateInput) { g.MinElo, g.MaxElo = 2000, 1500 }, "min_elo 2000 is above max_elo 1500"},
+		{"negative elo", func(g *GenerateInput) { g.MinElo = -1 }, "must not be negative"},
+		{"phase boundaries crossed", func(g *GenerateInput) { g.PhaseBoundaries = PhaseBoundaries{Opening: 0.3, EndGame: 0.6} }, "phase boundary end_game"},
+		{"unknown position key", func(g *GenerateInput) { g.PositionKey = "everything" }, `unknown position_key "everything"`},
+		{"unknown output", func(g *GenerateInput) { g.PieceSquareOutput = "flat" }, `unknown piece_square_output "flat"`},
+		{"unknown scale", func(g *GenerateInput) { g.TableScale = "pawns" }, `unknown table_scale "pawns"`},
+		{"unknown bad move policy", func(g *GenerateInput) { g.BadMovePolicy = "ignore" }, `unknown bad_move_policy "ignore"`},
+		{"elo tag with a space", func(g *GenerateInput) { g.OpponentEloTag = "Black Elo" }, "isn't a tag name"},
+		{"negative centipawn range", func(g *GenerateInput) { g.CentipawnRange = -5 }, "centipawn_range must not be negative"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := validConfig(t)
+			test.change(&g)
+			err := g.Validate()
+
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+// Every mistake is reported at once rather than one per run
+func TestValidateJoinsErrors(t *testing.T) {
+	g := validConfig(t)
+	g.PlayerName = ""
+	g.TableScale = "pawns"
+
+	err := g.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want two errors")
+	}
+	for _, want := range []string{"name is required", "unknown table_scale"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to contain %q", err, want)
+		}
+	}
+}
+
+func TestValidateDecisionAlgorithm(t *testing.T) {
+	tests := []struct {
+		algorithm DecisionAlgorithm
+		valid     bool
+	}{
+		{DecisionAlgorithmAlphaBeta, true},
+		{DecisionAlgorithmNegaMax, true},
+		// The game has no default to fall back on
+		{"", false},
+		{"minimax", false},
+		{"Alpha_Beta", false},
+	}
+
+	for _, test := range tests {
+		g := validConfig(t)
+		g.DecisionAlgorithm = test.algorithm
+		err := g.Validate()
+		if test.valid && err != nil {
+			t.Errorf("decision_algorithm %q: Validate() = %v, want nil", test.algorithm, err)
+		}
+		if !test.valid && (err == nil || !strings.Contains(err.Error(), "unknown decision_algorithm")) {
+			t.Errorf("decision_algorithm %q: Validate() = %v, want unknown decision_algorithm", test.algorithm, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PlayerCounts are the raw tallies a profile is normalised from. Unlike the
+// percentages in PlayerAIProfile they can be summed, so new games can be
+// merged into a previous run without replaying the old ones.
+type PlayerCounts struct {
+	// Position hash to SAN move to times played
+	White map[string]map[string]int `json:"white"`
+	Black map[string]map[string]int `json:"black"`
+	// Position hash to moves recorded there, which the position maps only
+	// match when the book isn't weighted
+	WhiteSamples map[string]int                   `json:"white_samples,omitempty"`
+	BlackSamples map[string]int                   `json:"black_samples,omitempty"`
+	PieceSquares map[GamePhase]map[string][64]int `json:"piece_squares"`
+	// The part of PieceSquares where the piece arrived by capturing
+	CaptureSquares map[GamePhase]map[string][64]int     `json:"capture_squares"`
+	Tapered        map[GamePhase]map[string][64]float64 `json:"tapered"`
+	// Destination square of every move, from the player's side of the
+	// board, split by whether it was a capture
+	Captures   [64]int `json:"captures"`
+	QuietMoves [64]int `json:"quiet_moves"`
+	// Material balance after the player's moves by phase
+	Material map[GamePhase]MaterialCounts `json:"material"`
+}
+
+type CountsGroup struct {
+	Profiles map[string]*PlayerCounts `json:"profiles"`
+}
+
+func NewPlayerCounts() *PlayerCounts {
+	counts := &PlayerCounts{
+		White:          map[string]map[string]int{},
+		Black:          map[string]map[string]int{},
+		WhiteSamples:   map[string]int{},
+		BlackSamples:   map[string]int{},
+		Material:       map[GamePhase]MaterialCounts{},
+		PieceSquares:   map[GamePhase]map[string][64]int{},
+		CaptureSquares: map[GamePhase]map[string][64]int{},
+		// Opening and end game counts weighted by the phase score
+		Tapered: map[GamePhase]map[string][64]float64{
+			Opening: {},
+			EndGame: {},
+		},
+	}
+	for _, phase := range []GamePhase{Opening, MiddleGame, EndGame} {
+		counts.PieceSquares[phase] = map[string][64]int{}
+	}
+
+	return counts
+}
+
+func mergePositions(into map[string]map[string]int, from map[string]map[string]int) {
+	for position, moves := range from {
+		if _, ok := into[position]; !ok {
+			into[position] = map[string]int{}
+		}
+		for move, count := range moves {
+			into[position][move] += count
+		}
+	}
+}
+
+// Merge adds every tally in other to c.
+func (c *PlayerCounts) Merge(other *PlayerCounts) {
+	mergePositions(c.White, other.White)
+	mergePositions(c.Black, other.Black)
+	for position, samples := range other.WhiteSamples {
+		c.WhiteSamples[position] += samples
+	}
+	for position, samples := range other.BlackSamples {
+		c.BlackSamples[position] += samples
+	}
+
+	for phase, phaseTable := range other.PieceSquares {
+		if _, ok := c.PieceSquares[phase]; !ok {
+			c.PieceSquares[phase] = map[string][64]int{}
+		}
+		for piece, values := range phaseTable {
+			merged := c.PieceSquares[phase][piece]
+			for i, count := range values {
+				merged[i] += count
+			}
+			c.PieceSquares[phase][piece] = merged
+		}
+	}
+
+	for phase, phaseTable := range other.CaptureSquares {
+		if _, ok := c.CaptureSquares[phase]; !ok {
+			c.CaptureSquares[phase] = map[string][64]int{}
+		}
+		for piece, values := range phaseTable {
+			merged := c.CaptureSquares[phase][piece]
+			for i, count := range values {
+				merged[i] += count
+			}
+			c.CaptureSquares[phase][piece] = merged
+		}
+	}
+
+	for phase, tally := range other.Material {
+		merged := c.Material[phase]
+		merged.Moves += tally.Moves
+		merged.Balance += tally.Balance
+		merged.Behind += tally.Behind
+		merged.Ahead += tally.Ahead
+		c.Material[phase] = merged
+	}
+
+	for i := range other.Captures {
+		c.Captures[i] += other.Captures[i]
+		c.QuietMoves[i] += other.QuietMoves[i]
+	}
+
+	for phase, phaseTable := range other.Tapered {
+		if _, ok := c.Tapered[phase]; !ok {
+			c.Tapered[phase] = map[string][64]float64{}
+		}
+		for piece, values := range phaseTable {
+			for i, weight := range values {
+				addSquareWeight(c.Tapered[phase], piece, i, weight)
+			}
+		}
+	}
+}
+
+// sidecarPath is where the counts for an output file go by default,
+// "profiles.json" becomes "profiles.counts.json".
+func sidecarPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".counts.json"
+}
+
+// loadCounts reads a counts file written by a previous run, a missing file
+// is treated as an empty one.
+func loadCounts(path string) (CountsGroup, error) {
+	group := CountsGroup{Profiles: map[string]*PlayerCounts{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return group, nil
+	} else if err != nil {
+		return group, err
+	}
+
+	if err := json.Unmarshal(data, &group); err != nil {
+		return group, err
+	}
+
+	// Fill in anything an older or hand edited file left out
+	for name, stored := range group.Profiles {
+		counts := NewPlayerCounts()
+		counts.Merge(stored)
+		group.Profiles[name] = counts
+	}
+
+	return group, nil
+}
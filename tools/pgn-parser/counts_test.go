@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var countsGames = []PgnGame{
+	{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "e5", "Nf3", "Nc6", "Bb5", "a6", "Bxc6", "dxc6", "O-O")},
+	{White: "You", Black: "Me", Variant: "Standard", Moves: moves("d4", "d5", "c4", "dxc4", "e3", "Nf6", "Bxc4", "e6")},
+}
+
+// countGames tallies games in one run for the player called Me
+func countGames(games ...PgnGame) *PlayerCounts {
+	counts := NewPlayerCounts()
+	gen := (&GenerateInput{PlayerName: "Me"}).newGeneration(counts)
+	for i := range games {
+		gen.addGame(&games[i])
+	}
+	return counts
+}
+
+// sameCounts compares counts exactly, bar the tapered weights whose sums
+// depend on the order they were added in
+func sameCounts(t *testing.T, got *PlayerCounts, want *PlayerCounts) {
+	t.Helper()
+	gotTapered, wantTapered := got.Tapered, want.Tapered
+	gotCopy, wantCopy := *got, *want
+	gotCopy.Tapered, wantCopy.Tapered = nil, nil
+	if !reflect.DeepEqual(gotCopy, wantCopy) {
+		t.Errorf("counts differ\ngot  %+v\nwant %+v", gotCopy, wantCopy)
+	}
+
+	for phase, tables := range wantTapered {
+		for piece, values := range tables {
+			for i, value := range values {
+				if math.Abs(gotTapered[phase][piece][i]-value) > 1e-9 {
+					t.Errorf("tapered %s %s square %d = %v, want %v", phase, piece, i, gotTapered[phase][piece][i], value)
+				}
+			}
+		}
+	}
+}
+
+func TestCountsFileRoundTrip(t *testing.T) {
+	counts := countGames(countsGames...)
+	path := filepath.Join(t.TempDir(), "profiles.counts.json")
+	data, err := json.Marshal(CountsGroup{Profiles: map[string]*PlayerCounts{"Me": counts}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := loadCounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameCounts(t, group.Profiles["Me"], counts)
+
+	input := &GenerateInput{PlayerName: "Me"}
+	if got, want := input.BuildProfile(group.Profiles["Me"]), input.BuildProfile(counts); !reflect.DeepEqual(got, want) {
+		t.Errorf("profile from loaded counts differs\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+// Games added to a previous run's counts give what one run over every game
+// would have
+func TestMergeMatchesOneRun(t *testing.T) {
+	merged := countGames(countsGames[0])
+	merged.Merge(countGames(countsGames[1]))
+
+	sameCounts(t, merged, countGames(countsGames...))
+}
+
+func TestLoadCountsMissingFile(t *testing.T) {
+	group, err := loadCounts(filepath.Join(t.TempDir(), "missing.counts.json"))
+	if err != nil || len(group.Profiles) != 0 {
+		t.Errorf("loadCounts(missing) = %+v, %v, want an empty group", group, err)
+	}
+}
+
+// An older file without the newer tallies still loads with them empty
+func TestLoadCountsFillsGaps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.counts.json")
+	if err := os.WriteFile(path, []byte(`{"profiles": {"Me": {"white": {"abc": {"e4": 2}}}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := loadCounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := group.Profiles["Me"]
+	if counts.White["abc"]["e4"] != 2 {
+		t.Errorf("white book = %v, want e4 twice", counts.White)
+	}
+	if counts.Black == nil || counts.PieceSquares[EndGame] == nil || counts.Tapered[Opening] == nil || counts.Material == nil {
+		t.Errorf("loaded counts left tallies nil: %+v", counts)
+	}
+}
+
+func TestSidecarPath(t *testing.T) {
+	tests := map[string]string{
+		"profiles.json":        "profiles.counts.json",
+		"out/ai.profiles.json": "out/ai.profiles.counts.json",
+		"profiles":             "profiles.counts.json",
+	}
+	for output, want := range tests {
+		if got := sidecarPath(output); got != want {
+			t.Errorf("sidecarPath(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
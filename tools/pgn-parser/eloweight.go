@@ -0,0 +1,41 @@
+package main
+
+import "gopkg.in/freeeve/pgn.v1"
+
+// DefaultOpponentElo stands in for opponents without a rating tag when the
+// book is weighted by rating.
+const DefaultOpponentElo = 1500
+
+func (g *GenerateInput) opponentEloTag() string {
+	if g.OpponentEloTag == "" {
+		return "Elo"
+	}
+	return g.OpponentEloTag
+}
+
+// bookWeight is how many times one of the player's book moves in game is
+// counted, one for every 100 rating points of the opponent when weighting
+// is on. Whole numbers keep the counts summable across runs.
+func (g *GenerateInput) bookWeight(game *PgnGame, playerTeam pgn.Color) int {
+	if !g.EloWeighting {
+		return 1
+	}
+
+	elo, ok := game.EloFrom(SwitchTurn(playerTeam), g.opponentEloTag())
+	if !ok {
+		elo = DefaultOpponentElo
+	}
+
+	return max(1, (elo+50)/100)
+}
+
+// bookSamples is how many moves back each position. Counts files written
+// before samples were kept fall back to summing the position's moves.
+func bookSamples(positions map[string]map[string]int, samples map[string]int) map[string]int {
+	result := positionSamples(positions)
+	for position, count := range samples {
+		result[position] = count
+	}
+
+	return result
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+func TestBookWeight(t *testing.T) {
+	game := &PgnGame{
+		White:    "Me",
+		Black:    "You",
+		WhiteElo: "1200",
+		BlackElo: "2149",
+		Tags:     map[string]string{"BlackFideElo": "2420", "WhiteFideElo": "?"},
+	}
+
+	tests := []struct {
+		name  string
+		input GenerateInput
+		team  pgn.Color
+		want  int
+	}{
+		{"off", GenerateInput{}, pgn.White, 1},
+		// The opponent's rating, rounded to the nearest hundred
+		{"black opponent", GenerateInput{EloWeighting: true}, pgn.White, 21},
+		{"white opponent", GenerateInput{EloWeighting: true}, pgn.Black, 12},
+		{"other tag", GenerateInput{EloWeighting: true, OpponentEloTag: "FideElo"}, pgn.White, 24},
+		{"unrated", GenerateInput{EloWeighting: true, OpponentEloTag: "FideElo"}, pgn.Black, DefaultOpponentElo / 100},
+		{"missing tag", GenerateInput{EloWeighting: true, OpponentEloTag: "UscfElo"}, pgn.White, DefaultOpponentElo / 100},
+	}
+
+	for _, test := range tests {
+		if got := test.input.bookWeight(game, test.team); got != test.want {
+			t.Errorf("%s: bookWeight = %d, want %d", test.name, got, test.want)
+		}
+	}
+
+	// Never below one, or a weak opponent's games would drop out
+	weak := &PgnGame{WhiteElo: "20"}
+	if got := (&GenerateInput{EloWeighting: true}).bookWeight(weak, pgn.Black); got != 1 {
+		t.Errorf("bookWeight against 20 = %d, want 1", got)
+	}
+}
+
+// The stronger opponent's game outweighs the other in the percentages, but
+// the samples still count games
+func TestEloWeightedBook(t *testing.T) {
+	games := []PgnGame{
+		{White: "Me", Black: "You", BlackElo: "2400", Variant: "Standard", Moves: moves("e4", "e5")},
+		{White: "Me", Black: "You", BlackElo: "800", Variant: "Standard", Moves: moves("d4", "d5")},
+	}
+	input := &GenerateInput{PlayerName: "Me", EloWeighting: true}
+	counts := NewPlayerCounts()
+	gen := input.newGeneration(counts)
+	for i := range games {
+		gen.addGame(&games[i])
+	}
+	profile := input.BuildProfile(counts)
+
+	start := hash(input.positionKey(pgn.NewBoard().String()))
+	if got, want := counts.White[start], map[string]int{"e4": 24, "d4": 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("start position counts = %v, want %v", got, want)
+	}
+	if got, want := profile.White.Positions[start], map[string]int{"e4": 75, "d4": 25}; !reflect.DeepEqual(got, want) {
+		t.Errorf("start position moves = %v, want %v", got, want)
+	}
+	if got := profile.White.Samples[start]; got != 2 {
+		t.Errorf("start position samples = %d, want 2", got)
+	}
+}
+
+// Counts files from before samples were kept sum the moves instead
+func TestBookSamplesFallback(t *testing.T) {
+	positions := map[string]map[string]int{
+		"a": {"e4": 2, "d4": 1},
+		"b": {"Nf3": 4},
+	}
+
+	tests := []struct {
+		name    string
+		samples map[string]int
+		want    map[string]int
+	}{
+		{"kept", map[string]int{"a": 2, "b": 1}, map[string]int{"a": 2, "b": 1}},
+		{"missing", nil, map[string]int{"a": 3, "b": 4}},
+		{"partly kept", map[string]int{"b": 1}, map[string]int{"a": 3, "b": 1}},
+	}
+	for _, test := range tests {
+		if got := bookSamples(positions, test.samples); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: bookSamples = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// bookEntropy is the Shannon entropy in bits of each position's move
+// choices. Zero means the player always makes the same move there, log2 of
+// the number of moves means they pick between them evenly. It is worked out
+// from the raw counts as the percentages are rounded down.
+func bookEntropy(positions map[string]map[string]int) map[string]float64 {
+	result := map[string]float64{}
+	for key, positionCount := range positions {
+		total := 0
+		for _, count := range positionCount {
+			total += count
+		}
+
+		// Summed in a fixed order so the same counts always give the same
+		// bits, map order would change the rounding from run to run
+		var counts []int
+		for _, count := range positionCount {
+			counts = append(counts, count)
+		}
+		slices.Sort(counts)
+		entropy := 0.0
+		for _, count := range counts {
+			if count <= 0 {
+				continue
+			}
+			p := float64(count) / float64(total)
+			entropy -= p * math.Log2(p)
+		}
+		result[key] = entropy
+	}
+
+	return result
+}
+
+// meanEntropy averages the entropy over every book position
+func meanEntropy(entropy map[string]float64) float64 {
+	if len(entropy) == 0 {
+		return 0
+	}
+
+	var values []float64
+	for _, value := range entropy {
+		values = append(values, value)
+	}
+	slices.Sort(values)
+
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(entropy))
+}
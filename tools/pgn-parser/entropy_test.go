@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+func TestBookEntropy(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves map[string]int
+		want  float64
+	}{
+		{"one move", map[string]int{"e4": 7}, 0},
+		{"two even", map[string]int{"e4": 3, "d4": 3}, 1},
+		{"four even", map[string]int{"e4": 1, "d4": 1, "c4": 1, "Nf3": 1}, 2},
+		// 3/4 and 1/4
+		{"uneven", map[string]int{"e4": 3, "d4": 1}, 0.8112781244591328},
+		{"zero counts ignored", map[string]int{"e4": 2, "d4": 0}, 0},
+	}
+
+	for _, test := range tests {
+		got := bookEntropy(map[string]map[string]int{"position": test.moves})["position"]
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: entropy = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMeanEntropy(t *testing.T) {
+	if got := meanEntropy(nil); got != 0 {
+		t.Errorf("mean of no positions = %v, want 0", got)
+	}
+	if got := meanEntropy(map[string]float64{"a": 0, "b": 1, "c": 2}); got != 1 {
+		t.Errorf("mean = %v, want 1", got)
+	}
+}
+
+// Two games that split at the first move leave the start position with one
+// bit, and each position after it with none
+func TestEntropyProfile(t *testing.T) {
+	input := &GenerateInput{PlayerName: "Me"}
+	counts := NewPlayerCounts()
+	games := []PgnGame{
+		{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "e5")},
+		{White: "Me", Black: "You", Variant: "Standard", Moves: moves("d4", "d5")},
+	}
+	gen := input.newGeneration(counts)
+	for i := range games {
+		gen.addGame(&games[i])
+	}
+	profile := input.BuildProfile(counts)
+
+	start := hash(input.positionKey(pgn.NewBoard().String()))
+	if got := profile.White.Entropy[start]; got != 1 {
+		t.Errorf("start position entropy = %v, want 1", got)
+	}
+	if len(profile.White.Entropy) != len(profile.White.Positions) {
+		t.Errorf("%d entropies for %d positions", len(profile.White.Entropy), len(profile.White.Positions))
+	}
+	for key, entropy := range profile.White.Entropy {
+		if key != start && entropy != 0 {
+			t.Errorf("%s entropy = %v, want 0", key, entropy)
+		}
+	}
+}
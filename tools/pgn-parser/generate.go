@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// streamGames decodes the games in a file one at a time rather than holding
+// the whole database in memory. Files ending in .pgn are read as PGN, anything
+// else as a JSON array of games.
+func streamGames(fileName string, handle func(game *PgnGame)) error {
+	input, err := openInput(fileName)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	if isPGNFile(fileName) {
+		if err := readPGN(input, handle); err != nil {
+			return fmt.Errorf("parsing %s: %w", fileName, err)
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(input)
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("parsing %s: %w", fileName, err)
+	}
+
+	for decoder.More() {
+		var game PgnGame
+		if err := decoder.Decode(&game); err != nil {
+			return fmt.Errorf("parsing %s: %w", fileName, err)
+		}
+		game.Variant = normalizeVariant(game.Variant)
+		handle(&game)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("parsing %s: %w", fileName, err)
+	}
+
+	return nil
+}
+
+type generationResult struct {
+	profile PlayerAIProfile
+	stats   GenerationStats
+}
+
+// generateProfilesByFile reads each distinct file once, feeding every game to
+// all the profiles that train on it. Results are in the same order as inputs.
+// A file that fails to parse doesn't stop the others, its profiles only get
+// the games read before the failure. More than one worker replays the games
+// in parallel.
+func generateProfilesByFile(inputs []GenerateInput, countsGroup CountsGroup, workers int) ([]generationResult, error) {
+	var files []string
+	byFile := map[string][]int{}
+	for i, g := range inputs {
+		if _, ok := byFile[g.FileName]; !ok {
+			files = append(files, g.FileName)
+		}
+		byFile[g.FileName] = append(byFile[g.FileName], i)
+	}
+
+	var errs []error
+	results := make([]generationResult, len(inputs))
+	for _, fileName := range files {
+		var generations []*generation
+		for _, i := range byFile[fileName] {
+			g := &inputs[i]
+			gen := g.newGeneration(countsGroup.Profiles[g.PlayerName])
+			// An engine per worker so evaluations run in parallel too
+			gen.engines = g.BlunderFilter.startEngines(max(workers, 1))
+			generations = append(generations, gen)
+		}
+
+		stream := func(handle func(game *PgnGame)) error {
+			return streamGames(fileName, handle)
+		}
+		var err error
+		if workers > 1 {
+			err = replayParallel(generations, workers, stream)
+		} else {
+			err = stream(func(game *PgnGame) {
+				for _, gen := range generations {
+					gen.addGame(game)
+				}
+			})
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		for j, i := range byFile[fileName] {
+			profile, stats := generations[j].finish()
+			results[i] = generationResult{profile: profile, stats: stats}
+			if generations[j].engines != nil {
+				generations[j].engines.close()
+			}
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Profiles sharing a file are fed from one read of it, which has to leave
+// each of them as if it had read the file alone
+func TestSharedFileMatchesSeparateRuns(t *testing.T) {
+	inputs := testInputs(writeGames(t, openingGames()))
+
+	shared := CountsGroup{Profiles: map[string]*PlayerCounts{}}
+	for _, g := range inputs {
+		shared.Profiles[g.PlayerName] = NewPlayerCounts()
+	}
+	results, err := generateProfilesByFile(inputs, shared, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, g := range inputs {
+		alone := CountsGroup{Profiles: map[string]*PlayerCounts{g.PlayerName: NewPlayerCounts()}}
+		want, err := generateProfilesByFile([]GenerateInput{g}, alone, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(results[i], want[0]) {
+			t.Errorf("%s came out differently when sharing the file", g.PlayerName)
+		}
+		if !reflect.DeepEqual(shared.Profiles[g.PlayerName], alone.Profiles[g.PlayerName]) {
+			t.Errorf("%s counted differently when sharing the file", g.PlayerName)
+		}
+	}
+}
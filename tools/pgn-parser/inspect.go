@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+)
+
+// runInspect is the inspect subcommand, which summarises a profile someone
+// else generated without needing their games. It gives the exit code, 1
+// when the file or profile is malformed.
+func runInspect(w io.Writer, args []string) int {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	profilesPath := flags.String("profiles", "player_profiles.computer.json", "profiles file to inspect")
+	player := flags.String("player", "", "profile to inspect, may be left out when the file only has one")
+	tables := flags.Bool("tables", false, "print every piece square table as well")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	group, err := loadProfiles(*profilesPath)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	name, profile, err := pickProfile(group, *player)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	if err := profile.check(); err != nil {
+		fmt.Fprintf(w, "%s: %v\n", name, err)
+		return 1
+	}
+
+	writeInspection(w, name, group.SchemaVersion, profile)
+	if *tables {
+		writeProfileTables(w, profile)
+	}
+
+	return 0
+}
+
+func loadProfiles(path string) (PlayerAIGroup, error) {
+	var group PlayerAIGroup
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return group, err
+	}
+	if err := json.Unmarshal(data, &group); err != nil {
+		return group, fmt.Errorf("%s: %w", path, err)
+	}
+	if group.SchemaVersion > ProfileSchemaVersion {
+		return group, fmt.Errorf("%s: schema_version %d is newer than this tool understands (%d)", path, group.SchemaVersion, ProfileSchemaVersion)
+	}
+	if len(group.Profiles) == 0 {
+		return group, fmt.Errorf("%s: no profiles", path)
+	}
+
+	return group, nil
+}
+
+// pickProfile finds the named profile, or the only one when no name is
+// given
+func pickProfile(group PlayerAIGroup, player string) (string, PlayerAIProfile, error) {
+	var names []string
+	for name := range group.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if player == "" {
+		if len(names) != 1 {
+			return "", PlayerAIProfile{}, fmt.Errorf("pick a profile with -player, the file has %v", names)
+		}
+		player = names[0]
+	}
+
+	profile, ok := group.Profiles[player]
+	if !ok {
+		return "", PlayerAIProfile{}, fmt.Errorf("no profile %q, the file has %v", player, names)
+	}
+	return player, profile, nil
+}
+
+// check finds what the game couldn't load the profile without
+func (p PlayerAIProfile) check() error {
+	var errs []error
+	if len(p.PieceWeights) != len(pieces) {
+		errs = append(errs, fmt.Errorf("piece_weights must have %d entries (%s), got %d", len(pieces), pieces, len(p.PieceWeights)))
+	}
+	if !slices.Contains(DecisionAlgorithms, p.DecisionAlgorithm) {
+		errs = append(errs, fmt.Errorf("unknown decision_algorithm %q", p.DecisionAlgorithm))
+	}
+	// The game doesn't read the tapered tables yet
+	if p.PiecePhaseTable == nil {
+		errs = append(errs, errors.New("no piece_square_phases"))
+	}
+	return errors.Join(errs...)
+}
+
+// fillRate is the share of squares a phase's tables give any weight to, a
+// low rate means the player's games barely covered the phase
+func fillRate(tables PieceSquareTables) float64 {
+	filled := 0
+	for _, piece := range pieces {
+		for _, value := range tables.byPiece(piece) {
+			if value != 0 {
+				filled++
+			}
+		}
+	}
+	return float64(filled) / float64(len(pieces)*64)
+}
+
+func writeInspection(w io.Writer, name string, schemaVersion int, profile PlayerAIProfile) {
+	fmt.Fprintf(w, "==================== %s ====================\n", name)
+	fmt.Fprintf(w, "Schema version: %d\n", schemaVersion)
+	fmt.Fprintf(w, "Decision algorithm: %s\n", profile.DecisionAlgorithm)
+	fmt.Fprintf(w, "Piece weights:")
+	for i, piece := range pieces {
+		fmt.Fprintf(w, " %s %v", pieceNames[piece], profile.PieceWeights[i])
+	}
+	fmt.Fprintf(w, "\n")
+	fmt.Fprintf(w, "Check bonus: %v\n", profile.CheckBonus)
+
+	fmt.Fprintf(w, "Book positions: white %d black %d\n", len(profile.White.Positions), len(profile.Black.Positions))
+	// Files from before entropy was written have none to average
+	if len(profile.White.Entropy) > 0 || len(profile.Black.Entropy) > 0 {
+		fmt.Fprintf(w, "Book mean entropy: white %.2f black %.2f bits\n", meanEntropy(profile.White.Entropy), meanEntropy(profile.Black.Entropy))
+	}
+
+	if profile.PiecePhaseTable != nil {
+		fmt.Fprintf(w, "Table fill rate by phase:\n")
+		fmt.Fprintf(w, "  %-11s %6.2f%%\n", Opening, fillRate(profile.PiecePhaseTable.Opening)*100)
+		fmt.Fprintf(w, "  %-11s %6.2f%%\n", MiddleGame, fillRate(profile.PiecePhaseTable.MiddleGame)*100)
+		fmt.Fprintf(w, "  %-11s %6.2f%%\n", EndGame, fillRate(profile.PiecePhaseTable.EndGame)*100)
+	}
+	if profile.TaperedTables != nil {
+		fmt.Fprintf(w, "Tapered table fill rate:\n")
+		fmt.Fprintf(w, "  %-11s %6.2f%%\n", Opening, fillRate(profile.TaperedTables.Opening)*100)
+		fmt.Fprintf(w, "  %-11s %6.2f%%\n", EndGame, fillRate(profile.TaperedTables.EndGame)*100)
+	}
+}
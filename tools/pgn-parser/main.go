@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"math"
 	"math/bits"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,13 +29,144 @@ type PieceValueTableInput struct {
 	Queen  float32 `json:"queen"`
 }
 
+// TableGating controls which of the player's moves are allowed to update the
+// piece square tables.
+type TableGating string
+
+const (
+	// Every move updates the tables, the game phase split already keeps
+	// endgame positions out of the opening tables.
+	TableGatingAlways TableGating = "always"
+	// Only positions where at least one queen is still on the board.
+	TableGatingQueensPresent TableGating = "queens_present"
+	// Only positions with at least MaterialThreshold non pawn material.
+	TableGatingMaterialThreshold TableGating = "material_threshold"
+)
+
+// DecisionAlgorithm is the search the game engine uses to pick moves.
+type DecisionAlgorithm string
+
+const (
+	DecisionAlgorithmAlphaBeta DecisionAlgorithm = "alpha_beta"
+	DecisionAlgorithmNegaMax   DecisionAlgorithm = "nega_max"
+)
+
+var DecisionAlgorithms = []DecisionAlgorithm{
+	DecisionAlgorithmAlphaBeta,
+	DecisionAlgorithmNegaMax,
+}
+
+// PositionKey selects which FEN fields identify an opening book position.
+// More fields tell apart positions with the same layout but different
+// rights, at the cost of a larger book with fewer samples per position.
+type PositionKey string
+
+const (
+	// Piece placement only.
+	PositionKeyPlacement PositionKey = "placement"
+	// Piece placement and castling rights.
+	PositionKeyCastling PositionKey = "castling"
+	// Piece placement, castling rights and the en passant square.
+	PositionKeyFull PositionKey = "full"
+)
+
+// PieceSquareOutput selects which piece square tables end up in the profile.
+type PieceSquareOutput string
+
+const (
+	// Separate opening, middle game and end game tables with hard boundaries.
+	PieceSquareOutputPhases PieceSquareOutput = "phases"
+	// A single opening and end game pair for runtime interpolation. The
+	// game only reads the phase tables so far, so they are written too
+	// until it can load a profile without them.
+	PieceSquareOutputTapered PieceSquareOutput = "tapered"
+	// Emit both of the above.
+	PieceSquareOutputBoth PieceSquareOutput = "both"
+)
+
+// TableScale is the unit piece square table values are written in.
+type TableScale string
+
+const (
+	// Each table sums to roughly 100, a square's value is the share of the
+	// player's landings on it. The engine has to turn these into bonuses
+	// itself.
+	TableScalePercentages TableScale = "percentages"
+	// Each table is centred on its mean and scaled so the most and least
+	// visited squares sit at plus or minus CentipawnRange. The game reads
+	// table_scale from the profile and adds the value onto its evaluation
+	// in centipawns.
+	TableScaleCentipawns TableScale = "centipawns"
+)
+
+// BadMovePolicy is what happens to a game with a move the board can't follow.
+type BadMovePolicy string
+
+const (
+	// Keep the moves before the bad one and drop the rest of the game.
+	BadMovePolicyTruncate BadMovePolicy = "truncate"
+	// Log the game and leave all of it out, so the tables aren't tilted
+	// toward the openings of games that were cut short.
+	BadMovePolicySkip BadMovePolicy = "skip"
+)
+
+// DefaultCentipawnRange is the largest bonus or penalty a square gets in
+// centipawn tables when the config leaves it out.
+const DefaultCentipawnRange = 50
+
 type GenerateInput struct {
 	PlayerName        string                `json:"name"`
 	FileName          string                `json:"file"`
 	Depth             PlayerAIThinkingDepth `json:"depth"`
 	PieceValueTable   PieceValueTableInput  `json:"piece_values"`
 	CheckBonus        float32               `json:"check_bonus"`
-	DecisionAlgorithm string                `json:"decision_algorithm"`
+	DecisionAlgorithm DecisionAlgorithm     `json:"decision_algorithm"`
+	TableGating       TableGating           `json:"table_gating"`
+	MaterialThreshold int                   `json:"material_threshold"`
+	PieceSquareOutput PieceSquareOutput     `json:"piece_square_output"`
+	// Only train on games where the player's rating is inside the band,
+	// zero disables that side of the band.
+	MinElo int `json:"min_elo"`
+	MaxElo int `json:"max_elo"`
+	// Only train on games with one of these TimeControl tags, e.g. "180+2".
+	TimeControls []string `json:"time_controls"`
+	// Where the phase score is split into opening, middle and end game
+	// tables, DefaultPhaseBoundaries when left out.
+	PhaseBoundaries PhaseBoundaries `json:"phase_boundaries"`
+	// Skip games whose move list exactly matches an earlier game.
+	Deduplicate bool `json:"deduplicate"`
+	// FEN fields used to key the opening book, placement when left out.
+	PositionKey PositionKey `json:"position_key"`
+	// Smoothing applied to the piece square tables before they are
+	// normalised, off when left out.
+	Smoothing TableSmoothing `json:"smoothing"`
+	// Unit of the piece square tables, percentages when left out.
+	TableScale TableScale `json:"table_scale"`
+	// Largest centipawn bonus for a square with the centipawns scale,
+	// DefaultCentipawnRange when left out.
+	CentipawnRange int `json:"centipawn_range"`
+	// What to do with games containing a move the board can't follow,
+	// truncate when left out.
+	BadMovePolicy BadMovePolicy `json:"bad_move_policy"`
+	// Weight each opening book move by the opponent's rating, so moves
+	// played against strong opposition count for more.
+	EloWeighting bool `json:"elo_weighting"`
+	// Tag the opponent's rating is read from, prefixed with their colour,
+	// e.g. "FideElo" reads WhiteFideElo or BlackFideElo. "Elo" when left out.
+	OpponentEloTag string `json:"opponent_elo_tag"`
+	// Skip the player's moves a UCI engine rates as blunders, off when
+	// left out.
+	BlunderFilter BlunderFilter `json:"blunder_filter"`
+	// Add capture and quiet arrival tables to each phase's piece square
+	// tables.
+	SplitCaptures bool `json:"split_captures"`
+	// Scale of each piece's square tables by phase, e.g. a king weight
+	// above 1 in the end game makes the AI care more about king activity.
+	// Unweighted when left out.
+	TableWeights map[GamePhase]TableWeights `json:"table_weights"`
+	// Check each square against the board after the move and only count
+	// it when the player's own piece is there, off when left out.
+	OwnPiecesOnly bool `json:"own_pieces_only"`
 }
 
 type PgnMove struct {
@@ -37,14 +174,115 @@ type PgnMove struct {
 }
 
 type PgnGame struct {
-	White   string    `json:"White"`
-	Black   string    `json:"Black"`
-	Variant string    `json:"Variant"`
-	Moves   []PgnMove `json:"moves"`
+	White       string `json:"White"`
+	Black       string `json:"Black"`
+	WhiteElo    string `json:"WhiteElo"`
+	BlackElo    string `json:"BlackElo"`
+	TimeControl string `json:"TimeControl"`
+	Variant     string `json:"Variant"`
+	// FEN is the custom starting position from the SetUp and FEN tags,
+	// empty for games from the standard start.
+	FEN   string    `json:"FEN,omitempty"`
+	Moves []PgnMove `json:"moves"`
+	// Every tag of a game read from PGN, for the ones without a field
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// StartingBoard sets up the position the game started from and returns the
+// side to move in it.
+func (g *PgnGame) StartingBoard() (*pgn.Board, pgn.Color, error) {
+	if g.FEN == "" {
+		return pgn.NewBoard(), pgn.White, nil
+	}
+
+	fen, err := pgn.ParseFEN(g.FEN)
+	if err != nil {
+		return nil, pgn.NoColor, err
+	}
+	b, err := pgn.NewBoardFEN(g.FEN)
+	if err != nil {
+		return nil, pgn.NoColor, err
+	}
+
+	return b, fen.ToMove, nil
+}
+
+// modelled is whether the board can follow the game, standard chess from the
+// usual start or from a set up position.
+func (g *PgnGame) modelled() bool {
+	return g.Variant == "Standard" || (g.Variant == "FromPosition" && g.FEN != "")
+}
+
+// firstBadMove replays the game and returns the index of the first move the
+// board can't follow, -1 if every move is fine.
+func (g *PgnGame) firstBadMove() (int, error) {
+	b, turn, err := g.StartingBoard()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, move := range g.Moves {
+		if err := b.MakeAlgebraicMove(move.M, turn); err != nil {
+			return i, err
+		}
+		turn = SwitchTurn(turn)
+	}
+
+	return -1, nil
+}
+
+// MovesKey identifies a game by its moves alone, ignoring headers and the
+// check or annotation suffixes different exporters disagree on.
+func (g *PgnGame) MovesKey() [sha256.Size]byte {
+	moves := make([]string, len(g.Moves))
+	for i, move := range g.Moves {
+		moves[i] = strings.TrimRight(move.M, "+#!?")
+	}
+
+	// The same moves from different starting positions are different games
+	return sha256.Sum256([]byte(g.FEN + "\n" + strings.Join(moves, " ")))
+}
+
+// Elo returns the rating tag for team, false if it is missing or unknown
+// ("?" in PGN).
+func (g *PgnGame) Elo(team pgn.Color) (int, bool) {
+	return g.EloFrom(team, "Elo")
+}
+
+// EloFrom reads team's rating from the tag named by their colour followed by
+// suffix.
+func (g *PgnGame) EloFrom(team pgn.Color, suffix string) (int, bool) {
+	name := "Black" + suffix
+	if team == pgn.White {
+		name = "White" + suffix
+	}
+
+	tag := g.Tags[name]
+	switch name {
+	case "WhiteElo":
+		tag = g.WhiteElo
+	case "BlackElo":
+		tag = g.BlackElo
+	}
+
+	elo, err := strconv.Atoi(tag)
+	if err != nil {
+		return 0, false
+	}
+
+	return elo, true
 }
 
 type PlayerAITeamProfile struct {
+	// Position hash to SAN move to percentage of the times it was played
 	Positions map[string]map[string]int `json:"positions"`
+	// Position hash to how many of the player's moves back its percentages,
+	// so a move seen once can be trusted less than one seen hundreds of times
+	Samples map[string]int `json:"samples"`
+	// Position hash to the Shannon entropy of its moves in bits, low when the
+	// player has one clear favourite and high when their moves are scattered
+	// and search is the better guide
+	Entropy map[string]float64 `json:"entropy"`
 }
 
 type PieceSquareTables struct {
@@ -54,6 +292,11 @@ type PieceSquareTables struct {
 	Rook   [64]int `json:"rook"`
 	Queen  [64]int `json:"queen"`
 	King   [64]int `json:"king"`
+	// The same squares counting only pieces that arrived by capturing, and
+	// only those that arrived quietly. Set on the phase tables when
+	// split_captures is on.
+	Captures *PieceSquareTables `json:"captures,omitempty"`
+	Quiet    *PieceSquareTables `json:"quiet,omitempty"`
 }
 
 func PieceSquareTableNew(input map[string][64]int) PieceSquareTables {
@@ -73,6 +316,13 @@ type PieceSquarePhases struct {
 	EndGame    PieceSquareTables `json:"end_game"`
 }
 
+// TaperedPieceSquareTables are blended by the engine using the phase score
+// from GetPhaseScore: value = opening*phase + end_game*(1-phase).
+type TaperedPieceSquareTables struct {
+	Opening PieceSquareTables `json:"opening"`
+	EndGame PieceSquareTables `json:"end_game"`
+}
+
 type PlayerAIThinkingDepth struct {
 	Depth        []int     `json:"levels"`
 	MoveHit      []float32 `json:"move_hit"`
@@ -80,17 +330,26 @@ type PlayerAIThinkingDepth struct {
 }
 
 type PlayerAIProfile struct {
-	White             PlayerAITeamProfile   `json:"white"`
-	Black             PlayerAITeamProfile   `json:"black"`
-	Depth             PlayerAIThinkingDepth `json:"depth"`
-	PieceWeights      []float32             `json:"piece_weights"`
-	PiecePhaseTable   PieceSquarePhases     `json:"piece_square_phases"`
-	CheckBonus        float32               `json:"check_bonus"`
-	DecisionAlgorithm string                `json:"decision_algorithm"`
+	White             PlayerAITeamProfile       `json:"white"`
+	Black             PlayerAITeamProfile       `json:"black"`
+	Depth             PlayerAIThinkingDepth     `json:"depth"`
+	PieceWeights      []float32                 `json:"piece_weights"`
+	PiecePhaseTable   *PieceSquarePhases        `json:"piece_square_phases,omitempty"`
+	TaperedTables     *TaperedPieceSquareTables `json:"tapered_piece_square_tables,omitempty"`
+	CheckBonus        float32                   `json:"check_bonus"`
+	DecisionAlgorithm DecisionAlgorithm         `json:"decision_algorithm"`
+	PositionKey       PositionKey               `json:"position_key,omitempty"`
+	Aggression        AggressionProfile         `json:"aggression"`
+	// Material balance the player typically plays with in each phase
+	Material map[GamePhase]MaterialPhase `json:"material"`
+	// Left out for percentage tables so older engines keep reading them.
+	TableScale TableScale `json:"table_scale,omitempty"`
 }
 
 type PlayerAIGroup struct {
-	Profiles map[string]PlayerAIProfile `json:"profiles"`
+	// ProfileSchemaVersion of the layout the file was written with
+	SchemaVersion int                        `json:"schema_version"`
+	Profiles      map[string]PlayerAIProfile `json:"profiles"`
 }
 
 type GamePhase string
@@ -101,17 +360,64 @@ const (
 	EndGame    GamePhase = "end_game"
 )
 
-func GetGamePhase(board *pgn.Board) GamePhase {
-	fen := board.String()
-	// Counting the number of minor pieces (Bishops and Knights), major pieces (Rooks and Queens), and pawns.
-	minorPieces := strings.Count(fen, "b") + strings.Count(fen, "n") + strings.Count(fen, "B") + strings.Count(fen, "N")
-	majorPieces := strings.Count(fen, "r") + strings.Count(fen, "q") + strings.Count(fen, "R") + strings.Count(fen, "Q")
-	pawns := strings.Count(fen, "p") + strings.Count(fen, "P")
+// PhaseBoundaries splits the continuous phase score into discrete game
+// phases. Scores at or above Opening are the opening, scores at or below
+// EndGame are the end game and everything between is the middle game.
+// Raising Opening shortens the opening (it ends on the first trade), raising
+// EndGame moves more simplified middle games into the end game tables.
+type PhaseBoundaries struct {
+	Opening float32 `json:"opening"`
+	EndGame float32 `json:"end_game"`
+}
+
+var DefaultPhaseBoundaries = PhaseBoundaries{
+	Opening: 0.9,
+	EndGame: 0.35,
+}
+
+// Tapered evaluation weights for the non pawn pieces, the starting position
+// adds up to totalPhaseWeight.
+var phaseWeights = map[rune]int{'n': 1, 'b': 1, 'r': 2, 'q': 4}
+
+const totalPhaseWeight = 24
 
-	// Simple heuristic to determine the game phase
-	if pawns > 14 && minorPieces == 4 && majorPieces >= 4 {
+// GetPhaseScore returns how much of the starting non pawn material is still
+// on the board, from 1 for a full board down to 0 for kings and pawns only.
+func GetPhaseScore(board *pgn.Board) float32 {
+	placement := strings.Split(board.String(), " ")[0]
+
+	phase := 0
+	for _, c := range placement {
+		phase += phaseWeights[unicode.ToLower(c)]
+	}
+
+	// Promotions can push the weight past a full board
+	if phase > totalPhaseWeight {
+		phase = totalPhaseWeight
+	}
+
+	return float32(phase) / totalPhaseWeight
+}
+
+// Validate checks the boundaries fit inside the 0 to 1 phase score and leave
+// room for a middle game.
+func (p PhaseBoundaries) Validate() error {
+	if p.EndGame < 0 || p.Opening > 1 {
+		return fmt.Errorf("phase boundaries must be between 0 and 1, got end_game %v opening %v", p.EndGame, p.Opening)
+	}
+	if p.EndGame >= p.Opening {
+		return fmt.Errorf("phase boundary end_game %v must be below opening %v", p.EndGame, p.Opening)
+	}
+
+	return nil
+}
+
+func GetGamePhase(board *pgn.Board, boundaries PhaseBoundaries) GamePhase {
+	score := GetPhaseScore(board)
+
+	if score >= boundaries.Opening {
 		return Opening
-	} else if pawns <= 14 && minorPieces <= 4 && majorPieces <= 4 {
+	} else if score <= boundaries.EndGame {
 		return EndGame
 	}
 
@@ -167,33 +473,122 @@ func generatePieceCountString(fen string, team pgn.Color) string {
 	return result
 }
 
+// pieceMoved returns the piece that ends up on the destination square of a
+// SAN move, so promotions count towards the promoted piece.
 func pieceMoved(move string) string {
 	if strings.Contains(move, "O") {
 		return "k"
 	}
 
-	if strings.Contains(pieces, strings.ToLower(string(move[0]))) {
+	if i := strings.Index(move, "="); i >= 0 && i+1 < len(move) {
+		return strings.ToLower(string(move[i+1]))
+	}
+
+	// Piece letters are upper case, lower case is a pawn's file
+	if unicode.IsUpper(rune(move[0])) && strings.Contains(pieces, strings.ToLower(string(move[0]))) {
 		return strings.ToLower(string(move[0]))
 	}
 
 	return "p"
 }
 
-func convertToPercentages(toUpdate map[string]map[string]int) map[string]map[string]int {
-	for key, positionCount := range toUpdate {
+// pieceLanding is a piece arriving on a board index (a1 = 0, h8 = 63).
+type pieceLanding struct {
+	piece string
+	index int
+}
+
+// piecesLanded lists every piece that arrives on a new square from a move.
+// Castling moves both the king and the rook.
+func piecesLanded(move string, parsedMove pgn.Move) []pieceLanding {
+	to := bits.TrailingZeros64(uint64(parsedMove.To))
+	landed := []pieceLanding{{piece: pieceMoved(move), index: to}}
+
+	if strings.HasPrefix(move, "O-O") {
+		// The king lands on the g or c file and the rook lands next to it
+		// on the f or d file.
+		rook := to - 1
+		if strings.HasPrefix(move, "O-O-O") {
+			rook = to + 1
+		}
+		landed = append(landed, pieceLanding{piece: "r", index: rook})
+	}
+
+	return landed
+}
+
+// ownPiece is whether the piece on the square (a1 = 0) belongs to team.
+func ownPiece(b *pgn.Board, index int, team pgn.Color) bool {
+	piece := b.GetPiece(pgn.Position(uint64(1) << index))
+	return piece != pgn.NoPiece && piece.Color() == team
+}
+
+// positionSamples totals the moves recorded for each position.
+func positionSamples(positions map[string]map[string]int) map[string]int {
+	result := map[string]int{}
+	for key, positionCount := range positions {
+		for _, count := range positionCount {
+			result[key] += count
+		}
+	}
+
+	return result
+}
+
+// convertToPercentages gives each position's moves as a share of the times
+// the position was seen. The raw counts are left untouched so they can still
+// be merged or recomputed later.
+func convertToPercentages(positions map[string]map[string]int) map[string]map[string]int {
+	result := map[string]map[string]int{}
+	for key, positionCount := range positions {
 		total := float32(0)
 		for _, count := range positionCount {
 			total += float32(count)
 		}
 
+		result[key] = map[string]int{}
 		for move, count := range positionCount {
-			toUpdate[key][move] = int(float32(count) / total * 100)
+			result[key][move] = int(float32(count) / total * 100)
 		}
+	}
+
+	return result
+}
+
+// nonPawnMaterial sums the standard values of every knight, bishop, rook and
+// queen on the board for both sides.
+func nonPawnMaterial(fen string) int {
+	values := map[rune]int{'n': 3, 'b': 3, 'r': 5, 'q': 9}
 
-		toUpdate[key] = positionCount
+	material := 0
+	for _, c := range strings.Split(fen, " ")[0] {
+		material += values[unicode.ToLower(c)]
 	}
 
-	return toUpdate
+	return material
+}
+
+func (g *GenerateInput) shouldUpdateTables(fen string) bool {
+	switch g.TableGating {
+	case TableGatingQueensPresent:
+		board := strings.Split(fen, " ")[0]
+		return strings.ContainsAny(board, "Qq")
+	case TableGatingMaterialThreshold:
+		return nonPawnMaterial(fen) >= g.MaterialThreshold
+	}
+
+	return true
+}
+
+// relativeSquare converts a board index (a1 = 0, h8 = 63) into the index
+// from team's side of the board. Black's squares are mirrored across the
+// ranks only so a black piece on g8 lands on g1, not b1.
+func relativeSquare(index int, team pgn.Color) int {
+	if team == pgn.Black {
+		return index ^ 56
+	}
+
+	return index
 }
 
 func SwitchTurn(current pgn.Color) pgn.Color {
@@ -204,162 +599,437 @@ func SwitchTurn(current pgn.Color) pgn.Color {
 	}
 }
 
-func (g *GenerateInput) GenerateProfile() PlayerAIProfile {
-	fileName := g.FileName
-	playerName := g.PlayerName
-
-	totalUniqueGameStates := map[string]bool{}
-	totalGameStates := 0
+// squarePercentages normalises a table of weighted square counts so the
+// squares sum to roughly 100.
+func squarePercentages(values [64]float64) [64]int {
+	sum := 0.0
+	for _, count := range values {
+		sum += count
+	}
 
-	pieceSquareCounts := map[GamePhase]map[string][64]int{}
-	for _, phase := range []GamePhase{Opening, MiddleGame, EndGame} {
-		pieceSquareCounts[phase] = map[string][64]int{}
+	result := [64]int{}
+	if sum > 0 {
+		for i, count := range values {
+			result[i] = int(math.Ceil(count / sum * 100.0))
+		}
 	}
 
-	var games []PgnGame
+	return result
+}
 
-	{
-		data, _ := os.ReadFile(fileName)
-		json.Unmarshal(data, &games)
+// squareCentipawns centres a table of weighted square counts on its mean and
+// scales it so the furthest square from the mean is worth limit centipawns.
+func squareCentipawns(values [64]float64, limit int) [64]int {
+	mean := 0.0
+	for _, count := range values {
+		mean += count
 	}
+	mean /= float64(len(values))
 
-	player := PlayerAIProfile{
-		White: PlayerAITeamProfile{
-			Positions: map[string]map[string]int{},
-		},
-		Black: PlayerAITeamProfile{
-			Positions: map[string]map[string]int{},
-		},
+	spread := 0.0
+	for _, count := range values {
+		spread = math.Max(spread, math.Abs(count-mean))
 	}
 
-	for _, game := range games {
-		var playerProfile *PlayerAITeamProfile
-		var playerTeam pgn.Color
-		if game.White == playerName {
-			playerTeam = pgn.White
-			playerProfile = &player.White
-		} else {
-			playerTeam = pgn.Black
-			playerProfile = &player.Black
+	result := [64]int{}
+	if spread > 0 {
+		for i, count := range values {
+			result[i] = int(math.Round((count - mean) / spread * float64(limit)))
 		}
+	}
 
-		if game.Variant != "Standard" && game.Variant != "" {
-			continue
+	return result
+}
+
+// normaliseSquares smooths a table of weighted square counts and converts it
+// to the configured scale.
+func (g *GenerateInput) normaliseSquares(values [64]float64) [64]int {
+	values = g.Smoothing.apply(values)
+
+	if g.TableScale == TableScaleCentipawns {
+		limit := g.CentipawnRange
+		if limit == 0 {
+			limit = DefaultCentipawnRange
 		}
+		return squareCentipawns(values, limit)
+	}
+
+	return squarePercentages(values)
+}
+
+func addSquareWeight(table map[string][64]float64, piece string, index int, weight float64) {
+	values := table[piece]
+	values[index] += weight
+	table[piece] = values
+}
+
+// gzipReadCloser closes both the gzip stream and the file underneath it.
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// openInput opens a games file, transparently decompressing it when the
+// name ends in ".gz" so large exports don't have to be unpacked first.
+func openInput(fileName string) (io.ReadCloser, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(fileName, ".gz") {
+		return file, nil
+	}
 
-		currentTurn := pgn.White
-		b := pgn.NewBoard()
-		for i := 0; i < len(game.Moves); i++ {
-			// Gen FEN
-			gameState := b.String()
+	reader, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("opening gzip %s: %w", fileName, err)
+	}
+
+	return &gzipReadCloser{Reader: reader, file: file}, nil
+}
+
+// positionKey strips the FEN down to the fields configured to identify a
+// book position. The side to move is never needed as each team has its own
+// book.
+func (g *GenerateInput) positionKey(fen string) string {
+	fields := strings.Split(fen, " ")
+
+	switch g.PositionKey {
+	case PositionKeyCastling:
+		return fields[0] + " " + fields[2]
+	case PositionKeyFull:
+		return fields[0] + " " + fields[2] + " " + fields[3]
+	}
+
+	return fields[0]
+}
+
+func (g *GenerateInput) phaseBoundaries() PhaseBoundaries {
+	if g.PhaseBoundaries == (PhaseBoundaries{}) {
+		return DefaultPhaseBoundaries
+	}
 
-			parsedMove, err := b.MoveFromAlgebraic(game.Moves[i].M, currentTurn)
-			if err != nil {
-				// fmt.Printf("Game:%v Error parsing move: %s\n", game, err)
+	return g.PhaseBoundaries
+}
+
+// includeGame applies the rating and time control filters to a game the
+// player played as team.
+func (g *GenerateInput) includeGame(game *PgnGame, team pgn.Color) bool {
+	if g.MinElo > 0 || g.MaxElo > 0 {
+		elo, ok := game.Elo(team)
+		if !ok {
+			return false
+		}
+		if g.MinElo > 0 && elo < g.MinElo {
+			return false
+		}
+		if g.MaxElo > 0 && elo > g.MaxElo {
+			return false
+		}
+	}
+
+	if len(g.TimeControls) > 0 {
+		matched := false
+		for _, timeControl := range g.TimeControls {
+			if game.TimeControl == timeControl {
+				matched = true
 				break
 			}
+		}
+		if !matched {
+			return false
+		}
+	}
 
-			b.MakeMove(parsedMove)
+	return true
+}
 
-			if currentTurn != playerTeam {
-				currentTurn = SwitchTurn(currentTurn)
-				continue
-			}
+// GenerationStats describes what went into a single generation run.
+type GenerationStats struct {
+	UniqueGameStates int
+	TotalGameStates  int
+	IncludedGames    int
+	SkippedGames     int
+	DuplicateGames   int
+	// Games in a variant or from a position the board can't follow
+	UnsupportedGames int
+	// Included games cut short by a move the board couldn't follow
+	TruncatedGames int
+	// Games left out because of a move the board couldn't follow
+	BadMoveGames int
+	// The player's moves the blunder filter kept out of the profile
+	BlunderMoves int
+	// The player's moves per phase and how many of them were book moves
+	MovesByPhase     map[GamePhase]int
+	BookMovesByPhase map[GamePhase]int
+}
+
+// generation accumulates one profile's tallies a game at a time, so several
+// profiles can be fed from a single pass over a file.
+type generation struct {
+	input        *GenerateInput
+	counts       *PlayerCounts
+	stats        GenerationStats
+	uniqueStates map[string]bool
+	seenGames    map[[sha256.Size]byte]bool
+	// Engines for the blunder filter, nil when it is off
+	engines *enginePool
+}
+
+func (g *GenerateInput) newGeneration(counts *PlayerCounts) *generation {
+	return &generation{
+		input:  g,
+		counts: counts,
+		stats: GenerationStats{
+			MovesByPhase:     map[GamePhase]int{},
+			BookMovesByPhase: map[GamePhase]int{},
+		},
+		uniqueStates: map[string]bool{},
+		seenGames:    map[[sha256.Size]byte]bool{},
+	}
+}
 
-			// Remove Move and half move number
-			splits := strings.Split(gameState, " ")
-			gameState = splits[0]
-			positionHash := hash(gameState)
+func (gen *generation) addGame(game *PgnGame) {
+	if playerTeam, ok := gen.admit(game); ok {
+		gen.replay(game, playerTeam)
+	}
+}
 
-			totalUniqueGameStates[positionHash] = true
-			totalGameStates++
+// admit decides if the game trains the profile and which side the player
+// was on. It has to see the games in file order for deduplication to keep
+// the first copy.
+func (gen *generation) admit(game *PgnGame) (pgn.Color, bool) {
+	g := gen.input
+	stats := &gen.stats
+	playerName := g.PlayerName
 
-			move := game.Moves[i].M
+	var playerTeam pgn.Color
+	if game.White == playerName {
+		playerTeam = pgn.White
+	} else if game.Black == playerName {
+		playerTeam = pgn.Black
+	} else {
+		// The player isn't in this game at all
+		stats.SkippedGames++
+		return pgn.NoColor, false
+	}
 
-			if i < 10 {
-				// Get next move and add to position map
-				if _, ok := playerProfile.Positions[positionHash]; !ok {
-					playerProfile.Positions[positionHash] = map[string]int{}
-				}
-				playerProfile.Positions[positionHash][move]++
+	if !game.modelled() {
+		stats.UnsupportedGames++
+		return pgn.NoColor, false
+	}
+
+	if _, _, err := game.StartingBoard(); err != nil {
+		stats.UnsupportedGames++
+		return pgn.NoColor, false
+	}
+
+	if !g.includeGame(game, playerTeam) {
+		stats.SkippedGames++
+		return pgn.NoColor, false
+	}
+
+	if g.BadMovePolicy == BadMovePolicySkip {
+		if i, err := game.firstBadMove(); i >= 0 {
+			fmt.Printf("Skipping %s vs %s, move %d %q: %v\n", game.White, game.Black, i+1, game.Moves[i].M, err)
+			stats.BadMoveGames++
+			return pgn.NoColor, false
+		}
+	}
+
+	if g.Deduplicate {
+		key := game.MovesKey()
+		if gen.seenGames[key] {
+			stats.DuplicateGames++
+			return pgn.NoColor, false
+		}
+		gen.seenGames[key] = true
+	}
+	stats.IncludedGames++
+
+	return playerTeam, true
+}
+
+// replay tallies the player's moves from an admitted game into the counts.
+func (gen *generation) replay(game *PgnGame, playerTeam pgn.Color) {
+	g := gen.input
+	counts := gen.counts
+	stats := &gen.stats
+
+	positions, samples := counts.White, counts.WhiteSamples
+	if playerTeam == pgn.Black {
+		positions, samples = counts.Black, counts.BlackSamples
+	}
+	weight := g.bookWeight(game, playerTeam)
+
+	b, currentTurn, err := game.StartingBoard()
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < len(game.Moves); i++ {
+		// Gen FEN
+		gameState := b.String()
+
+		parsedMove, err := b.MoveFromAlgebraic(game.Moves[i].M, currentTurn)
+		if err != nil {
+			stats.TruncatedGames++
+			break
+		}
+
+		b.MakeMove(parsedMove)
+
+		// Only the player's own moves train the profile, the opponent's just
+		// move the board along. Nothing below may be reached on their turn.
+		if currentTurn != playerTeam {
+			currentTurn = SwitchTurn(currentTurn)
+			continue
+		}
+
+		if gen.engines != nil && gen.engines.isBlunder(gameState, parsedMove) {
+			stats.BlunderMoves++
+			currentTurn = SwitchTurn(currentTurn)
+			continue
+		}
+
+		positionHash := hash(g.positionKey(gameState))
+
+		gen.uniqueStates[positionHash] = true
+		stats.TotalGameStates++
+
+		move := game.Moves[i].M
+		phase := GetGamePhase(b, g.phaseBoundaries())
+		stats.MovesByPhase[phase]++
+
+		to := bits.TrailingZeros64(uint64(parsedMove.To))
+		addMoveKind(counts, move, relativeSquare(to, playerTeam))
+		addMaterial(counts, phase, materialBalance(b, playerTeam))
+
+		if i < 10 {
+			// Get next move and add to position map
+			if _, ok := positions[positionHash]; !ok {
+				positions[positionHash] = map[string]int{}
 			}
+			positions[positionHash][move] += weight
+			samples[positionHash]++
+			stats.BookMovesByPhase[phase]++
+		}
 
-			// Only update tables when queens are moved
-			if strings.Contains(gameState, "Q") || strings.Contains(gameState, "q") {
-				// Update piece square tables
-				index := bits.TrailingZeros(uint(parsedMove.To))
-				// Flip index if black
-				if currentTurn == pgn.Black {
-					index = 63 - index
+		// King moves skip the gating, the king is most active once the
+		// queens are gone and that is exactly what its table should show.
+		if g.shouldUpdateTables(gameState) || pieceMoved(move) == "k" {
+			score := float64(GetPhaseScore(b))
+
+			// Update piece square tables
+			for _, landed := range piecesLanded(move, parsedMove) {
+				// The board has the final say on whose piece landed, so a
+				// wrong turn can't blend the opponent's style into the
+				// player's tables
+				if g.OwnPiecesOnly && !ownPiece(b, landed.index, playerTeam) {
+					continue
 				}
-				key := pieceMoved(move)
+				index := relativeSquare(landed.index, playerTeam)
+				key := landed.piece
 
-				phase := GetGamePhase(b)
-				phaseTable := pieceSquareCounts[phase]
+				phaseTable := counts.PieceSquares[phase]
 				pieceTable := phaseTable[key]
 				pieceTable[index]++
 				phaseTable[key] = pieceTable
-				pieceSquareCounts[phase] = phaseTable
-			}
+				counts.PieceSquares[phase] = phaseTable
+				// Only the moving piece captured, a castled rook never does
+				if landed.piece == pieceMoved(move) && isCapture(move) {
+					addCaptureSquare(counts, phase, key, index)
+				}
 
-			currentTurn = SwitchTurn(currentTurn)
+				addSquareWeight(counts.Tapered[Opening], key, index, score)
+				addSquareWeight(counts.Tapered[EndGame], key, index, 1-score)
+			}
 		}
+
+		currentTurn = SwitchTurn(currentTurn)
 	}
+}
+
+func (gen *generation) finish() (PlayerAIProfile, GenerationStats) {
+	gen.stats.UniqueGameStates = len(gen.uniqueStates)
+
+	fmt.Printf(
+		"Player: %s UGS:%d TGS:%d Games included:%d skipped:%d duplicates:%d unsupported:%d truncated:%d dropped:%d blunders:%d\n",
+		gen.input.PlayerName, gen.stats.UniqueGameStates, gen.stats.TotalGameStates,
+		gen.stats.IncludedGames, gen.stats.SkippedGames, gen.stats.DuplicateGames,
+		gen.stats.UnsupportedGames, gen.stats.TruncatedGames, gen.stats.BadMoveGames,
+		gen.stats.BlunderMoves,
+	)
+
+	return gen.input.BuildProfile(gen.counts), gen.stats
+}
 
-	player.White.Positions = convertToPercentages(player.White.Positions)
-	player.Black.Positions = convertToPercentages(player.Black.Positions)
+// BuildProfile normalises the raw counts into a profile, counts is left
+// untouched so it can still be saved and merged later.
+func (g *GenerateInput) BuildProfile(counts *PlayerCounts) PlayerAIProfile {
+	player := PlayerAIProfile{
+		White: PlayerAITeamProfile{
+			Positions: convertToPercentages(counts.White),
+			Samples:   bookSamples(counts.White, counts.WhiteSamples),
+			Entropy:   bookEntropy(counts.White),
+		},
+		Black: PlayerAITeamProfile{
+			Positions: convertToPercentages(counts.Black),
+			Samples:   bookSamples(counts.Black, counts.BlackSamples),
+			Entropy:   bookEntropy(counts.Black),
+		},
+	}
 
 	// Convert piece square tables
+	pieceSquareCounts := map[GamePhase]map[string][64]int{}
 	for _, phase := range []GamePhase{Opening, MiddleGame, EndGame} {
-		phaseTable := pieceSquareCounts[phase]
+		phaseTable := map[string][64]int{}
 		for _, piece := range pieces {
-			sum := 0.0
-			values := phaseTable[string(piece)]
-			for _, count := range values {
-				sum += float64(count)
-			}
-
-			if sum > 0 {
-				for i, count := range values {
-					values[i] = int(math.Ceil((float64(count) / sum * 100.0)))
-				}
+			values := [64]float64{}
+			for i, count := range counts.PieceSquares[phase][string(piece)] {
+				values[i] = float64(count)
 			}
 
-			// sanity check print board with percentages
-			// fmt.Printf("---------------------- %c ----------------------\n", piece)
-			// fmt.Printf("Phase %s Piece: %c Sum: %f\n", phase, piece, sum)
-			// for rank := 0; rank < 8; rank++ {
-			// 	if rank == 0 {
-			// 		fmt.Printf("   ")
-			// 		for file := 0; file < 8; file++ {
-			// 			fmt.Printf("%c    ", 'A'+file)
-			// 		}
-			// 		fmt.Printf("\n")
-			// 	}
-			// 	fmt.Printf("%d ", 8-rank)
-			// 	for file := 0; file < 8; file++ {
-			// 		index := (7-rank)*8 + file
-			// 		if values[index] == 0 {
-			// 			fmt.Printf("---- ")
-			// 			continue
-			// 		} else {
-			// 			fmt.Printf("%04d ", values[index])
-			// 		}
-			// 	}
-			// 	fmt.Printf("\n")
-			// }
-
-			phaseTable[string(piece)] = values
+			phaseTable[string(piece)] = g.weightedSquares(phase, string(piece), values)
 		}
 
 		pieceSquareCounts[phase] = phaseTable
 	}
 
-	player.PiecePhaseTable = PieceSquarePhases{
+	// Written for every output, the game fails to load a profile without
+	// them
+	player.PiecePhaseTable = &PieceSquarePhases{
 		Opening:    PieceSquareTableNew(pieceSquareCounts[Opening]),
 		MiddleGame: PieceSquareTableNew(pieceSquareCounts[MiddleGame]),
 		EndGame:    PieceSquareTableNew(pieceSquareCounts[EndGame]),
 	}
+	if g.SplitCaptures {
+		g.splitCaptures(&player.PiecePhaseTable.Opening, counts, Opening)
+		g.splitCaptures(&player.PiecePhaseTable.MiddleGame, counts, MiddleGame)
+		g.splitCaptures(&player.PiecePhaseTable.EndGame, counts, EndGame)
+	}
+
+	if g.PieceSquareOutput == PieceSquareOutputTapered || g.PieceSquareOutput == PieceSquareOutputBoth {
+		tapered := map[GamePhase]map[string][64]int{}
+		for phase, phaseTable := range counts.Tapered {
+			tapered[phase] = map[string][64]int{}
+			for _, piece := range pieces {
+				tapered[phase][string(piece)] = g.weightedSquares(phase, string(piece), phaseTable[string(piece)])
+			}
+		}
+
+		player.TaperedTables = &TaperedPieceSquareTables{
+			Opening: PieceSquareTableNew(tapered[Opening]),
+			EndGame: PieceSquareTableNew(tapered[EndGame]),
+		}
+	}
 
 	// Convert piece value table
 	player.PieceWeights = []float32{
@@ -372,18 +1042,46 @@ func (g *GenerateInput) GenerateProfile() PlayerAIProfile {
 		200.,
 	}
 
+	player.Aggression = buildAggression(counts)
+	player.Material = buildMaterial(counts)
 	player.CheckBonus = g.CheckBonus
 	player.DecisionAlgorithm = g.DecisionAlgorithm
-
-	fmt.Printf("Player: %s UGS:%d TGS:%d\n", playerName, len(totalUniqueGameStates), totalGameStates)
+	if g.PositionKey != "" && g.PositionKey != PositionKeyPlacement {
+		player.PositionKey = g.PositionKey
+	}
+	if g.TableScale == TableScaleCentipawns {
+		player.TableScale = g.TableScale
+	}
 
 	return player
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		os.Exit(runInspect(os.Stdout, os.Args[2:]))
+	}
+
+	configPath := flag.String("config", "generate.json", "path to the profile generation config")
+	outputPath := flag.String("out", "player_profiles.computer.json", "path to write the generated profiles to")
+	countsIn := flag.String("counts-in", "", "raw counts from a previous run to merge the new games into")
+	countsOut := flag.String("counts-out", "", "path to write the raw counts to so a later run can merge into them")
+	countsSidecar := flag.Bool("counts-sidecar", false, "write the raw counts next to the output as <out>.counts.json, unless -counts-out is set")
+	reportPath := flag.String("report", "", "write a human readable report of each profile to this path, - for stdout")
+	workers := flag.Int("workers", 1, "goroutines replaying games, the output is the same for any number")
+	validate := flag.Bool("validate", false, "check the config and games files and print what would be generated without writing anything")
+	pretty := flag.Bool("pretty", false, "indent the profiles and counts JSON so it can be read and diffed")
+	var overrides overrideFlags
+	flag.Var(&overrides, "set", "override a config field as <player>.<field>=<value>, use * as the player to target every profile (repeatable)")
+	flag.Parse()
+
+	if *workers < 1 {
+		fmt.Printf("-workers must be at least 1, got %d\n", *workers)
+		os.Exit(1)
+	}
+
 	var generateProfiles []GenerateInput
 	{
-		data, err := os.ReadFile("generate.json")
+		data, err := os.ReadFile(*configPath)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
@@ -394,20 +1092,105 @@ func main() {
 		}
 	}
 
+	if err := applyOverrides(generateProfiles, overrides); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	valid := true
+	for _, g := range generateProfiles {
+		if err := g.Validate(); err != nil {
+			fmt.Printf("Profile %q is invalid:\n%s\n", g.PlayerName, err)
+			valid = false
+		}
+	}
+	if !valid {
+		os.Exit(1)
+	}
+
 	output := PlayerAIGroup{
 		Profiles: map[string]PlayerAIProfile{},
 	}
+	countsGroup := CountsGroup{Profiles: map[string]*PlayerCounts{}}
+	if *countsIn != "" {
+		var err error
+		countsGroup, err = loadCounts(*countsIn)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// Keep the profiles of players that aren't being regenerated
+		if data, err := os.ReadFile(*outputPath); err == nil {
+			if err := json.Unmarshal(data, &output); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		if output.Profiles == nil {
+			output.Profiles = map[string]PlayerAIProfile{}
+		}
+	}
+
+	var report io.Writer
+	switch *reportPath {
+	case "":
+	case "-":
+		report = os.Stdout
+	default:
+		file, err := os.Create(*reportPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		report = file
+	}
+
 	for _, g := range generateProfiles {
-		profile := g.GenerateProfile()
+		if _, ok := countsGroup.Profiles[g.PlayerName]; !ok {
+			countsGroup.Profiles[g.PlayerName] = NewPlayerCounts()
+		}
+	}
+
+	results, err := generateProfilesByFile(generateProfiles, countsGroup, *workers)
+	if *validate {
+		for i, g := range generateProfiles {
+			writeValidation(os.Stdout, g.PlayerName, results[i].profile, results[i].stats)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *validate {
+		return
+	}
+
+	for i, g := range generateProfiles {
+		profile, stats := results[i].profile, results[i].stats
+		if report != nil {
+			writeReport(report, g.PlayerName, profile, stats)
+		}
 		profile.Depth = g.Depth
 		output.Profiles[g.PlayerName] = profile
 	}
 
-	{
-		jsonBytes, _ := json.Marshal(output)
-		jsonString := string(jsonBytes)
+	// Profiles kept from an older file are rewritten in the current layout
+	output.SchemaVersion = ProfileSchemaVersion
+	if err := writeJSON(*outputPath, output, *pretty); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-		os.WriteFile("player_profiles.computer.json", []byte(jsonString), 0644)
+	if *countsOut == "" && *countsSidecar {
+		*countsOut = sidecarPath(*outputPath)
+	}
+	if *countsOut != "" {
+		if err := writeJSON(*countsOut, countsGroup, *pretty); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
 }
 
@@ -420,12 +1203,12 @@ func example() {
 
 	for _, job := range jobs {
 		wg.Add(1)
-		go func() {
+		go func(job string) {
 			defer wg.Done()
 			fmt.Println(job)
 			time.Sleep(1 * time.Second)
 			results <- job
-		}()
+		}(job)
 	}
 
 	wg.Wait()
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+func TestRelativeSquare(t *testing.T) {
+	tests := []struct {
+		square string
+		team   pgn.Color
+		want   string
+	}{
+		{"e2", pgn.White, "e2"},
+		{"g8", pgn.Black, "g1"},
+		{"a8", pgn.Black, "a1"},
+		{"h1", pgn.Black, "h8"},
+		{"c6", pgn.Black, "c3"},
+	}
+
+	for _, test := range tests {
+		square, _ := pgn.ParsePosition(test.square)
+		want, _ := pgn.ParsePosition(test.want)
+		got := relativeSquare(squareIndex(square), test.team)
+		if got != squareIndex(want) {
+			t.Errorf("relativeSquare(%s, %v) = %d, want %d (%s)", test.square, test.team, got, squareIndex(want), test.want)
+		}
+	}
+}
+
+func squareIndex(square pgn.Position) int {
+	for i := 0; i < 64; i++ {
+		if uint64(square) == uint64(1)<<i {
+			return i
+		}
+	}
+	return -1
+}
+
+func moves(sans ...string) []PgnMove {
+	var moves []PgnMove
+	for _, san := range sans {
+		moves = append(moves, PgnMove{M: san})
+	}
+	return moves
+}
+
+// replayCounts tallies a single game for the player called Me
+func replayCounts(t *testing.T, game PgnGame) *PlayerCounts {
+	t.Helper()
+	return replayCountsWith(t, &GenerateInput{PlayerName: "Me"}, game)
+}
+
+// replayCountsWith tallies a single game for input's player
+func replayCountsWith(t *testing.T, input *GenerateInput, game PgnGame) *PlayerCounts {
+	t.Helper()
+	counts := NewPlayerCounts()
+	gen := input.newGeneration(counts)
+	gen.addGame(&game)
+	if gen.stats.IncludedGames != 1 || gen.stats.TruncatedGames != 0 {
+		t.Fatalf("game wasn't replayed in full: %+v", gen.stats)
+	}
+	return counts
+}
+
+// The player's moves in each pair are the same opening from either side of
+// the board, so their tables have to come out the same
+func TestMirroredOpeningsMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		white PgnGame
+		black PgnGame
+	}{
+		{
+			name:  "kingside castle",
+			white: PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "a6", "Nf3", "a5", "Bc4", "h6", "O-O")},
+			black: PgnGame{White: "You", Black: "Me", Variant: "Standard", Moves: moves("a3", "e5", "a4", "Nf6", "h3", "Bc5", "h4", "O-O")},
+		},
+		{
+			name:  "queenside development",
+			white: PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("d4", "h6", "Nc3", "h5", "Bf4", "a6", "Qd2", "a5", "O-O-O")},
+			black: PgnGame{White: "You", Black: "Me", Variant: "Standard", Moves: moves("h3", "d5", "h4", "Nc6", "a3", "Bf5", "a4", "Qd7", "g3", "O-O-O")},
+		},
+		{
+			name:  "wing pawns",
+			white: PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("a4", "e6", "h4", "e5", "b3")},
+			black: PgnGame{White: "You", Black: "Me", Variant: "Standard", Moves: moves("e3", "a5", "e4", "h5", "d3", "b6")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			white := replayCounts(t, test.white)
+			black := replayCounts(t, test.black)
+
+			if !reflect.DeepEqual(white.PieceSquares, black.PieceSquares) {
+				t.Errorf("piece squares differ\nwhite %v\nblack %v", white.PieceSquares, black.PieceSquares)
+			}
+			if !reflect.DeepEqual(white.Tapered, black.Tapered) {
+				t.Errorf("tapered squares differ\nwhite %v\nblack %v", white.Tapered, black.Tapered)
+			}
+			if white.QuietMoves != black.QuietMoves || white.Captures != black.Captures {
+				t.Errorf("move destinations differ\nwhite %v %v\nblack %v %v", white.QuietMoves, white.Captures, black.QuietMoves, black.Captures)
+			}
+		})
+	}
+}
+
+// The game builds the same keys from its own board, see
+// ChessState::get_position_key
+func TestPositionKey(t *testing.T) {
+	b := pgn.NewBoard()
+	for i, san := range []string{"e4", "Nf6", "Ke2", "d5"} {
+		color := pgn.White
+		if i%2 == 1 {
+			color = pgn.Black
+		}
+		if err := b.MakeAlgebraicMove(san, color); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fen := b.String()
+
+	tests := []struct {
+		key  PositionKey
+		want string
+	}{
+		{"", "rnbqkb1r/ppp1pppp/5n2/3p4/4P3/8/PPPPKPPP/RNBQ1BNR"},
+		{PositionKeyPlacement, "rnbqkb1r/ppp1pppp/5n2/3p4/4P3/8/PPPPKPPP/RNBQ1BNR"},
+		{PositionKeyCastling, "rnbqkb1r/ppp1pppp/5n2/3p4/4P3/8/PPPPKPPP/RNBQ1BNR kq"},
+		{PositionKeyFull, "rnbqkb1r/ppp1pppp/5n2/3p4/4P3/8/PPPPKPPP/RNBQ1BNR kq d6"},
+	}
+
+	for _, test := range tests {
+		g := &GenerateInput{PositionKey: test.key}
+		if got := g.positionKey(fen); got != test.want {
+			t.Errorf("positionKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+// tableTotals counts the landings in the piece square tables by piece, across
+// every phase
+func tableTotals(counts *PlayerCounts) map[string]int {
+	totals := map[string]int{}
+	for _, tables := range counts.PieceSquares {
+		for piece, squares := range tables {
+			for _, count := range squares {
+				if count > 0 {
+					totals[piece] += count
+				}
+			}
+		}
+	}
+	return totals
+}
+
+// Me trades queens then develops a knight and walks the king, so each gating
+// counts a different set of the moves
+func TestTableGating(t *testing.T) {
+	game := PgnGame{
+		White:   "Me",
+		Black:   "You",
+		Variant: "Standard",
+		Moves:   moves("d4", "e5", "dxe5", "d6", "exd6", "Qxd6", "Qxd6", "cxd6", "Nc3", "Nc6", "Kd2"),
+	}
+
+	tests := []struct {
+		name  string
+		input GenerateInput
+		// Moves counted in the tables by piece, across every phase
+		want map[string]int
+	}{
+		{"always", GenerateInput{TableGating: TableGatingAlways}, map[string]int{"p": 3, "q": 1, "n": 1, "k": 1}},
+		{"unset", GenerateInput{}, map[string]int{"p": 3, "q": 1, "n": 1, "k": 1}},
+		// The knight moves once the queens are gone, the king is never gated
+		{"queens present", GenerateInput{TableGating: TableGatingQueensPresent}, map[string]int{"p": 3, "q": 1, "k": 1}},
+		// 62 before the trade and 44 after it
+		{"material above", GenerateInput{TableGating: TableGatingMaterialThreshold, MaterialThreshold: 44}, map[string]int{"p": 3, "q": 1, "n": 1, "k": 1}},
+		{"material below", GenerateInput{TableGating: TableGatingMaterialThreshold, MaterialThreshold: 45}, map[string]int{"p": 3, "q": 1, "k": 1}},
+		{"material none", GenerateInput{TableGating: TableGatingMaterialThreshold, MaterialThreshold: 63}, map[string]int{"k": 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.input.PlayerName = "Me"
+			got := tableTotals(replayCountsWith(t, &test.input, game))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("counted %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// The game fails to load a profile missing any of the fields its
+// PlayerAIProfile in src/computer_player.rs requires, whatever tables the
+// config asks for
+func TestProfileLoadsInGame(t *testing.T) {
+	game := PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "e5", "Nf3", "Nc6", "Bc4")}
+
+	for _, output := range []PieceSquareOutput{"", PieceSquareOutputPhases, PieceSquareOutputTapered, PieceSquareOutputBoth} {
+		t.Run(string(output), func(t *testing.T) {
+			input := &GenerateInput{PlayerName: "Me", PieceSquareOutput: output}
+			data, err := json.Marshal(input.BuildProfile(replayCountsWith(t, input, game)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var profile map[string]json.RawMessage
+			if err := json.Unmarshal(data, &profile); err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range []string{"white", "black", "depth", "piece_weights", "piece_square_phases", "check_bonus", "decision_algorithm"} {
+				if _, ok := profile[field]; !ok {
+					t.Errorf("no %s", field)
+				}
+			}
+
+			var phases map[GamePhase]map[string][]int
+			if err := json.Unmarshal(profile["piece_square_phases"], &phases); err != nil {
+				t.Fatal(err)
+			}
+			for _, phase := range []GamePhase{Opening, MiddleGame, EndGame} {
+				for _, piece := range []string{"pawn", "knight", "bishop", "rook", "queen", "king"} {
+					if len(phases[phase][piece]) != 64 {
+						t.Errorf("%s %s table has %d squares, want 64", phase, piece, len(phases[phase][piece]))
+					}
+				}
+			}
+
+			_, tapered := profile["tapered_piece_square_tables"]
+			if wantTapered := output == PieceSquareOutputTapered || output == PieceSquareOutputBoth; tapered != wantTapered {
+				t.Errorf("tapered tables written = %v, want %v", tapered, wantTapered)
+			}
+		})
+	}
+}
+
+func TestSquareCentipawns(t *testing.T) {
+	values := [64]float64{}
+	values[0] = 10
+	values[1] = 6
+	// Every other square is at zero, a mean of 0.25 with a1 furthest from
+	// it at 9.75
+
+	got := squareCentipawns(values, 50)
+	if got[0] != 50 || got[1] != 29 || got[2] != -1 || got[63] != -1 {
+		t.Errorf("squares a1, b1, c1 and h8 = %d, %d, %d and %d, want 50, 29, -1 and -1", got[0], got[1], got[2], got[63])
+	}
+
+	if got := squareCentipawns([64]float64{}, 50); got != [64]int{} {
+		t.Errorf("empty table = %v, want all zero", got)
+	}
+}
+
+func TestCentipawnProfile(t *testing.T) {
+	game := PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "e5", "Nf3", "Nc6", "Bc4", "Nf6", "Nc3")}
+
+	tests := []struct {
+		name      string
+		input     GenerateInput
+		wantScale TableScale
+		// The largest square in the opening knight table
+		wantMax int
+	}{
+		{"percentages", GenerateInput{}, "", 50},
+		{"default range", GenerateInput{TableScale: TableScaleCentipawns}, TableScaleCentipawns, DefaultCentipawnRange},
+		{"own range", GenerateInput{TableScale: TableScaleCentipawns, CentipawnRange: 20}, TableScaleCentipawns, 20},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.input.PlayerName = "Me"
+			profile := test.input.BuildProfile(replayCountsWith(t, &test.input, game))
+			if profile.TableScale != test.wantScale {
+				t.Errorf("table_scale = %q, want %q", profile.TableScale, test.wantScale)
+			}
+
+			knight := profile.PiecePhaseTable.Opening.Knight
+			if got := slices.Max(knight[:]); got != test.wantMax {
+				t.Errorf("largest knight square = %d, want %d", got, test.wantMax)
+			}
+		})
+	}
+}
+
+// Me is black, so only black's landings may reach the tables with the board
+// check on or off
+func TestOwnPiecesOnly(t *testing.T) {
+	game := PgnGame{
+		White:   "You",
+		Black:   "Me",
+		Variant: "Standard",
+		Moves:   moves("e4", "e5", "Nf3", "Nf6", "Bc4", "Be7", "d3", "O-O", "Bxf7+"),
+	}
+	// The castled rook counts as landing on f8
+	want := map[string]int{"p": 1, "n": 1, "b": 1, "k": 1, "r": 1}
+
+	for _, ownPiecesOnly := range []bool{false, true} {
+		input := &GenerateInput{PlayerName: "Me", OwnPiecesOnly: ownPiecesOnly}
+		if got := tableTotals(replayCountsWith(t, input, game)); !reflect.DeepEqual(got, want) {
+			t.Errorf("own_pieces_only %v counted %v, want %v", ownPiecesOnly, got, want)
+		}
+	}
+}
+
+func TestOwnPiece(t *testing.T) {
+	b := pgn.NewBoard()
+	tests := []struct {
+		square string
+		team   pgn.Color
+		want   bool
+	}{
+		{"e1", pgn.White, true},
+		{"e1", pgn.Black, false},
+		{"d8", pgn.Black, true},
+		{"e4", pgn.White, false},
+		{"e4", pgn.Black, false},
+	}
+
+	for _, test := range tests {
+		square, _ := pgn.ParsePosition(test.square)
+		if got := ownPiece(b, squareIndex(square), test.team); got != test.want {
+			t.Errorf("ownPiece(%s, %v) = %v, want %v", test.square, test.team, got, test.want)
+		}
+	}
+}
+
+func TestGetPhaseScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		score float32
+		phase GamePhase
+	}{
+		{"start", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 1, Opening},
+		{"one knight traded", "r1bqkbnr/pppppppp/8/8/8/8/PPPPPPPP/R1BQKBNR w KQkq - 0 1", 22.0 / 24, Opening},
+		{"knights traded", "r1bqkb1r/pppppppp/8/8/8/8/PPPPPPPP/R1BQKB1R w KQkq - 0 1", 20.0 / 24, MiddleGame},
+		{"queen and rook each", "3qk2r/8/8/8/8/8/8/3QK2R w - - 0 1", 12.0 / 24, MiddleGame},
+		{"rooks only", "r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1", 8.0 / 24, EndGame},
+		{"kings and pawns", "4k3/pppppppp/8/8/8/8/PPPPPPPP/4K3 w - - 0 1", 0, EndGame},
+		// Promoted queens can't push the score past a full board
+		{"extra queens", "rnbqkbnr/pppppppp/8/8/8/8/QQPPPPPP/RNBQKBNR w KQkq - 0 1", 1, Opening},
+	}
+
+	for _, test := range tests {
+		b, err := pgn.NewBoardFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := GetPhaseScore(b); got != test.score {
+			t.Errorf("%s: GetPhaseScore = %v, want %v", test.name, got, test.score)
+		}
+		if got := GetGamePhase(b, DefaultPhaseBoundaries); got != test.phase {
+			t.Errorf("%s: GetGamePhase = %s, want %s", test.name, got, test.phase)
+		}
+	}
+}
+
+// phaseTotals counts the landings in each phase's piece square tables by
+// piece
+func phaseTotals(counts *PlayerCounts) map[GamePhase]map[string]int {
+	totals := map[GamePhase]map[string]int{}
+	for phase, tables := range counts.PieceSquares {
+		for piece, squares := range tables {
+			for _, count := range squares {
+				if count > 0 {
+					if totals[phase] == nil {
+						totals[phase] = map[string]int{}
+					}
+					totals[phase][piece] += count
+				}
+			}
+		}
+	}
+	return totals
+}
+
+// The queen trade takes the score to 16 of 24, so Me's moves from the
+// capture on are middle game moves
+func TestPhaseFollowsMaterial(t *testing.T) {
+	game := PgnGame{
+		White:   "Me",
+		Black:   "You",
+		Variant: "Standard",
+		Moves:   moves("d4", "e5", "dxe5", "d6", "exd6", "Qxd6", "Qxd6", "cxd6", "Nc3"),
+	}
+
+	want := map[GamePhase]map[string]int{
+		Opening:    {"p": 3},
+		MiddleGame: {"q": 1, "n": 1},
+	}
+	if got := phaseTotals(replayCounts(t, game)); !reflect.DeepEqual(got, want) {
+		t.Errorf("counted %v, want %v", got, want)
+	}
+}
+
+func TestPhaseBoundariesValidate(t *testing.T) {
+	tests := []struct {
+		boundaries PhaseBoundaries
+		valid      bool
+	}{
+		{DefaultPhaseBoundaries, true},
+		{PhaseBoundaries{Opening: 1, EndGame: 0}, true},
+		{PhaseBoundaries{Opening: 0.5, EndGame: 0.5}, false},
+		{PhaseBoundaries{Opening: 0.3, EndGame: 0.6}, false},
+		{PhaseBoundaries{Opening: 1.1, EndGame: 0.3}, false},
+		{PhaseBoundaries{Opening: 0.9, EndGame: -0.1}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.boundaries.Validate(); (err == nil) != test.valid {
+			t.Errorf("%+v.Validate() = %v, want valid %v", test.boundaries, err, test.valid)
+		}
+	}
+}
+
+// The same queen trade as TestPhaseFollowsMaterial, with the boundaries
+// moved so the moves fall in other phases
+func TestPhaseBoundaries(t *testing.T) {
+	game := PgnGame{
+		White:   "Me",
+		Black:   "You",
+		Variant: "Standard",
+		Moves:   moves("d4", "e5", "dxe5", "d6", "exd6", "Qxd6", "Qxd6", "cxd6", "Nc3"),
+	}
+
+	tests := []struct {
+		name       string
+		boundaries PhaseBoundaries
+		want       map[GamePhase]map[string]int
+	}{
+		{"default", PhaseBoundaries{}, map[GamePhase]map[string]int{
+			Opening:    {"p": 3},
+			MiddleGame: {"q": 1, "n": 1},
+		}},
+		{"long opening", PhaseBoundaries{Opening: 0.6, EndGame: 0.2}, map[GamePhase]map[string]int{
+			Opening: {"p": 3, "q": 1, "n": 1},
+		}},
+		// The opening ends on the first piece to leave the board
+		{"early end game", PhaseBoundaries{Opening: 1, EndGame: 0.7}, map[GamePhase]map[string]int{
+			Opening:    {"p": 3},
+			MiddleGame: {"q": 1},
+			EndGame:    {"n": 1},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := &GenerateInput{PlayerName: "Me", PhaseBoundaries: test.boundaries}
+			if got := phaseTotals(replayCountsWith(t, input, game)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("counted %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// With a threshold no position meets only the king is left in the tables,
+// on its squares seen from black's side
+func TestKingMovesSkipGating(t *testing.T) {
+	game := PgnGame{
+		White:   "You",
+		Black:   "Me",
+		Variant: "Standard",
+		Moves:   moves("e4", "e5", "Nf3", "Ke7", "Nc3", "Kd6", "d4", "Nc6"),
+	}
+	input := &GenerateInput{PlayerName: "Me", TableGating: TableGatingMaterialThreshold, MaterialThreshold: 63}
+	counts := replayCountsWith(t, input, game)
+
+	if got, want := tableTotals(counts), map[string]int{"k": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counted %v, want %v", got, want)
+	}
+	king := counts.PieceSquares[Opening]["k"]
+	for _, square := range []string{"e2", "d3"} {
+		position, _ := pgn.ParsePosition(square)
+		if king[squareIndex(position)] != 1 {
+			t.Errorf("king table has %d on %s, want 1", king[squareIndex(position)], square)
+		}
+	}
+}
+
+func TestPieceMoved(t *testing.T) {
+	tests := []struct {
+		move string
+		want string
+	}{
+		{"e4", "p"},
+		{"exd5", "p"},
+		{"bxc3", "p"},
+		{"Bxc3", "b"},
+		{"Nf3", "n"},
+		{"Qh5+", "q"},
+		{"O-O", "k"},
+		{"O-O-O#", "k"},
+		{"e8=Q", "q"},
+		{"exd8=N+", "n"},
+	}
+
+	for _, test := range tests {
+		if got := pieceMoved(test.move); got != test.want {
+			t.Errorf("pieceMoved(%q) = %q, want %q", test.move, got, test.want)
+		}
+	}
+}
+
+// The pawn's last move lands a queen, so e8 is in the queen's table and the
+// pawn table stays empty
+func TestPromotionCountsForNewPiece(t *testing.T) {
+	game := PgnGame{
+		White:   "Me",
+		Black:   "You",
+		Variant: "FromPosition",
+		FEN:     "8/4P3/8/8/8/8/k7/4K3 w - - 0 1",
+		Moves:   moves("e8=Q", "Kb3", "Qe4"),
+	}
+	counts := replayCounts(t, game)
+
+	if got, want := tableTotals(counts), map[string]int{"q": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counted %v, want %v", got, want)
+	}
+	queen := counts.PieceSquares[EndGame]["q"]
+	for _, square := range []string{"e8", "e4"} {
+		position, _ := pgn.ParsePosition(square)
+		if queen[squareIndex(position)] != 1 {
+			t.Errorf("queen table has %d on %s, want 1", queen[squareIndex(position)], square)
+		}
+	}
+}
+
+func TestPiecesLanded(t *testing.T) {
+	tests := []struct {
+		move  string
+		color pgn.Color
+		want  map[string]string
+	}{
+		{"O-O", pgn.White, map[string]string{"k": "g1", "r": "f1"}},
+		{"O-O-O", pgn.White, map[string]string{"k": "c1", "r": "d1"}},
+		{"O-O", pgn.Black, map[string]string{"k": "g8", "r": "f8"}},
+		{"O-O-O+", pgn.Black, map[string]string{"k": "c8", "r": "d8"}},
+		{"Rb1", pgn.White, map[string]string{"r": "b1"}},
+		{"Kf1", pgn.White, map[string]string{"k": "f1"}},
+	}
+
+	for _, test := range tests {
+		fen := "r3k2r/pppppppp/8/8/8/8/PPPPPPPP/R3K2R w KQkq - 0 1"
+		if test.color == pgn.Black {
+			fen = strings.Replace(fen, " w ", " b ", 1)
+		}
+		b, err := pgn.NewBoardFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := b.MoveFromAlgebraic(test.move, test.color)
+		if err != nil {
+			t.Fatalf("%s: %v", test.move, err)
+		}
+
+		got := map[string]string{}
+		for _, landed := range piecesLanded(test.move, parsed) {
+			got[landed.piece] = pgn.Position(uint64(1) << landed.index).String()
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("piecesLanded(%q, %v) = %v, want %v", test.move, test.color, got, test.want)
+		}
+	}
+}
+
+// Black's long castle puts the rook on d8, which is d1 in black's tables
+func TestCastledRookCounted(t *testing.T) {
+	game := PgnGame{
+		White:   "You",
+		Black:   "Me",
+		Variant: "Standard",
+		Moves:   moves("e4", "d5", "Nf3", "Nc6", "Bc4", "Be6", "Nc3", "Qd7", "O-O", "O-O-O"),
+	}
+	counts := replayCounts(t, game)
+
+	rook := counts.PieceSquares[Opening]["r"]
+	d1, _ := pgn.ParsePosition("d1")
+	if rook[squareIndex(d1)] != 1 {
+		t.Errorf("rook table has %d on d1, want 1", rook[squareIndex(d1)])
+	}
+	if got := tableTotals(counts)["r"]; got != 1 {
+		t.Errorf("rook landings = %d, want 1", got)
+	}
+}
+
+func TestGamesWithoutPlayerSkipped(t *testing.T) {
+	games := []PgnGame{
+		{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "e5")},
+		{White: "You", Black: "Them", Variant: "Standard", Moves: moves("d4", "d5", "c4")},
+		{White: "me", Black: "You", Variant: "Standard", Moves: moves("c4")},
+		{White: "Them", Black: "Me", Variant: "Standard", Moves: moves("Nf3", "Nf6")},
+	}
+
+	counts := NewPlayerCounts()
+	gen := (&GenerateInput{PlayerName: "Me"}).newGeneration(counts)
+	for i := range games {
+		gen.addGame(&games[i])
+	}
+
+	if gen.stats.IncludedGames != 2 || gen.stats.SkippedGames != 2 {
+		t.Errorf("included %d and skipped %d, want 2 and 2", gen.stats.IncludedGames, gen.stats.SkippedGames)
+	}
+	// Only e4 and Nf6 are Me's
+	if got, want := tableTotals(counts), map[string]int{"p": 1, "n": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counted %v, want %v", got, want)
+	}
+}
+
+// The book keeps how many times each position was seen next to the
+// percentages, so three games and three hundred aren't trusted the same
+func TestBookSamples(t *testing.T) {
+	games := []PgnGame{
+		{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "e5", "Nf3")},
+		{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "c5", "Nf3")},
+		{White: "Me", Black: "You", Variant: "Standard", Moves: moves("d4", "d5")},
+	}
+	input := &GenerateInput{PlayerName: "Me"}
+	counts := NewPlayerCounts()
+	gen := input.newGeneration(counts)
+	for i := range games {
+		gen.addGame(&games[i])
+	}
+	profile := input.BuildProfile(counts)
+
+	start := hash(input.positionKey(pgn.NewBoard().String()))
+	if got := profile.White.Samples[start]; got != 3 {
+		t.Errorf("start position samples = %d, want 3", got)
+	}
+	if got, want := profile.White.Positions[start], map[string]int{"e4": 66, "d4": 33}; !reflect.DeepEqual(got, want) {
+		t.Errorf("start position moves = %v, want %v", got, want)
+	}
+	for position, samples := range profile.White.Samples {
+		if position != start && samples != 1 {
+			t.Errorf("position %s samples = %d, want 1", position, samples)
+		}
+	}
+}
+
+// A game set up with black to move hands Me the first move
+func TestSetUpGame(t *testing.T) {
+	game := PgnGame{
+		White:   "You",
+		Black:   "Me",
+		Variant: "FromPosition",
+		FEN:     "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 3 3",
+		Moves:   moves("Nf6", "Nc3", "Bc5"),
+	}
+	counts := replayCounts(t, game)
+
+	if got, want := tableTotals(counts), map[string]int{"n": 1, "b": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counted %v, want %v", got, want)
+	}
+	// The book starts from the set up position, not the usual start
+	input := &GenerateInput{PlayerName: "Me"}
+	position := hash(input.positionKey(game.FEN))
+	if counts.Black[position]["Nf6"] != 1 {
+		t.Errorf("black book = %v, want Nf6 from the set up position", counts.Black)
+	}
+}
+
+func TestUnmodelledGames(t *testing.T) {
+	games := []PgnGame{
+		{White: "Me", Black: "You", Variant: "Chess960", Moves: moves("e4")},
+		{White: "Me", Black: "You", Variant: "Crazyhouse", Moves: moves("e4")},
+		// Nothing to set up from
+		{White: "Me", Black: "You", Variant: "FromPosition", Moves: moves("e4")},
+		{White: "Me", Black: "You", Variant: "FromPosition", FEN: "not a fen", Moves: moves("e4")},
+		{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4")},
+	}
+
+	counts := NewPlayerCounts()
+	gen := (&GenerateInput{PlayerName: "Me"}).newGeneration(counts)
+	for i := range games {
+		gen.addGame(&games[i])
+	}
+	if gen.stats.UnsupportedGames != 4 || gen.stats.IncludedGames != 1 {
+		t.Errorf("unsupported %d and included %d, want 4 and 1", gen.stats.UnsupportedGames, gen.stats.IncludedGames)
+	}
+}
+
+// Bb6 is illegal, the bishop's diagonal runs through b5
+func TestBadMovePolicy(t *testing.T) {
+	game := PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "e5", "Nf3", "Nc6", "Bb6", "a6")}
+	if i, err := game.firstBadMove(); i != 4 || err == nil {
+		t.Errorf("firstBadMove = %d, %v, want 4 and an error", i, err)
+	}
+
+	tests := []struct {
+		name      string
+		policy    BadMovePolicy
+		included  int
+		truncated int
+		dropped   int
+		want      map[string]int
+	}{
+		{"unset", "", 1, 1, 0, map[string]int{"p": 1, "n": 1}},
+		{"truncate", BadMovePolicyTruncate, 1, 1, 0, map[string]int{"p": 1, "n": 1}},
+		{"skip", BadMovePolicySkip, 0, 0, 1, map[string]int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counts := NewPlayerCounts()
+			gen := (&GenerateInput{PlayerName: "Me", BadMovePolicy: test.policy}).newGeneration(counts)
+			gen.addGame(&game)
+
+			stats := gen.stats
+			if stats.IncludedGames != test.included || stats.TruncatedGames != test.truncated || stats.BadMoveGames != test.dropped {
+				t.Errorf("included %d truncated %d dropped %d, want %d %d %d", stats.IncludedGames, stats.TruncatedGames, stats.BadMoveGames, test.included, test.truncated, test.dropped)
+			}
+			if got := tableTotals(counts); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("counted %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFirstBadMoveClean(t *testing.T) {
+	game := PgnGame{Variant: "Standard", Moves: moves("e4", "e5", "Nf3")}
+	if i, err := game.firstBadMove(); i != -1 || err != nil {
+		t.Errorf("firstBadMove = %d, %v, want -1 and nil", i, err)
+	}
+}
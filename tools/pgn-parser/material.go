@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+// materialValues are the usual pawn units, fixed rather than taken from the
+// profile's piece values so counts from different configs can be merged.
+var materialValues = map[rune]int{
+	'p': 1,
+	'n': 3,
+	'b': 3,
+	'r': 5,
+	'q': 9,
+}
+
+// MaterialCounts tallies the material balance after the player's moves in
+// one phase.
+type MaterialCounts struct {
+	Moves int `json:"moves"`
+	// Sum of the balance after each move in pawns, from the player's side
+	Balance int `json:"balance"`
+	Behind  int `json:"behind"`
+	Ahead   int `json:"ahead"`
+}
+
+// MaterialPhase is the player's typical material situation in a phase, so
+// the AI can be as willing to gamble pawns or trade down a piece up.
+type MaterialPhase struct {
+	// Average lead in pawns after the player's moves, negative when behind.
+	Balance float32 `json:"balance"`
+	// Share of the player's moves made while behind or ahead, 0 to 1.
+	Behind float32 `json:"behind"`
+	Ahead  float32 `json:"ahead"`
+}
+
+// materialBalance is team's material minus the opponent's in pawns.
+func materialBalance(board *pgn.Board, team pgn.Color) int {
+	placement := strings.Split(board.String(), " ")[0]
+
+	balance := 0
+	for _, c := range placement {
+		value := materialValues[unicode.ToLower(c)]
+		if unicode.IsUpper(c) == (team == pgn.White) {
+			balance += value
+		} else {
+			balance -= value
+		}
+	}
+
+	return balance
+}
+
+func addMaterial(counts *PlayerCounts, phase GamePhase, balance int) {
+	tally := counts.Material[phase]
+	tally.Moves++
+	tally.Balance += balance
+	if balance < 0 {
+		tally.Behind++
+	} else if balance > 0 {
+		tally.Ahead++
+	}
+	counts.Material[phase] = tally
+}
+
+func buildMaterial(counts *PlayerCounts) map[GamePhase]MaterialPhase {
+	material := map[GamePhase]MaterialPhase{}
+	for phase, tally := range counts.Material {
+		if tally.Moves == 0 {
+			continue
+		}
+		moves := float32(tally.Moves)
+		material[phase] = MaterialPhase{
+			Balance: float32(tally.Balance) / moves,
+			Behind:  float32(tally.Behind) / moves,
+			Ahead:   float32(tally.Ahead) / moves,
+		}
+	}
+
+	return material
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+func TestMaterialBalance(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		team pgn.Color
+		want int
+	}{
+		{"start", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", pgn.White, 0},
+		{"white a knight up", "r1bqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", pgn.White, 3},
+		{"black a knight down", "r1bqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", pgn.Black, -3},
+		// Kings count for nothing
+		{"queen against rook", "3qk3/8/8/8/8/8/8/3RK3 w - - 0 1", pgn.White, -4},
+	}
+
+	for _, test := range tests {
+		b, err := pgn.NewBoardFEN(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := materialBalance(b, test.team); got != test.want {
+			t.Errorf("%s: materialBalance = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+// The balance is taken after each of the player's moves, so a pawn won and
+// given straight back still counts once ahead
+func TestMaterialProfile(t *testing.T) {
+	game := PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "d5", "exd5", "Qxd5", "Nc3", "Qa5")}
+	counts := replayCounts(t, game)
+
+	if got, want := counts.Material[Opening], (MaterialCounts{Moves: 3, Balance: 1, Ahead: 1}); got != want {
+		t.Errorf("opening counts = %+v, want %+v", got, want)
+	}
+	want := map[GamePhase]MaterialPhase{
+		Opening: {Balance: 1.0 / 3, Ahead: 1.0 / 3},
+	}
+	if got := buildMaterial(counts); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildMaterial = %+v, want %+v", got, want)
+	}
+}
+
+func TestMaterialEmpty(t *testing.T) {
+	if got := buildMaterial(NewPlayerCounts()); len(got) != 0 {
+		t.Errorf("buildMaterial with no moves = %+v, want empty", got)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+
+	"gopkg.in/freeeve/pgn.v1"
+)
+
+// gamesPerBatch is how many admitted games a worker replays at a time.
+const gamesPerBatch = 256
+
+// admittedGame is a game with the side the player was on for each
+// generation, NoColor where the generation didn't admit it.
+type admittedGame struct {
+	game  *PgnGame
+	teams []pgn.Color
+}
+
+type gameBatch struct {
+	seq   int
+	games []admittedGame
+}
+
+type batchResult struct {
+	seq   int
+	parts []*generation
+}
+
+// part is an empty worker local accumulator for the same profile.
+func (gen *generation) part() *generation {
+	part := gen.input.newGeneration(NewPlayerCounts())
+	part.seenGames = nil
+	part.engines = gen.engines
+	return part
+}
+
+// merge is the reducer for worker local accumulators. Everything replay
+// tallies is a sum, and the tapered weights are multiples of 2^-28 well
+// inside float64's exact range, so the result is the same whatever order
+// the parts are merged in. They are still merged in batch order so that
+// holds without relying on it.
+func (gen *generation) merge(part *generation) {
+	gen.counts.Merge(part.counts)
+
+	for state := range part.uniqueStates {
+		gen.uniqueStates[state] = true
+	}
+
+	gen.stats.TotalGameStates += part.stats.TotalGameStates
+	gen.stats.TruncatedGames += part.stats.TruncatedGames
+	gen.stats.BlunderMoves += part.stats.BlunderMoves
+	for phase, moves := range part.stats.MovesByPhase {
+		gen.stats.MovesByPhase[phase] += moves
+	}
+	for phase, moves := range part.stats.BookMovesByPhase {
+		gen.stats.BookMovesByPhase[phase] += moves
+	}
+}
+
+// replayParallel feeds every game from stream to the generations, replaying
+// them on workers goroutines. Games are admitted in file order on the
+// calling goroutine so filtering and deduplication match a sequential run.
+func replayParallel(generations []*generation, workers int, stream func(handle func(game *PgnGame)) error) error {
+	jobs := make(chan gameBatch, workers)
+	results := make(chan batchResult, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range jobs {
+				parts := make([]*generation, len(generations))
+				for i, gen := range generations {
+					parts[i] = gen.part()
+				}
+				for _, admitted := range batch.games {
+					for i, team := range admitted.teams {
+						if team != pgn.NoColor {
+							parts[i].replay(admitted.game, team)
+						}
+					}
+				}
+				results <- batchResult{seq: batch.seq, parts: parts}
+			}
+		}()
+	}
+
+	merged := make(chan struct{})
+	go func() {
+		defer close(merged)
+		pending := map[int][]*generation{}
+		next := 0
+		for result := range results {
+			pending[result.seq] = result.parts
+			for parts, ok := pending[next]; ok; parts, ok = pending[next] {
+				for i, gen := range generations {
+					gen.merge(parts[i])
+				}
+				delete(pending, next)
+				next++
+			}
+		}
+	}()
+
+	batch := gameBatch{}
+	err := stream(func(game *PgnGame) {
+		admitted := admittedGame{game: game, teams: make([]pgn.Color, len(generations))}
+		wanted := false
+		for i, gen := range generations {
+			team, ok := gen.admit(game)
+			admitted.teams[i] = team
+			wanted = wanted || ok
+		}
+		if !wanted {
+			return
+		}
+
+		batch.games = append(batch.games, admitted)
+		if len(batch.games) == gamesPerBatch {
+			jobs <- batch
+			batch = gameBatch{seq: batch.seq + 1}
+		}
+	})
+	if len(batch.games) > 0 {
+		jobs <- batch
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(results)
+	<-merged
+
+	return err
+}
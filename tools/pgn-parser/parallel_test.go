@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openingGames plays every combination of a few opening moves, with Me
+// taking each side and every game played twice so deduplication has
+// something to drop. There are enough for several batches.
+func openingGames() []PgnGame {
+	var games []PgnGame
+	for _, first := range []string{"e4", "d4", "c4", "Nf3"} {
+		for _, reply := range []string{"e6", "d6", "c6", "Nf6", "g6"} {
+			for _, second := range []string{"Nc3", "g3", "b3"} {
+				for _, secondReply := range []string{"a6", "h6", "b6"} {
+					line := moves(first, reply, second, secondReply, "Bb2", "Bb7")
+					white := PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: line}
+					black := PgnGame{White: "You", Black: "Me", Variant: "Standard", Moves: line}
+					games = append(games, white, black, white, black)
+				}
+			}
+		}
+	}
+	return games
+}
+
+// writeGames writes games to a JSON games file in a temporary directory
+func writeGames(t *testing.T, games []PgnGame) string {
+	t.Helper()
+	data, err := json.Marshal(games)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "games.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testInputs are two differently configured profiles trained on one file
+func testInputs(fileName string) []GenerateInput {
+	return []GenerateInput{
+		{PlayerName: "Me", FileName: fileName, Deduplicate: true},
+		{
+			PlayerName:        "You",
+			FileName:          fileName,
+			PositionKey:       PositionKeyFull,
+			PieceSquareOutput: PieceSquareOutputBoth,
+			TableScale:        TableScaleCentipawns,
+			SplitCaptures:     true,
+		},
+	}
+}
+
+// generateOutput runs a generation the way main does and gives the bytes of
+// the profiles and counts files it would write
+func generateOutput(t *testing.T, inputs []GenerateInput, workers int) ([]byte, []byte) {
+	t.Helper()
+	countsGroup := CountsGroup{Profiles: map[string]*PlayerCounts{}}
+	for _, g := range inputs {
+		countsGroup.Profiles[g.PlayerName] = NewPlayerCounts()
+	}
+
+	results, err := generateProfilesByFile(inputs, countsGroup, workers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := PlayerAIGroup{SchemaVersion: ProfileSchemaVersion, Profiles: map[string]PlayerAIProfile{}}
+	for i, g := range inputs {
+		output.Profiles[g.PlayerName] = results[i].profile
+	}
+
+	profiles, err := json.Marshal(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := json.Marshal(countsGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profiles, counts
+}
+
+func TestParallelMatchesSequential(t *testing.T) {
+	games := openingGames()
+	if len(games) <= 2*gamesPerBatch {
+		t.Fatalf("only %d games, want several batches of %d", len(games), gamesPerBatch)
+	}
+	inputs := testInputs(writeGames(t, games))
+	wantProfiles, wantCounts := generateOutput(t, inputs, 1)
+
+	for _, workers := range []int{2, 3, 8} {
+		profiles, counts := generateOutput(t, inputs, workers)
+		if !bytes.Equal(profiles, wantProfiles) {
+			t.Errorf("%d workers wrote different profiles to a sequential run", workers)
+		}
+		if !bytes.Equal(counts, wantCounts) {
+			t.Errorf("%d workers wrote different counts to a sequential run", workers)
+		}
+	}
+}
+
+// Map iteration order changes from run to run, so anything written in it
+// shows up as a difference between repeated generations
+func TestGenerationIsRepeatable(t *testing.T) {
+	inputs := testInputs(writeGames(t, openingGames()))
+
+	for _, workers := range []int{1, 4} {
+		wantProfiles, wantCounts := generateOutput(t, inputs, workers)
+		for run := 1; run < 5; run++ {
+			profiles, counts := generateOutput(t, inputs, workers)
+			if !bytes.Equal(profiles, wantProfiles) {
+				t.Errorf("run %d with %d workers wrote different profiles to the first", run, workers)
+			}
+			if !bytes.Equal(counts, wantCounts) {
+				t.Errorf("run %d with %d workers wrote different counts to the first", run, workers)
+			}
+		}
+	}
+}
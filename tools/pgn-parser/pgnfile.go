@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Games can also be read straight from PGN exports rather than the JSON the
+// tool was first written for. Only the tags the filters use are kept.
+
+var tagPattern = regexp.MustCompile(`^\[(\w+)\s+"((?:[^"\\]|\\.)*)"\]\s*$`)
+
+// isPGNFile is whether a games file should be read as PGN rather than JSON,
+// going by its extension.
+func isPGNFile(fileName string) bool {
+	return strings.HasSuffix(fileName, ".pgn") || strings.HasSuffix(fileName, ".pgn.gz")
+}
+
+// variantNames maps the spellings different sites use, lower cased with
+// spaces and dashes removed, to the names used in PgnGame.Variant.
+var variantNames = map[string]string{
+	"":                   "Standard",
+	"standard":           "Standard",
+	"normal":             "Standard",
+	"chess":              "Standard",
+	"chess960":           "Chess960",
+	"960":                "Chess960",
+	"fischerandom":       "Chess960",
+	"fischerrandom":      "Chess960",
+	"fischerrandomchess": "Chess960",
+	"fromposition":       "FromPosition",
+	"threecheck":         "ThreeCheck",
+	"3check":             "ThreeCheck",
+	"kingofthehill":      "KingOfTheHill",
+	"koth":               "KingOfTheHill",
+	"racingkings":        "RacingKings",
+	"horde":              "Horde",
+	"atomic":             "Atomic",
+	"antichess":          "Antichess",
+	"crazyhouse":         "Crazyhouse",
+}
+
+// normalizeVariant gives the canonical name for a variant tag, unknown
+// variants are passed through untouched.
+func normalizeVariant(variant string) string {
+	key := strings.ToLower(strings.TrimSpace(variant))
+	key = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(key)
+	if name, ok := variantNames[key]; ok {
+		return name
+	}
+
+	return variant
+}
+
+func unescapeTag(value string) string {
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value)
+}
+
+// pgnMoves pulls the SAN moves out of movetext, dropping move numbers,
+// comments, variations, NAGs, annotation marks and the result.
+func pgnMoves(movetext string) []PgnMove {
+	var cleaned strings.Builder
+	depth := 0
+	inComment := false
+	for _, r := range movetext {
+		switch {
+		case inComment:
+			inComment = r != '}'
+		case r == '{':
+			inComment = true
+		case r == '(':
+			depth++
+		case r == ')':
+			depth = max(depth-1, 0)
+		case depth == 0:
+			cleaned.WriteRune(r)
+		}
+	}
+
+	moves := []PgnMove{}
+	for _, token := range strings.Fields(cleaned.String()) {
+		// Move numbers can be written against the move, "12.e4" or "12...e5"
+		if i := strings.LastIndex(token, "."); i >= 0 {
+			token = token[i+1:]
+		}
+		token = strings.TrimRight(token, "!?")
+
+		switch {
+		case token == "", token[0] == '$':
+			continue
+		case token == "1-0", token == "0-1", token == "1/2-1/2", token == "*":
+			continue
+		}
+
+		moves = append(moves, PgnMove{M: token})
+	}
+
+	return moves
+}
+
+func newPgnGame(tags map[string]string, movetext string) PgnGame {
+	return PgnGame{
+		White:       tags["White"],
+		Black:       tags["Black"],
+		WhiteElo:    tags["WhiteElo"],
+		BlackElo:    tags["BlackElo"],
+		TimeControl: tags["TimeControl"],
+		Variant:     normalizeVariant(tags["Variant"]),
+		FEN:         setupFEN(tags),
+		Moves:       pgnMoves(movetext),
+		Tags:        tags,
+	}
+}
+
+// setupFEN is the starting position from the FEN tag. SetUp "0" says the game
+// is from the standard start whatever the FEN tag holds.
+func setupFEN(tags map[string]string) string {
+	if tags["SetUp"] == "0" {
+		return ""
+	}
+
+	return strings.TrimSpace(tags["FEN"])
+}
+
+// stripLineComment cuts a line at a ";" comment. A ";" inside a quoted tag
+// value or a brace comment is part of it and doesn't start one. inBrace is
+// whether a brace comment opened on an earlier line is still open, and the
+// state after the line is returned for the next.
+func stripLineComment(line string, inBrace bool) (string, bool) {
+	inQuote := false
+	escaped := false
+	for i, r := range line {
+		switch {
+		case inBrace:
+			inBrace = r != '}'
+		case inQuote:
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"':
+				inQuote = false
+			}
+		case r == '"':
+			inQuote = true
+		case r == '{':
+			inBrace = true
+		case r == ';':
+			return line[:i], inBrace
+		}
+	}
+
+	return line, inBrace
+}
+
+// readPGN hands each game in a PGN export to handle as soon as its movetext
+// has been read.
+func readPGN(input io.Reader, handle func(game *PgnGame)) error {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	tags := map[string]string{}
+	var movetext strings.Builder
+	inBrace := false
+	flush := func() {
+		if len(tags) == 0 && strings.TrimSpace(movetext.String()) == "" {
+			return
+		}
+		game := newPgnGame(tags, movetext.String())
+		handle(&game)
+		tags = map[string]string{}
+		movetext.Reset()
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Rest of line comments and escaped lines
+		if strings.HasPrefix(line, "%") {
+			continue
+		}
+
+		// A tag line closes a brace comment left open in the game before,
+		// so one missing "}" can't swallow the games after it
+		tag, _ := stripLineComment(line, false)
+		if match := tagPattern.FindStringSubmatch(strings.TrimSpace(tag)); match != nil {
+			// A tag after movetext starts the next game
+			if strings.TrimSpace(movetext.String()) != "" {
+				flush()
+			}
+			tags[match[1]] = unescapeTag(match[2])
+			inBrace = false
+			continue
+		}
+
+		line, inBrace = stripLineComment(line, inBrace)
+		movetext.WriteString(line)
+		movetext.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	flush()
+	return nil
+}
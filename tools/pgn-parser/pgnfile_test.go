@@ -0,0 +1,148 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeVariant(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"", "Standard"},
+		{"Standard", "Standard"},
+		{"normal", "Standard"},
+		{"Chess960", "Chess960"},
+		{"Fischer Random", "Chess960"},
+		{"fischer-random-chess", "Chess960"},
+		{"Three-check", "ThreeCheck"},
+		{"3check", "ThreeCheck"},
+		{"King of the Hill", "KingOfTheHill"},
+		{"Racing_Kings", "RacingKings"},
+		{" horde ", "Horde"},
+		{"From Position", "FromPosition"},
+		{"Shogi", "Shogi"},
+	}
+
+	for _, test := range tests {
+		if got := normalizeVariant(test.tag); got != test.want {
+			t.Errorf("normalizeVariant(%q) = %q, want %q", test.tag, got, test.want)
+		}
+	}
+}
+
+// readGames reads every game in a PGN export
+func readGames(t *testing.T, export string) []PgnGame {
+	t.Helper()
+	var games []PgnGame
+	if err := readPGN(strings.NewReader(export), func(game *PgnGame) {
+		games = append(games, *game)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return games
+}
+
+func TestReadPGNComments(t *testing.T) {
+	tests := []struct {
+		name   string
+		export string
+		// Each game's Event tag and moves
+		events []string
+		moves  [][]string
+	}{
+		{
+			name:   "rest of line comment",
+			export: "[Event \"a\"]\n\n1. e4 e5 ; 2. Nf3\n2. Nc3 *\n",
+			events: []string{"a"},
+			moves:  [][]string{{"e4", "e5", "Nc3"}},
+		},
+		{
+			name:   "semicolon in a tag value",
+			export: "[Event \"a; b\"]\n\n1. e4 e5 *\n",
+			events: []string{"a; b"},
+			moves:  [][]string{{"e4", "e5"}},
+		},
+		{
+			name:   "escaped quote before a semicolon",
+			export: "[Event \"say \\\"hi\\\"; bye\"]\n\n1. e4 *\n",
+			events: []string{"say \"hi\"; bye"},
+			moves:  [][]string{{"e4"}},
+		},
+		{
+			name:   "semicolon in a brace comment",
+			export: "[Event \"a\"]\n\n1. e4 {note; more} e5 2. Nf3 *\n",
+			events: []string{"a"},
+			moves:  [][]string{{"e4", "e5", "Nf3"}},
+		},
+		{
+			name:   "brace comment over several lines",
+			export: "[Event \"a\"]\n\n1. e4 {a long;\nnote} e5 ; Nf3\n2. Nc3 *\n",
+			events: []string{"a"},
+			moves:  [][]string{{"e4", "e5", "Nc3"}},
+		},
+		{
+			name:   "brace after a semicolon",
+			export: "[Event \"a\"]\n\n1. e4 ; a {\n1... e5 *\n",
+			events: []string{"a"},
+			moves:  [][]string{{"e4", "e5"}},
+		},
+		{
+			name:   "unclosed brace",
+			export: "[Event \"a\"]\n\n1. e4 {oops e5 *\n\n[Event \"b\"]\n\n1. d4 d5 *\n",
+			events: []string{"a", "b"},
+			moves:  [][]string{{"e4"}, {"d4", "d5"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			games := readGames(t, test.export)
+			var events []string
+			var moves [][]string
+			for _, game := range games {
+				events = append(events, game.Tags["Event"])
+				var sans []string
+				for _, move := range game.Moves {
+					sans = append(sans, move.M)
+				}
+				moves = append(moves, sans)
+			}
+
+			if !reflect.DeepEqual(events, test.events) {
+				t.Errorf("events = %q, want %q", events, test.events)
+			}
+			if !reflect.DeepEqual(moves, test.moves) {
+				t.Errorf("moves = %q, want %q", moves, test.moves)
+			}
+		})
+	}
+}
+
+func TestReadPGNSetUp(t *testing.T) {
+	const fen = "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3"
+	tests := []struct {
+		name    string
+		tags    string
+		variant string
+		fen     string
+	}{
+		{"set up", "[SetUp \"1\"]\n[FEN \"" + fen + "\"]\n", "Standard", fen},
+		{"from position", "[Variant \"From Position\"]\n[FEN \"" + fen + "\"]\n", "FromPosition", fen},
+		// SetUp 0 says the FEN tag is only there for show
+		{"not set up", "[SetUp \"0\"]\n[FEN \"" + fen + "\"]\n", "Standard", ""},
+		{"no FEN", "[Event \"x\"]\n", "Standard", ""},
+	}
+
+	for _, test := range tests {
+		games := readGames(t, test.tags+"\n3. Bb5 *\n")
+		if len(games) != 1 {
+			t.Fatalf("%s: read %d games, want 1", test.name, len(games))
+		}
+		if games[0].Variant != test.variant || games[0].FEN != test.fen {
+			t.Errorf("%s: variant %q FEN %q, want %q and %q", test.name, games[0].Variant, games[0].FEN, test.variant, test.fen)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+var pieceNames = map[rune]string{
+	'p': "Pawn",
+	'n': "Knight",
+	'b': "Bishop",
+	'r': "Rook",
+	'q': "Queen",
+	'k': "King",
+}
+
+func (t PieceSquareTables) byPiece(piece rune) [64]int {
+	switch piece {
+	case 'p':
+		return t.Pawn
+	case 'n':
+		return t.Knight
+	case 'b':
+		return t.Bishop
+	case 'r':
+		return t.Rook
+	case 'q':
+		return t.Queen
+	}
+
+	return t.King
+}
+
+// writeSquareTable prints a table as a board from white's side, rank 8 at
+// the top. Empty squares are shown as dashes so hot spots stand out.
+func writeSquareTable(w io.Writer, values [64]int) {
+	fmt.Fprintf(w, "   ")
+	for file := 0; file < 8; file++ {
+		fmt.Fprintf(w, "%c    ", 'A'+file)
+	}
+	fmt.Fprintf(w, "\n")
+
+	for rank := 0; rank < 8; rank++ {
+		fmt.Fprintf(w, "%d ", 8-rank)
+		for file := 0; file < 8; file++ {
+			index := (7-rank)*8 + file
+			if values[index] == 0 {
+				fmt.Fprintf(w, "---- ")
+			} else {
+				fmt.Fprintf(w, "%04d ", values[index])
+			}
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func writeTables(w io.Writer, title string, tables PieceSquareTables) {
+	for _, piece := range pieces {
+		fmt.Fprintf(w, "---------------------- %s %s ----------------------\n", title, pieceNames[piece])
+		writeSquareTable(w, tables.byPiece(piece))
+	}
+
+	if tables.Captures != nil {
+		writeTables(w, title+" captures", *tables.Captures)
+	}
+	if tables.Quiet != nil {
+		writeTables(w, title+" quiet", *tables.Quiet)
+	}
+}
+
+// writeReport prints a profile's tables and opening book coverage so it can be
+// sanity checked before it is used in the game.
+func writeReport(w io.Writer, name string, profile PlayerAIProfile, stats GenerationStats) {
+	fmt.Fprintf(w, "==================== %s ====================\n", name)
+	fmt.Fprintf(w, "Games included: %d skipped: %d duplicates: %d unsupported: %d\n",
+		stats.IncludedGames, stats.SkippedGames, stats.DuplicateGames, stats.UnsupportedGames)
+	fmt.Fprintf(w, "Games truncated by a bad move: %d dropped for one: %d\n", stats.TruncatedGames, stats.BadMoveGames)
+	fmt.Fprintf(w, "Moves filtered as blunders: %d\n", stats.BlunderMoves)
+	fmt.Fprintf(w, "Positions: %d unique of %d\n", stats.UniqueGameStates, stats.TotalGameStates)
+	fmt.Fprintf(w, "Book positions: white %d black %d\n", len(profile.White.Positions), len(profile.Black.Positions))
+	fmt.Fprintf(w, "Book mean entropy: white %.2f black %.2f bits\n", meanEntropy(profile.White.Entropy), meanEntropy(profile.Black.Entropy))
+
+	fmt.Fprintf(w, "Book coverage by phase:\n")
+	for _, phase := range []GamePhase{Opening, MiddleGame, EndGame} {
+		moves := stats.MovesByPhase[phase]
+		coverage := 0.0
+		if moves > 0 {
+			coverage = float64(stats.BookMovesByPhase[phase]) / float64(moves) * 100
+		}
+		fmt.Fprintf(w, "  %-11s %6d moves %6.2f%% from book\n", phase, moves, coverage)
+	}
+
+	fmt.Fprintf(w, "Material balance by phase:\n")
+	for _, phase := range []GamePhase{Opening, MiddleGame, EndGame} {
+		material := profile.Material[phase]
+		fmt.Fprintf(w, "  %-11s %+6.2f pawns %6.2f%% behind %6.2f%% ahead\n",
+			phase, material.Balance, material.Behind*100, material.Ahead*100)
+	}
+
+	fmt.Fprintf(w, "Capture rate: %.2f%%\n", profile.Aggression.CaptureRate*100)
+	fmt.Fprintf(w, "---------------------- Captures by square ----------------------\n")
+	writeSquareTable(w, profile.Aggression.Squares)
+
+	writeProfileTables(w, profile)
+}
+
+// writeProfileTables prints every piece square table the profile has
+func writeProfileTables(w io.Writer, profile PlayerAIProfile) {
+	if profile.PiecePhaseTable != nil {
+		writeTables(w, string(Opening), profile.PiecePhaseTable.Opening)
+		writeTables(w, string(MiddleGame), profile.PiecePhaseTable.MiddleGame)
+		writeTables(w, string(EndGame), profile.PiecePhaseTable.EndGame)
+	}
+
+	if profile.TaperedTables != nil {
+		writeTables(w, "tapered opening", profile.TaperedTables.Opening)
+		writeTables(w, "tapered end_game", profile.TaperedTables.EndGame)
+	}
+}
+
+// writeValidation summarises what a generation run would produce without
+// the tables themselves.
+func writeValidation(w io.Writer, name string, profile PlayerAIProfile, stats GenerationStats) {
+	size := 0
+	if data, err := json.Marshal(profile); err == nil {
+		size = len(data)
+	}
+
+	fmt.Fprintf(w, "%s: games included %d skipped %d duplicates %d unsupported %d, truncated %d, dropped for bad moves %d, blunders filtered %d, about %d KiB of output\n",
+		name, stats.IncludedGames, stats.SkippedGames, stats.DuplicateGames, stats.UnsupportedGames, stats.TruncatedGames, stats.BadMoveGames, stats.BlunderMoves, (size+1023)/1024)
+}
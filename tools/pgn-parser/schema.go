@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// ProfileSchemaVersion is written to every profiles file so the game can
+// tell a layout it doesn't understand from a bad profile. Bump it whenever a
+// field of PlayerAIGroup is added, removed or changes meaning, and add a
+// line below.
+//
+//	0 Files written before the version was added, which read it as zero.
+//	  Depending on their age they may lack samples, tapered_tables,
+//	  aggression, material, entropy or the capture and quiet tables.
+//	  Black's squares were mirrored through the centre, swapping files as
+//	  well as ranks, and the game reads these files that way.
+//	1 schema_version added, every field above is written. Black's squares
+//	  are mirrored across the ranks only.
+const ProfileSchemaVersion = 1
+
+// writeJSON writes value to path, indented when pretty so the output can be
+// read and diffed by hand. encoding/json writes map keys sorted, so positions
+// and the moves in each come out in the same order every run. Anything else
+// written here must stay as repeatable: a slice built from a map is sorted
+// first and a float summed over a map is summed in sorted order, as
+// bookEntropy does. The same games and config then give the same bytes for
+// any number of workers.
+func writeJSON(path string, value any, pretty bool) error {
+	var data []byte
+	var err error
+	if pretty {
+		data, err = json.MarshalIndent(value, "", "  ")
+	} else {
+		data, err = json.Marshal(value)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	group := PlayerAIGroup{
+		SchemaVersion: ProfileSchemaVersion,
+		Profiles: map[string]PlayerAIProfile{
+			"Me": {White: PlayerAITeamProfile{Positions: map[string]map[string]int{"b": {"e4": 100}, "a": {"d4": 60, "c4": 40}}}},
+		},
+	}
+
+	dir := t.TempDir()
+	read := func(name string, pretty bool) []byte {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := writeJSON(path, group, pretty); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	compact := read("compact.json", false)
+	pretty := read("pretty.json", true)
+	if bytes.Contains(compact, []byte("\n")) {
+		t.Errorf("compact output has new lines:\n%s", compact)
+	}
+	if !bytes.Contains(pretty, []byte("\n  \"profiles\": {\n")) {
+		t.Errorf("pretty output isn't indented by two spaces:\n%s", pretty)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, compact, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(indented.Bytes(), pretty) {
+		t.Errorf("pretty output differs from the compact output indented\n%s\nwant\n%s", pretty, indented.Bytes())
+	}
+
+	// Map keys come out sorted, so writing again gives the same bytes
+	if again := read("again.json", true); !bytes.Equal(again, pretty) {
+		t.Errorf("second write differs:\n%s\nwant\n%s", again, pretty)
+	}
+
+	var got PlayerAIGroup
+	if err := json.Unmarshal(pretty, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SchemaVersion != ProfileSchemaVersion {
+		t.Errorf("schema_version = %d, want %d", got.SchemaVersion, ProfileSchemaVersion)
+	}
+	if !reflect.DeepEqual(got.Profiles["Me"].White.Positions, group.Profiles["Me"].White.Positions) {
+		t.Errorf("positions = %v, want %v", got.Profiles["Me"].White.Positions, group.Profiles["Me"].White.Positions)
+	}
+}
+
+// Files from before the version was written read as version 0
+func TestSchemaVersionMissing(t *testing.T) {
+	var group PlayerAIGroup
+	if err := json.Unmarshal([]byte(`{"profiles": {"Me": {}}}`), &group); err != nil {
+		t.Fatal(err)
+	}
+	if group.SchemaVersion != 0 {
+		t.Errorf("schema_version = %d, want 0", group.SchemaVersion)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import "fmt"
+
+// TableSmoothing evens out piece square tables built from sparse data,
+// where neighbouring squares can end up wildly different.
+type TableSmoothing struct {
+	// Average each square with its mirror across the d/e file line, most
+	// openings are played just as happily on either wing.
+	Mirror bool `json:"mirror"`
+	// Weight given to the eight surrounding squares relative to the square
+	// itself, diagonals get Blur squared. Zero disables blurring.
+	Blur float64 `json:"blur"`
+}
+
+func (s TableSmoothing) Validate() error {
+	if s.Blur < 0 || s.Blur > 1 {
+		return fmt.Errorf("smoothing.blur must be between 0 and 1, got %v", s.Blur)
+	}
+
+	return nil
+}
+
+// apply smooths a table of square weights (a1 = 0, h8 = 63). Both passes
+// are symmetric so a symmetric table stays symmetric.
+func (s TableSmoothing) apply(values [64]float64) [64]float64 {
+	if s.Mirror {
+		mirrored := values
+		for i := range values {
+			// Flipping the file keeps the rank, a1 <-> h1
+			mirrored[i] = (values[i] + values[i^7]) / 2
+		}
+		values = mirrored
+	}
+
+	if s.Blur > 0 {
+		blurred := [64]float64{}
+		for i := range values {
+			file, rank := i%8, i/8
+
+			sum, weights := 0.0, 0.0
+			for df := -1; df <= 1; df++ {
+				for dr := -1; dr <= 1; dr++ {
+					f, r := file+df, rank+dr
+					if f < 0 || f > 7 || r < 0 || r > 7 {
+						continue
+					}
+
+					weight := 1.0
+					for n := df*df + dr*dr; n > 0; n-- {
+						weight *= s.Blur
+					}
+					sum += values[r*8+f] * weight
+					weights += weight
+				}
+			}
+
+			blurred[i] = sum / weights
+		}
+		values = blurred
+	}
+
+	return values
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSmoothingMirror(t *testing.T) {
+	values := [64]float64{}
+	values[0] = 4  // a1
+	values[10] = 2 // c2
+
+	got := TableSmoothing{Mirror: true}.apply(values)
+	want := map[int]float64{0: 2, 7: 2, 10: 1, 13: 1}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("square %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSmoothingBlur(t *testing.T) {
+	values := [64]float64{}
+	values[0] = 1 // a1
+
+	got := TableSmoothing{Blur: 0.5}.apply(values)
+	tests := []struct {
+		square string
+		index  int
+		want   float64
+	}{
+		// Only a1 has weight, divided by the weights around each square
+		{"a1", 0, 1 / 2.25},
+		{"b1", 1, 0.5 / 3},
+		{"b2", 9, 0.25 / 4},
+		{"c1", 2, 0},
+	}
+	for _, test := range tests {
+		if math.Abs(got[test.index]-test.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", test.square, got[test.index], test.want)
+		}
+	}
+}
+
+// Both passes keep a table that is the same on either wing that way
+func TestSmoothingKeepsSymmetry(t *testing.T) {
+	values := [64]float64{}
+	for i := range values {
+		file, rank := i%8, i/8
+		values[i] = float64(min(file, 7-file)*rank + rank)
+	}
+
+	got := TableSmoothing{Mirror: true, Blur: 0.3}.apply(values)
+	for i := range got {
+		if math.Abs(got[i]-got[i^7]) > 1e-9 {
+			t.Errorf("square %d = %v, its mirror %d = %v", i, got[i], i^7, got[i^7])
+		}
+	}
+}
+
+func TestSmoothingOff(t *testing.T) {
+	values := [64]float64{}
+	values[12] = 3
+	values[50] = 1
+
+	if got := (TableSmoothing{}).apply(values); got != values {
+		t.Errorf("apply with no smoothing = %v, want %v", got, values)
+	}
+}
+
+func TestSmoothingValidate(t *testing.T) {
+	for _, blur := range []float64{0, 0.5, 1} {
+		if err := (TableSmoothing{Blur: blur}).Validate(); err != nil {
+			t.Errorf("blur %v: %v", blur, err)
+		}
+	}
+	for _, blur := range []float64{-0.1, 1.1} {
+		if err := (TableSmoothing{Blur: blur}).Validate(); err == nil {
+			t.Errorf("blur %v accepted", blur)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// TableWeights scales each piece's normalised square table, so how far a
+// piece is drawn towards its favourite squares can be turned up or down
+// relative to the other pieces. Zero or left out leaves the table as is.
+type TableWeights struct {
+	Pawn   float64 `json:"pawn"`
+	Knight float64 `json:"knight"`
+	Bishop float64 `json:"bishop"`
+	Rook   float64 `json:"rook"`
+	Queen  float64 `json:"queen"`
+	King   float64 `json:"king"`
+}
+
+func (w TableWeights) weight(piece string) float64 {
+	weights := map[string]float64{
+		"p": w.Pawn,
+		"n": w.Knight,
+		"b": w.Bishop,
+		"r": w.Rook,
+		"q": w.Queen,
+		"k": w.King,
+	}
+	if weights[piece] == 0 {
+		return 1
+	}
+	return weights[piece]
+}
+
+func (w TableWeights) Validate(phase GamePhase) error {
+	var errs []error
+	weights := map[string]float64{
+		"pawn":   w.Pawn,
+		"knight": w.Knight,
+		"bishop": w.Bishop,
+		"rook":   w.Rook,
+		"queen":  w.Queen,
+		"king":   w.King,
+	}
+	for _, piece := range []string{"pawn", "knight", "bishop", "rook", "queen", "king"} {
+		if weights[piece] < 0 {
+			errs = append(errs, fmt.Errorf("table_weights.%s.%s must not be negative, got %v", phase, piece, weights[piece]))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateTableWeights checks every phase is one the tables are split by
+// and no weight is negative
+func validateTableWeights(weights map[GamePhase]TableWeights) []error {
+	var errs []error
+	for phase, phaseWeights := range weights {
+		switch phase {
+		case Opening, MiddleGame, EndGame:
+		default:
+			errs = append(errs, fmt.Errorf("unknown table_weights phase %q", phase))
+			continue
+		}
+		if err := phaseWeights.Validate(phase); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// weightedSquares normalises a piece's table and scales it by the piece's
+// weight in the phase. A weight of 2 on the end game king doubles every
+// square's bonus, so a king move towards the centre outweighs the same gain
+// for any other piece. With the centipawns scale this can go past
+// centipawn_range.
+func (g *GenerateInput) weightedSquares(phase GamePhase, piece string, values [64]float64) [64]int {
+	result := g.normaliseSquares(values)
+
+	weight := g.TableWeights[phase].weight(piece)
+	if weight == 1 {
+		return result
+	}
+	for i, value := range result {
+		result[i] = int(math.Round(float64(value) * weight))
+	}
+	return result
+}
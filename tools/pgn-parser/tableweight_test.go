@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateTableWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[GamePhase]TableWeights
+		// Part of the error, empty when the weights are valid
+		want string
+	}{
+		{"left out", nil, ""},
+		{"valid", map[GamePhase]TableWeights{EndGame: {King: 2, Pawn: 0.5}}, ""},
+		{"negative", map[GamePhase]TableWeights{MiddleGame: {Rook: -1}}, "table_weights.middle_game.rook must not be negative, got -1"},
+		{"unknown phase", map[GamePhase]TableWeights{"late": {King: 2}}, `unknown table_weights phase "late"`},
+	}
+
+	for _, test := range tests {
+		g := validConfig(t)
+		g.TableWeights = test.weights
+		err := g.Validate()
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%s: Validate() = %v, want nil", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: Validate() = %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestWeightedSquares(t *testing.T) {
+	values := [64]float64{}
+	values[0], values[1] = 1, 3
+
+	g := &GenerateInput{TableWeights: map[GamePhase]TableWeights{EndGame: {King: 2, Pawn: 0.5}}}
+	tests := []struct {
+		name  string
+		phase GamePhase
+		piece string
+		// Squares 0 and 1
+		want [2]int
+	}{
+		{"doubled", EndGame, "k", [2]int{50, 150}},
+		{"halved", EndGame, "p", [2]int{13, 38}},
+		{"left out piece", EndGame, "q", [2]int{25, 75}},
+		{"left out phase", Opening, "k", [2]int{25, 75}},
+	}
+
+	for _, test := range tests {
+		got := g.weightedSquares(test.phase, test.piece, values)
+		if [2]int{got[0], got[1]} != test.want {
+			t.Errorf("%s: squares = %v, want %v", test.name, got[:2], test.want)
+		}
+	}
+}
+
+// Only the weighted piece's table changes in the profile
+func TestTableWeightsProfile(t *testing.T) {
+	game := PgnGame{White: "Me", Black: "You", Variant: "Standard", Moves: moves("e4", "e5", "Nf3", "Nc6", "Bc4", "Nf6", "Nc3")}
+
+	plain := &GenerateInput{PlayerName: "Me"}
+	weighted := &GenerateInput{PlayerName: "Me", TableWeights: map[GamePhase]TableWeights{Opening: {Knight: 2}}}
+	want := plain.BuildProfile(replayCountsWith(t, plain, game)).PiecePhaseTable.Opening
+	got := weighted.BuildProfile(replayCountsWith(t, weighted, game)).PiecePhaseTable.Opening
+
+	if largest := slices.Max(got.Knight[:]); largest != 100 {
+		t.Errorf("largest knight square = %d, want 100", largest)
+	}
+	if got.Bishop != want.Bishop || got.Pawn != want.Pawn {
+		t.Errorf("unweighted tables changed, bishop %v pawn %v", got.Bishop, got.Pawn)
+	}
+}